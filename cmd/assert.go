@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	assertCmd = &cobra.Command{
+		Use:   "assert <file>",
+		Short: "check the cached access control list against expectations",
+		Long: `Evaluates a YAML or JSON file of access expectations and fails on violations:
+Usage example:
+	iamsnitch assert access.yaml
+
+Example file:
+	assertions:
+	  # only the deployer may pass application roles
+	  - name: deployer passes app roles
+	    permissions: [iam:PassRole]
+	    resources: ["arn:aws:iam::*:role/app-*"]
+	    only: ["AWS[arn:aws:iam::111122223333:role/deployer]"]
+
+	  # nobody outside the account reads PII buckets
+	  - name: pii stays in the account
+	    permissions: [s3:GetObject]
+	    resources: ["arn:aws:s3:::pii-*"]
+	    accounts: ["111122223333"]
+
+	  # the readonly role can't write
+	  - name: readonly is read only
+	    principals: ["AWS[arn:aws:iam::111122223333:role/readonly]"]
+	    deny_access_levels: [Write, Permissions management]`,
+		Args:         cobra.ExactArgs(1),
+		RunE:         runAssert,
+		SilenceUsage: true,
+	}
+)
+
+type assertionFile struct {
+	Assertions []model.Assertion `yaml:"assertions"`
+}
+
+func init() {
+	rootCmd.AddCommand(assertCmd)
+}
+
+func runAssert(cmd *cobra.Command, args []string) error {
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var af assertionFile
+	if err := yaml.Unmarshal(data, &af); err != nil {
+		return fmt.Errorf("unable to parse %v: %w", args[0], err)
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	results, err := accessService.Assert(af.Assertions)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Printf("PASS %v\n", r.Assertion.Name)
+			continue
+		}
+
+		failed++
+		fmt.Printf("FAIL %v\n", r.Assertion.Name)
+		if r.Err != nil {
+			fmt.Printf("  error: %v\n", r.Err)
+		}
+		for _, v := range r.Violations {
+			fmt.Printf("  %v can %v on %v\n", v.Principal.ID, v.Permission.ID, v.Resource.ID)
+			printGrantChain(v.GrantChain)
+		}
+	}
+
+	fmt.Printf("%v passed, %v failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%v assertions failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "run security checks over the cached access control list",
+		Long: `Reports findings such as administrator access, wildcard or unknown principals in
+trust policies, confused deputy risks and unused roles:
+Usage example:
+	# fail when any finding of high or critical severity is found
+	iamsnitch audit --fail-on high --known-accounts 111122223333,444455556666
+
+	# upload findings to code scanning, ignoring the ones accepted in a baseline
+	iamsnitch audit -o json > baseline.json
+	iamsnitch audit -o sarif --baseline baseline.json > iamsnitch.sarif`,
+		RunE:         runAudit,
+		SilenceUsage: true,
+	}
+	failOn        string
+	knownAccounts []string
+	unusedDays    int
+	auditOutput   string
+	baselineFile  string
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&failOn, "fail-on", "", "exit with an error when a finding at or above this severity is found (info, low, medium, high, critical)")
+	auditCmd.Flags().StringSliceVar(&knownAccounts, "known-accounts", []string{}, "accounts trusted roles may be assumed from")
+	auditCmd.Flags().IntVar(&unusedDays, "unused-days", 90, "days without use after which a role is reported, 0 disables the check")
+	auditCmd.Flags().StringVarP(&auditOutput, "output", "o", "text", "output format (text, json, sarif, junit)")
+	auditCmd.Flags().StringVar(&baselineFile, "baseline", "", "JSON report of accepted findings to leave out")
+
+	rootCmd.AddCommand(auditCmd)
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	if err := auditDefaults(cmd); err != nil {
+		return err
+	}
+
+	threshold := model.Severity(-1)
+	if failOn != "" {
+		s, err := model.ParseSeverity(failOn)
+		if err != nil {
+			return err
+		}
+		threshold = s
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	findings, err := accessService.Audit(&iamsnitch.AuditConfig{
+		KnownAccounts: knownAccounts,
+		UnusedAfter:   time.Duration(unusedDays) * 24 * time.Hour,
+		Now:           time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if baselineFile != "" {
+		if findings, err = excludeBaseline(findings, baselineFile); err != nil {
+			return err
+		}
+	}
+
+	if err := printFindings(findings, auditOutput); err != nil {
+		return err
+	}
+
+	if threshold >= 0 {
+		var failed int
+		for _, f := range findings {
+			if f.Severity >= threshold {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%v findings at or above %v severity", failed, threshold)
+		}
+	}
+	return nil
+}
+
+// auditDefaults fills the flags that weren't given from the profile audit
+// settings.
+func auditDefaults(cmd *cobra.Command) error {
+	p, err := loadProfile()
+	if err != nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	if !flags.Changed("fail-on") && p.Audit.FailOn != "" {
+		failOn = p.Audit.FailOn
+	}
+	if !flags.Changed("known-accounts") && len(p.Audit.KnownAccounts) > 0 {
+		knownAccounts = p.Audit.KnownAccounts
+	}
+	if !flags.Changed("unused-days") && p.Audit.UnusedDays != nil {
+		unusedDays = *p.Audit.UnusedDays
+	}
+	return defaultOutput(cmd, &auditOutput, "text", "json", "sarif", "junit")
+}
+
+func excludeBaseline(findings []model.Finding, path string) ([]model.Finding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	baseline, err := report.ReadBaseline(f)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]model.Finding, 0, len(findings))
+	for _, f := range findings {
+		if !baseline[f.Fingerprint()] {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered, nil
+}
+
+func printFindings(findings []model.Finding, format string) error {
+	switch format {
+	case "json":
+		return report.WriteJSON(os.Stdout, findings)
+	case "sarif":
+		return report.WriteSARIF(os.Stdout, iamsnitch.CheckInfos(), findings)
+	case "junit":
+		return report.WriteJUnit(os.Stdout, iamsnitch.CheckInfos(), findings)
+	case "text":
+		for _, f := range findings {
+			fmt.Printf("[%v] %v: %v\n", f.Severity, f.CheckID, f.Message)
+		}
+		fmt.Printf("%v findings\n", len(findings))
+		return nil
+	}
+	return fmt.Errorf("unknown output format %v", format)
+}
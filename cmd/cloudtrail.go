@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/aws"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cloudTrailCmd = &cobra.Command{
+		Use:   "cloudtrail <path|s3://bucket/prefix>...",
+		Short: "Load CloudTrail logs into the cache to track which permissions are used",
+		Long: `Records when each user or role last performed each action on each resource, so
+whatcan --unused can tell the permissions that aren't exercised. Logs are read from local
+files, gzipped or not, from directories holding them, or from an S3 prefix the profile
+credentials can read. Logs can be loaded in any order and more than once:
+Usage example:
+	# logs synced from the trail bucket
+	iamsnitch cloudtrail ./AWSLogs/111122223333/CloudTrail
+
+	# logs of December read straight from the trail bucket
+	iamsnitch cloudtrail s3://trail-bucket/AWSLogs/111122223333/CloudTrail/us-east-1/2021/12/`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runCloudTrailCmd,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(cloudTrailCmd)
+}
+
+func runCloudTrailCmd(cmd *cobra.Command, args []string) error {
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	var paths []string
+	var sources []ports.UsageProviderIface
+	for _, a := range args {
+		if !strings.HasPrefix(a, "s3://") {
+			paths = append(paths, a)
+			continue
+		}
+		cfg, err := newAWSConfig()
+		if err != nil {
+			return err
+		}
+		s3, err := aws.NewCloudTrailS3(cfg, a)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, s3)
+	}
+	if len(paths) > 0 {
+		sources = append(sources, aws.NewCloudTrailFiles(paths))
+	}
+
+	for _, s := range sources {
+		if err := accessService.RefreshUsage(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
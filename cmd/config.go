@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jeandreh/iam-snitch/internal/aws"
+	"github.com/jeandreh/iam-snitch/internal/cache"
+	"github.com/jeandreh/iam-snitch/internal/config"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configFile            string
+	profileName           string
+	dropIncompatibleCache bool
+	activeProfile         *config.Profile
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file, defaults to ~/.config/iamsnitch/config.yaml (env IAMSNITCH_CONFIG)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "config profile to use (env IAMSNITCH_PROFILE)")
+	rootCmd.PersistentFlags().BoolVar(&dropIncompatibleCache, "drop-incompatible-cache", false, "drop the cached rules written by an incompatible version, to be refreshed")
+}
+
+// loadProfile resolves the selected profile once. A missing config file is
+// only an error when it was asked for explicitly.
+func loadProfile() (*config.Profile, error) {
+	if activeProfile != nil {
+		return activeProfile, nil
+	}
+
+	path := configFile
+	if path == "" {
+		path = os.Getenv("IAMSNITCH_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = config.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := config.Load(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		c = &config.Config{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	name := profileName
+	if name == "" {
+		name = os.Getenv("IAMSNITCH_PROFILE")
+	}
+
+	p, err := c.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.ApplyEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+
+	activeProfile = p
+	return p, nil
+}
+
+func newCache() (ports.CacheIface, error) {
+	p, err := loadProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	var c ports.CacheIface
+	if p.Cache.Backend == "postgres" {
+		c, err = cache.NewPostgres(p.Cache.DSN, dropIncompatibleCache)
+	} else {
+		var path string
+		if path, err = config.ExpandHome(p.Cache.Path); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		c, err = cache.Open(path, dropIncompatibleCache)
+	}
+	if errors.Is(err, cache.ErrIncompatibleSchema) {
+		return nil, fmt.Errorf("%w, rerun with --drop-incompatible-cache to do so", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newProvider builds an IAM provider for the profile credentials or, when
+// account is given, for the role assumed in that account.
+func newProvider(account *config.Account) (*aws.IAMProvider, error) {
+	p, err := loadProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := newAWSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if account != nil {
+		assumed := aws.AssumeRole(*cfg, account.RoleARN, p.AWS.ExternalID)
+		cfg = &assumed
+	}
+
+	return aws.NewIAMProvider(cfg)
+}
+
+// newAWSConfig loads the AWS configuration of the profile.
+func newAWSConfig() (*awssdk.Config, error) {
+	p, err := loadProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	return aws.LoadConfig(&aws.ConfigOptions{
+		Profile:    p.AWS.Profile,
+		Region:     p.AWS.Region,
+		RoleARN:    p.AWS.RoleARN,
+		ExternalID: p.AWS.ExternalID,
+	})
+}
+
+// defaultOutput applies the profile output format to a command that wasn't
+// given --output, provided the command supports that format.
+func defaultOutput(cmd *cobra.Command, output *string, formats ...string) error {
+	if cmd.Flags().Changed("output") {
+		return nil
+	}
+
+	p, err := loadProfile()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range formats {
+		if f == p.Output {
+			*output = f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/spf13/cobra"
+)
+
+var (
+	escalationCmd = &cobra.Command{
+		Use:   "escalation",
+		Short: "find principals that can escalate their privileges",
+		Long: `Looks for known privilege escalation primitives in the cached rules, such as
+iam:PassRole combined with lambda:CreateFunction, iam:CreatePolicyVersion or
+sts:AssumeRole into an administrator role:
+Usage example:
+	iamsnitch escalation`,
+		RunE: runEscalation,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(escalationCmd)
+}
+
+func runEscalation(cmd *cobra.Command, args []string) error {
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	paths, err := accessService.Escalations()
+	if err != nil {
+		return err
+	}
+	printEscalationPaths(paths)
+	return nil
+}
+
+func printEscalationPaths(paths []model.EscalationPath) {
+	for _, p := range paths {
+		fmt.Printf("principal: %s\n", p.Principal.ID)
+		fmt.Printf("technique: %s\n", p.Technique.ID)
+		fmt.Printf("description: %s\n", p.Technique.Description)
+		fmt.Println("via: ")
+		printGrantChain(p.GrantChain)
+		fmt.Println("")
+	}
+}
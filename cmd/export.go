@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "export the cached access control list",
+	}
+	exportGraphCmd = &cobra.Command{
+		Use:   "graph",
+		Short: "export every cached grant chain as a graph",
+		Long: `Dumps principals, roles, policies and resources as a graph so access maps can be
+rendered in design docs or loaded into graph tools:
+Usage example:
+	# render the whole cache with Graphviz
+	iamsnitch export graph --format dot | dot -Tsvg > access.svg
+
+	# open the graph in yEd or Gephi
+	iamsnitch export graph --format graphml > access.graphml
+
+	# load the graph into Neo4j or any other openCypher database
+	iamsnitch export graph --format cypher | cypher-shell`,
+		RunE: runExportGraph,
+	}
+	exportNeo4jCmd = &cobra.Command{
+		Use:   "neo4j-csv",
+		Short: "export every cached grant chain as Neo4j bulk import files",
+		Long: `Writes nodes.csv and relationships.csv for neo4j-admin. Node ids are derived from
+the node type and name, so later exports update the same nodes:
+Usage example:
+	iamsnitch export neo4j-csv -d import
+	neo4j-admin database import full --nodes=import/nodes.csv \
+		--relationships=import/relationships.csv`,
+		RunE: runExportNeo4j,
+	}
+	graphFormat string
+	neo4jDir    string
+)
+
+func init() {
+	exportGraphCmd.Flags().StringVar(&graphFormat, "format", "dot", "graph format (dot, mermaid, graphml, cypher)")
+	exportNeo4jCmd.Flags().StringVarP(&neo4jDir, "dir", "d", ".", "directory the CSV files are written to")
+
+	exportCmd.AddCommand(exportGraphCmd)
+	exportCmd.AddCommand(exportNeo4jCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExportGraph(cmd *cobra.Command, args []string) error {
+	g, err := cachedGraph()
+	if err != nil {
+		return err
+	}
+
+	return export.Write(os.Stdout, graphFormat, g)
+}
+
+func runExportNeo4j(cmd *cobra.Command, args []string) error {
+	g, err := cachedGraph()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(neo4jDir, 0755); err != nil {
+		return err
+	}
+
+	nodes, err := os.Create(filepath.Join(neo4jDir, "nodes.csv"))
+	if err != nil {
+		return err
+	}
+	defer nodes.Close()
+
+	rels, err := os.Create(filepath.Join(neo4jDir, "relationships.csv"))
+	if err != nil {
+		return err
+	}
+	defer rels.Close()
+
+	return export.WriteNeo4jCSV(nodes, rels, g)
+}
+
+func cachedGraph() (*export.Graph, error) {
+	cache, err := newCache()
+	if err != nil {
+		return nil, err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	acl, err := accessService.WhoCan([]string{"*"}, []string{"*"}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return export.NewGraph(acl), nil
+}
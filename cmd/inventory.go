@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/aws"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inventoryCmd = &cobra.Command{
+		Use:   "inventory",
+		Short: "Load a resource inventory into the cache",
+		Long: `Stores the concrete resources of your account so wildcard rules can be expanded:
+Usage example:
+	# export the resources with the tagging API and load them
+	aws resourcegroupstaggingapi get-resources > resources.json
+	iamsnitch inventory -f resources.json
+
+	# or use AWS Config as the source
+	aws configservice select-resource-config \
+		--expression "SELECT arn, resourceType" > resources.json
+	iamsnitch inventory -f resources.json`,
+		RunE: runInventoryCmd,
+	}
+	inventoryFile string
+)
+
+func init() {
+	inventoryCmd.Flags().StringVarP(&inventoryFile, "file", "f", "", "JSON export listing the resources of the account")
+	inventoryCmd.MarkFlagRequired("file")
+
+	rootCmd.AddCommand(inventoryCmd)
+}
+
+func runInventoryCmd(cmd *cobra.Command, args []string) error {
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	return accessService.RefreshInventory(aws.NewInventoryFile(inventoryFile))
+}
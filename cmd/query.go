@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryCmd = &cobra.Command{
+		Use:   "query [expression]",
+		Short: "find out who can do what with a query expression",
+		Long: `Searches the cached rules with an expression combining comparisons with and, or, not and parentheses.
+Fields are action, resource, principal, policy, role, type (managed, inline, resource, scp), effect and condition (its keys).
+Operators are ~ (* as wildcard), = and !=, and "missing" or "present" tell whether the field has a value.
+Usage example:
+	# find out who outside of AWS services can read the prod buckets without any condition
+	iamsnitch query 'action ~ "s3:Get*" and resource ~ "arn:aws:s3:::prod-*" and not principal ~ "Service[*]" and effect = Allow and condition missing'
+
+	# find out what is granted by inline policies or through the Admin role
+	iamsnitch query 'type = inline or role ~ "*:role/Admin"'
+
+	# run a query saved under queries in the config profile
+	iamsnitch query --saved public-buckets
+
+	# print the first 20 rules sorted by resource
+	iamsnitch query 'principal ~ "AWS[*]"' --sort resource --limit 20`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runQuery,
+	}
+	savedQuery string
+	queryOut   string
+	queryPage  model.Page
+)
+
+func init() {
+	queryCmd.Flags().StringVarP(&savedQuery, "saved", "s", "", "name of a query saved in the config profile")
+	queryCmd.Flags().StringVarP(&queryOut, "output", "o", "text", "output format (text, dot, mermaid, graphml, cypher)")
+	addPageFlags(queryCmd, &queryPage)
+
+	rootCmd.AddCommand(queryCmd)
+}
+
+func runQuery(cmd *cobra.Command, args []string) error {
+	if err := defaultOutput(cmd, &queryOut, "text", "dot", "mermaid", "graphml", "cypher"); err != nil {
+		return err
+	}
+
+	expr, err := queryExpression(args)
+	if err != nil {
+		return err
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	if queryOut != "text" {
+		acl := []model.AccessControlRule{}
+		err := accessService.QueryEach(expr, queryPage, func(r model.AccessControlRule) error {
+			acl = append(acl, r)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return export.Write(os.Stdout, queryOut, export.NewGraph(acl))
+	}
+
+	return accessService.QueryEach(expr, queryPage, func(r model.AccessControlRule) error {
+		printRule(&r, nil, false, nil)
+		return nil
+	})
+}
+
+// queryExpression returns the expression given as argument or the saved one,
+// exactly one of which must be given.
+func queryExpression(args []string) (string, error) {
+	if savedQuery == "" {
+		if len(args) == 0 {
+			return "", fmt.Errorf("either an expression or --saved is required")
+		}
+		return args[0], nil
+	}
+	if len(args) > 0 {
+		return "", fmt.Errorf("an expression and --saved can't be used together")
+	}
+
+	p, err := loadProfile()
+	if err != nil {
+		return "", err
+	}
+	expr, ok := p.Queries[savedQuery]
+	if !ok {
+		return "", fmt.Errorf("saved query %v not found", savedQuery)
+	}
+	return expr, nil
+}
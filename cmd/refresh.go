@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"github.com/jeandreh/iam-snitch/iamsnitch"
-	"github.com/jeandreh/iam-snitch/internal/aws"
-	"github.com/jeandreh/iam-snitch/internal/cache"
+	"github.com/jeandreh/iam-snitch/internal/config"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
 	"github.com/spf13/cobra"
 )
 
@@ -11,32 +11,69 @@ var (
 	refreshCmd = &cobra.Command{
 		Use:   "refresh",
 		Short: "Refresh access control list from cloud provider",
-		RunE:  runRefreshCmd,
+		Long: `Fetches the roles and policies of the AWS account into the cache. When the
+profile lists accounts, each of them is refreshed by assuming its role, with up
+to concurrency accounts at a time. With --last-accessed, the services and actions
+each role used according to IAM Access Advisor are recorded as well, which takes
+a job per role:
+Usage example:
+	iamsnitch refresh --profile prod
+
+	# also find out when roles last used their services
+	iamsnitch refresh --last-accessed`,
+		RunE:         runRefreshCmd,
+		SilenceUsage: true,
 	}
+	refreshLastAccessed bool
 )
 
 func init() {
+	refreshCmd.Flags().BoolVar(&refreshLastAccessed, "last-accessed", false, "collect the service last accessed data of each role")
+
 	rootCmd.AddCommand(refreshCmd)
 }
 
 func runRefreshCmd(cmd *cobra.Command, args []string) error {
-	cache, err := cache.New()
+	cache, err := newCache()
 	if err != nil {
 		return err
 	}
 
-	provider, err := aws.NewIAMProvider(nil)
+	return refresh(cache, refreshLastAccessed)
+}
+
+// refresh refreshes the cache from the accounts of the profile, or from the
+// default credentials when it lists none, collecting the Access Advisor data
+// of the roles with lastAccessed.
+func refresh(cache ports.CacheIface, lastAccessed bool) error {
+	p, err := loadProfile()
 	if err != nil {
 		return err
 	}
 
-	accessService := iamsnitch.NewAccessControlService(provider, cache)
-	if err != nil {
-		return err
+	var accounts []iamsnitch.Account
+	add := func(id string, account *config.Account) error {
+		provider, err := newProvider(account)
+		if err != nil {
+			return err
+		}
+		a := iamsnitch.Account{ID: id, Provider: provider}
+		if lastAccessed {
+			a.Usage = provider
+		}
+		accounts = append(accounts, a)
+		return nil
 	}
 
-	if err := accessService.RefreshACL(); err != nil {
-		return err
+	if len(p.Accounts) == 0 {
+		if err := add("", nil); err != nil {
+			return err
+		}
+	}
+	for i := range p.Accounts {
+		if err := add(p.Accounts[i].ID, &p.Accounts[i]); err != nil {
+			return err
+		}
 	}
-	return nil
+	return iamsnitch.Refresh(cache, accounts, p.Concurrency)
 }
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportCmd = &cobra.Command{
+		Use:   "report",
+		Short: "aggregate the cached access control list into reports",
+	}
+	summaryCmd = &cobra.Command{
+		Use:   "summary",
+		Short: "count actions, services and policies per principal",
+		Long: `Ranks principals by the distinct actions and the write and permissions management actions
+granted to them, policies by the principals they grant rules to, and lists the services each
+principal can act on:
+Usage example:
+	# the 10 top entries of each ranking
+	iamsnitch report summary
+
+	# every entry, for a spreadsheet
+	iamsnitch report summary --top 0 -o json`,
+		RunE:         runSummary,
+		SilenceUsage: true,
+	}
+	summaryTop    int
+	summaryOutput string
+
+	riskCmd = &cobra.Command{
+		Use:   "risk",
+		Short: "rank principals by risk score",
+		Long: `Scores each principal from its cached rules: wildcard actions and resources, write and
+permissions management access, privilege escalation paths, cross-account or public reach and
+sensitive access without MFA conditions each add points, up to 100:
+Usage example:
+	# the 20 riskiest principals
+	iamsnitch report risk --top 20
+
+	# the breakdown of every score
+	iamsnitch report risk --top 0 -o json`,
+		RunE:         runRisk,
+		SilenceUsage: true,
+	}
+	riskTop    int
+	riskOutput string
+
+	htmlCmd = &cobra.Command{
+		Use:   "html",
+		Short: "write a self-contained HTML access report",
+		Long: `Writes a single HTML file with a summary dashboard, the rules of each principal and
+the grant chains behind them, audit findings and the rules added or removed since the
+previous report. The report being overwritten is the previous one unless --previous
+points at another:
+Usage example:
+	# refresh the report handed to auditors
+	iamsnitch report html -o report.html
+
+	# compare with last quarter's report
+	iamsnitch report html -o report.html --previous q3/report.html`,
+		RunE:         runHTML,
+		SilenceUsage: true,
+	}
+	htmlFile     string
+	htmlPrevious string
+)
+
+func init() {
+	summaryCmd.Flags().IntVar(&summaryTop, "top", 10, "entries of each ranking to report, 0 for all")
+	summaryCmd.Flags().StringVarP(&summaryOutput, "output", "o", "table", "output format (table, json)")
+
+	riskCmd.Flags().IntVar(&riskTop, "top", 0, "principals to report, 0 for all")
+	riskCmd.Flags().StringVarP(&riskOutput, "output", "o", "table", "output format (table, json)")
+
+	htmlCmd.Flags().StringVarP(&htmlFile, "output", "o", "report.html", "file the report is written to")
+	htmlCmd.Flags().StringVar(&htmlPrevious, "previous", "", "earlier report to diff against, the output file when it exists")
+
+	reportCmd.AddCommand(summaryCmd)
+	reportCmd.AddCommand(riskCmd)
+	reportCmd.AddCommand(htmlCmd)
+	rootCmd.AddCommand(reportCmd)
+}
+
+func runSummary(cmd *cobra.Command, args []string) error {
+	if err := defaultOutput(cmd, &summaryOutput, "table", "json"); err != nil {
+		return err
+	}
+	if summaryTop < 0 {
+		return fmt.Errorf("--top can't be negative")
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	summary, err := iamsnitch.NewAccessControlService(nil, cache).Summary(summaryTop)
+	if err != nil {
+		return err
+	}
+
+	switch summaryOutput {
+	case "json":
+		return report.WriteSummaryJSON(os.Stdout, summary)
+	case "table":
+		return report.WriteSummaryTable(os.Stdout, summary)
+	}
+	return fmt.Errorf("unknown output format %v", summaryOutput)
+}
+
+func runRisk(cmd *cobra.Command, args []string) error {
+	if err := defaultOutput(cmd, &riskOutput, "table", "json"); err != nil {
+		return err
+	}
+	if riskTop < 0 {
+		return fmt.Errorf("--top can't be negative")
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	scores, err := iamsnitch.NewAccessControlService(nil, cache).RiskScores(nil, false)
+	if err != nil {
+		return err
+	}
+	if riskTop > 0 && len(scores) > riskTop {
+		scores = scores[:riskTop]
+	}
+
+	switch riskOutput {
+	case "json":
+		return report.WriteRiskJSON(os.Stdout, scores)
+	case "table":
+		return report.WriteRiskTable(os.Stdout, scores)
+	}
+	return fmt.Errorf("unknown output format %v", riskOutput)
+}
+
+func runHTML(cmd *cobra.Command, args []string) error {
+	p, err := loadProfile()
+	if err != nil {
+		return err
+	}
+
+	previous, err := readPreviousReport(htmlPrevious, htmlFile)
+	if err != nil {
+		return err
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	r := &report.HTMLReport{GeneratedAt: time.Now(), Previous: previous}
+	if r.Summary, err = accessService.Summary(10); err != nil {
+		return err
+	}
+	if r.Risks, err = accessService.RiskScores(nil, false); err != nil {
+		return err
+	}
+	if r.Rules, err = accessService.WhoCan([]string{"*"}, []string{"*"}, false); err != nil {
+		return err
+	}
+
+	unused := 90
+	if p.Audit.UnusedDays != nil {
+		unused = *p.Audit.UnusedDays
+	}
+	r.Findings, err = accessService.Audit(&iamsnitch.AuditConfig{
+		KnownAccounts: p.Audit.KnownAccounts,
+		UnusedAfter:   time.Duration(unused) * 24 * time.Hour,
+		Now:           r.GeneratedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(htmlFile)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteHTML(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readPreviousReport loads the snapshot of the previous report: path when
+// given, otherwise output if a report was already written there.
+func readPreviousReport(path string, output string) (*report.Snapshot, error) {
+	explicit := path != ""
+	if !explicit {
+		path = output
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := report.ReadSnapshot(f)
+	if err != nil && !explicit {
+		// not a report of ours, it's overwritten all the same
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return s, nil
+}
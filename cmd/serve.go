@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "serve the access control list over a JSON HTTP API",
+		Long: `Exposes whocan, whatcan and cache refreshes over HTTP. A refresh covers the
+accounts of the profile like iamsnitch refresh. The API is described at
+/openapi.json:
+Usage example:
+	iamsnitch serve --addr :8080
+	curl 'localhost:8080/v1/whocan?permission=s3:Put*&resource=*'
+	curl -X POST localhost:8080/v1/refresh`,
+		RunE: runServe,
+	}
+	addr              string
+	serveLastAccessed bool
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&addr, "addr", ":8080", "address to listen on")
+	serveCmd.Flags().BoolVar(&serveLastAccessed, "last-accessed", false, "collect the service last accessed data of each role on refresh")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return server.New(accessService, func() error {
+		return refresh(cache, serveLastAccessed)
+	}).ListenAndServe(ctx, addr)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/shell"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	shellCmd = &cobra.Command{
+		Use:   "shell",
+		Short: "explore the cached access control list interactively",
+		Long: `Starts a session where whocan and whatcan queries can be run one after the other.
+Actions, principals and resources are completed with tab, results are paged and
+each result can be explained or drilled into:
+Usage example:
+	iamsnitch shell
+	iamsnitch> whocan s3:GetObject arn:aws:s3:::my-bucket/*
+	iamsnitch> explain 1
+	iamsnitch> drill 1 2`,
+		RunE: runShell,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+}
+
+func runShell(cmd *cobra.Command, args []string) error {
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return shell.New(accessService, os.Stdout).Run(&lineScanner{bufio.NewScanner(os.Stdin)})
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "iamsnitch> ")
+
+	s := shell.New(accessService, t)
+	t.AutoCompleteCallback = s.Complete
+	return s.Run(t)
+}
+
+type lineScanner struct {
+	*bufio.Scanner
+}
+
+func (l *lineScanner) ReadLine() (string, error) {
+	if !l.Scan() {
+		if err := l.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return strings.TrimSpace(l.Text()), nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/aws"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/spf13/cobra"
+)
+
+var (
+	suggestPolicyCmd = &cobra.Command{
+		Use:   "suggest-policy <principal>",
+		Short: "suggest a least privilege policy from the recorded usage",
+		Long: `Writes the IAM policy allowing only the actions and resources the principal was seen
+using in the loaded CloudTrail logs, followed by a diff against the access its current
+policies allow. Resources sharing a parent and actions sharing a verb are collapsed into
+wildcards, as long as those don't allow more than the current policies:
+Usage example:
+	# review what the Dev role would lose
+	iamsnitch cloudtrail ./AWSLogs
+	iamsnitch suggest-policy --since 90d "AWS[arn:aws:iam::111122223333:role/Dev]"
+
+	# create the suggested policy
+	iamsnitch suggest-policy -o policy "AWS[arn:aws:iam::111122223333:role/Dev]" > policy.json
+	aws iam create-policy --policy-name DevLeastPrivilege --policy-document file://policy.json`,
+		Args:         cobra.ExactArgs(1),
+		RunE:         runSuggestPolicy,
+		SilenceUsage: true,
+	}
+	suggestExact  bool
+	suggestSince  string
+	suggestOutput string
+)
+
+func init() {
+	suggestPolicyCmd.Flags().BoolVarP(&suggestExact, "exact", "e", false, "whether to use an exact match or interpret * as wildcard")
+	suggestPolicyCmd.Flags().StringVar(&suggestSince, "since", "90d", "window of usage the policy must allow, e.g. 90d or 12h")
+	suggestPolicyCmd.Flags().StringVarP(&suggestOutput, "output", "o", "text", "output format (text, policy)")
+
+	rootCmd.AddCommand(suggestPolicyCmd)
+}
+
+func runSuggestPolicy(cmd *cobra.Command, args []string) error {
+	if err := defaultOutput(cmd, &suggestOutput, "text", "policy"); err != nil {
+		return err
+	}
+	if suggestOutput != "text" && suggestOutput != "policy" {
+		return fmt.Errorf("unknown output format %v", suggestOutput)
+	}
+	window, err := parseWindow(suggestSince)
+	if err != nil {
+		return err
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	suggestion, err := iamsnitch.NewAccessControlService(nil, cache).SuggestPolicy(args[0], suggestExact, time.Now().Add(-window))
+	if err != nil {
+		return err
+	}
+	if len(suggestion.Statements) == 0 {
+		fmt.Fprintf(os.Stderr, "no usage of %v recorded in the last %v, load CloudTrail logs with iamsnitch cloudtrail\n", args[0], suggestSince)
+	}
+
+	policy, err := json.MarshalIndent(aws.NewSuggestedPolicy(suggestion), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(policy))
+
+	if suggestOutput == "text" {
+		fmt.Println()
+		printAccessDiff(suggestion.Diff)
+	}
+	return nil
+}
+
+func printAccessDiff(diff []model.AccessChange) {
+	var removed, added int
+	for _, c := range diff {
+		line := fmt.Sprintf("%v %v on %v", c.Op, c.Access.Action, c.Access.Resource)
+		if c.Access.Condition != "" {
+			line += fmt.Sprintf(" when %v", c.Access.Condition)
+		}
+		if c.Policy != "" {
+			line += fmt.Sprintf(" (%v)", c.Policy)
+		}
+		fmt.Println(line)
+
+		switch c.Op {
+		case model.AccessRemoved:
+			removed++
+		case model.AccessAdded:
+			added++
+		}
+	}
+	fmt.Printf("%v grants removed, %v added\n", removed, added)
+}
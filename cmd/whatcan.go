@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/export"
+	"github.com/jeandreh/iam-snitch/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	whatCanCmd = &cobra.Command{
+		Use:   "whatcan <principal>...",
+		Short: "find out what a principal can do",
+		Long: `Lists the rules granted to the principals, followed by their risk score:
+Usage example:
+	# everything the Dev role can do, and how risky that is
+	iamsnitch whatcan "AWS[arn:aws:iam::111122223333:role/Dev]"
+
+	# only the rules granted to that exact principal, not to AWS[*] and the like
+	iamsnitch whatcan -e "AWS[arn:aws:iam::111122223333:role/Dev]"
+
+	# the rules not exercised in the CloudTrail logs of the last 90 days
+	iamsnitch whatcan --unused 90d "AWS[arn:aws:iam::111122223333:role/Dev]"
+
+	# tell when each rule, and the role it acts as, were last used
+	iamsnitch whatcan --last-used "AWS[arn:aws:iam::111122223333:role/Dev]"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runWhatCan,
+	}
+	whatCanExact bool
+	whatCanOut   string
+	whatCanPage  model.Page
+	whatCanUsed  bool
+	unusedWindow string
+)
+
+func init() {
+	whatCanCmd.Flags().BoolVarP(&whatCanExact, "exact", "e", false, "whether to use an exact match or interpret * as wildcard")
+	whatCanCmd.Flags().StringVarP(&whatCanOut, "output", "o", "text", "output format (text, dot, mermaid, graphml, cypher)")
+	whatCanCmd.Flags().BoolVar(&whatCanUsed, "last-used", false, "tell when each rule and the role it acts as were last used, from the loaded usage")
+	whatCanCmd.Flags().StringVar(&unusedWindow, "unused", "", "only list the rules not exercised within this window of the loaded CloudTrail logs, e.g. 90d or 12h")
+	addPageFlags(whatCanCmd, &whatCanPage)
+
+	rootCmd.AddCommand(whatCanCmd)
+}
+
+func runWhatCan(cmd *cobra.Command, args []string) error {
+	if err := defaultOutput(cmd, &whatCanOut, "text", "dot", "mermaid", "graphml", "cypher"); err != nil {
+		return err
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	each := func(fn func(model.AccessControlRule) error) error {
+		return accessService.WhatCanEach(args, whatCanExact, whatCanPage, fn)
+	}
+	if unusedWindow != "" {
+		window, err := parseWindow(unusedWindow)
+		if err != nil {
+			return err
+		}
+		since := time.Now().Add(-window)
+		each = func(fn func(model.AccessControlRule) error) error {
+			return accessService.WhatCanUnusedEach(args, whatCanExact, since, whatCanPage, fn)
+		}
+	}
+
+	if whatCanOut != "text" {
+		acl := []model.AccessControlRule{}
+		err := each(func(r model.AccessControlRule) error {
+			acl = append(acl, r)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return export.Write(os.Stdout, whatCanOut, export.NewGraph(acl))
+	}
+
+	lastUsed, err := loadLastUsed(accessService, whatCanUsed)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = each(func(r model.AccessControlRule) error {
+		printRule(&r, nil, false, lastUsed)
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the score is about everything the principals can do, not what's unused
+	if unusedWindow != "" {
+		fmt.Printf("%v rules unused in the last %v\n", count, unusedWindow)
+		return nil
+	}
+
+	scores, err := accessService.RiskScores(args, whatCanExact)
+	if err != nil {
+		return err
+	}
+	for _, s := range scores {
+		if err := report.WriteRiskBreakdown(os.Stdout, &s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseWindow reads a duration such as 90d, on top of the units of
+// time.ParseDuration.
+func parseWindow(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid window %v", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid window %v", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/aws"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/spf13/cobra"
+)
+
+var (
+	whatIfCmd = &cobra.Command{
+		Use:   "whatif <role-arn>",
+		Short: "preview the access a change to a role's policies gains or loses",
+		Long: `Rebuilds the rules of a role from the cached snapshot as if the given policies were
+attached, detached or its trust policy replaced, and prints the access gained (+) and
+lost (-). Access reaching the role through other roles assuming it isn't compared. AWS
+isn't contacted, run iamsnitch refresh first:
+Usage example:
+	# review a policy before attaching it
+	iamsnitch whatif --attach policy.json arn:aws:iam::111122223333:role/Dev
+
+	# swap a managed policy for a narrower one
+	iamsnitch whatif --detach arn:aws:iam::aws:policy/AmazonS3FullAccess \
+		--attach s3-readonly.json arn:aws:iam::111122223333:role/Dev
+
+	# find out who could act as the role with a new trust policy
+	iamsnitch whatif --trust trust.json arn:aws:iam::111122223333:role/Dev`,
+		Args:         cobra.ExactArgs(1),
+		RunE:         runWhatIf,
+		SilenceUsage: true,
+	}
+	whatIfAttach []string
+	whatIfDetach []string
+	whatIfTrust  string
+)
+
+func init() {
+	whatIfCmd.Flags().StringSliceVar(&whatIfAttach, "attach", []string{}, "policy documents to attach")
+	whatIfCmd.Flags().StringSliceVar(&whatIfDetach, "detach", []string{}, "ARNs of the attached policies to detach")
+	whatIfCmd.Flags().StringVar(&whatIfTrust, "trust", "", "trust policy document replacing the current one")
+
+	rootCmd.AddCommand(whatIfCmd)
+}
+
+func runWhatIf(cmd *cobra.Command, args []string) error {
+	if len(whatIfAttach) == 0 && len(whatIfDetach) == 0 && whatIfTrust == "" {
+		return fmt.Errorf("nothing to change, use --attach, --detach or --trust")
+	}
+
+	overlay := &aws.Overlay{Detach: whatIfDetach}
+	for _, path := range whatIfAttach {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// the file stands in for the ARN of the policy in the grant chain
+		policy, err := aws.NewIdentityPolicy(path, filepath.Base(path), string(data))
+		if err != nil {
+			return fmt.Errorf("unable to parse %v: %w", path, err)
+		}
+		overlay.Attach = append(overlay.Attach, *policy)
+	}
+	if whatIfTrust != "" {
+		data, err := ioutil.ReadFile(whatIfTrust)
+		if err != nil {
+			return err
+		}
+		trust, err := aws.NewAssumePolicy(string(data))
+		if err != nil {
+			return fmt.Errorf("unable to parse %v: %w", whatIfTrust, err)
+		}
+		overlay.Trust = trust
+	}
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	changes, err := iamsnitch.NewAccessControlService(nil, cache).WhatIf(args[0], overlay)
+	if err != nil {
+		return err
+	}
+	printRuleChanges(changes)
+	return nil
+}
+
+func printRuleChanges(changes []model.RuleChange) {
+	var removed, added int
+	for _, c := range changes {
+		r := c.Rule
+		line := fmt.Sprintf("%v %v %v %v on %v", c.Op, r.Principal.ID, r.Effect, r.Permission.ID, r.Resource.ID)
+		if c.Policy != "" {
+			line += fmt.Sprintf(" (%v)", c.Policy)
+		}
+		fmt.Println(line)
+
+		switch c.Op {
+		case model.AccessRemoved:
+			removed++
+		case model.AccessAdded:
+			added++
+		}
+	}
+	fmt.Printf("%v rules removed, %v added\n", removed, added)
+}
@@ -2,11 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/jeandreh/iam-snitch/iamsnitch"
-	"github.com/jeandreh/iam-snitch/internal/aws"
-	"github.com/jeandreh/iam-snitch/internal/cache"
 	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/export"
 	"github.com/spf13/cobra"
 )
 
@@ -22,18 +22,48 @@ Usage example:
 
 	# find out which principals are allowed to perform "s3:*" on every S3 bucket
 	# (ignores wildcard *, returning only entries containing "s3:*" and "*")
-	iamsnitch whocan -e -p "s3:*" "*"`,
+	iamsnitch whocan -e -p "s3:*" "*"
+
+	# list the buckets matched by each rule (requires 'iamsnitch inventory')
+	iamsnitch whocan -p "s3:GetObject" -r "arn:aws:s3:::*" --expand-resources
+
+	# render the grant chains as a Mermaid flowchart (also dot and graphml)
+	iamsnitch whocan -p "s3:*" -r "*" -o mermaid
+
+	# find out everything granted by AdministratorAccess before editing it
+	iamsnitch whocan -p "*" -r "*" --via-policy "arn:aws:iam::aws:policy/AdministratorAccess"
+
+	# or only through managed policies, the only type fetched so far
+	iamsnitch whocan -p "*" -r "*" --via-type managed
+
+	# page through the rules sorted by principal (also permission and resource)
+	iamsnitch whocan -p "*" -r "*" --sort principal --limit 50 --offset 100
+
+	# tell when each rule, and the role it acts as, were last used
+	iamsnitch whocan -p "s3:*" -r "*" --last-used`,
 		RunE: runWhoCan,
 	}
 	permissions []string
 	resources   []string
 	exact       bool
+	expand      bool
+	whoCanUsed  bool
+	whoCanOut   string
+	via         model.Via
+	page        model.Page
 )
 
 func init() {
 	whoCanCmd.Flags().BoolVarP(&exact, "exact", "e", false, "whether to use an exact match or interpret * as wildcard")
 	whoCanCmd.Flags().StringSliceVarP(&permissions, "permissions", "p", []string{}, "actions of interest")
 	whoCanCmd.Flags().StringSliceVarP(&resources, "resources", "r", []string{}, "resource of interest")
+	whoCanCmd.Flags().BoolVar(&expand, "expand-resources", false, "list the inventoried resources matched by each rule")
+	whoCanCmd.Flags().BoolVar(&whoCanUsed, "last-used", false, "tell when each rule and the role it acts as were last used, from the loaded usage")
+	whoCanCmd.Flags().StringVarP(&whoCanOut, "output", "o", "text", "output format (text, dot, mermaid, graphml, cypher)")
+	whoCanCmd.Flags().StringSliceVar(&via.Policies, "via-policy", []string{}, "policies the grant chain goes through")
+	whoCanCmd.Flags().StringSliceVar(&via.Roles, "via-role", []string{}, "roles the grant chain goes through")
+	whoCanCmd.Flags().StringSliceVar(&via.Types, "via-type", []string{}, "types of the policy granting the rule (managed, the only type fetched so far)")
+	addPageFlags(whoCanCmd, &page)
 	whoCanCmd.MarkFlagRequired("permissions")
 	whoCanCmd.MarkFlagRequired("resources")
 
@@ -41,41 +71,94 @@ func init() {
 }
 
 func runWhoCan(cmd *cobra.Command, args []string) error {
-	cache, err := cache.New()
-	if err != nil {
+	if err := defaultOutput(cmd, &whoCanOut, "text", "dot", "mermaid", "graphml", "cypher"); err != nil {
 		return err
 	}
 
-	provider, err := aws.NewIAMProvider(nil)
+	cache, err := newCache()
 	if err != nil {
 		return err
 	}
 
-	accessService := iamsnitch.NewAccessControlService(provider, cache)
-	if err != nil {
-		return err
+	accessService := iamsnitch.NewAccessControlService(nil, cache)
+
+	// graphs need every rule, the text output is printed as rules are read
+	if whoCanOut != "text" {
+		acl := []model.AccessControlRule{}
+		err := accessService.WhoCanEach(permissions, resources, via, exact, page, func(r model.AccessControlRule) error {
+			acl = append(acl, r)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return export.Write(os.Stdout, whoCanOut, export.NewGraph(acl))
 	}
 
-	acl, err := accessService.WhoCan(permissions, resources, exact)
+	lastUsed, err := loadLastUsed(accessService, whoCanUsed)
 	if err != nil {
 		return err
 	}
-	printOutput(acl)
-	return nil
+
+	return accessService.WhoCanEach(permissions, resources, via, exact, page, func(r model.AccessControlRule) error {
+		var expanded []model.Resource
+		if expand {
+			er, err := accessService.ExpandResources(&r, resources, exact)
+			if err != nil {
+				return err
+			}
+			expanded = er
+		}
+		printRule(&r, expanded, expand, lastUsed)
+		return nil
+	})
+}
+
+// addPageFlags adds the flags selecting the page of rules to print.
+func addPageFlags(cmd *cobra.Command, page *model.Page) {
+	cmd.Flags().StringVar(&page.Sort, "sort", "", "sort the rules by principal, permission or resource")
+	cmd.Flags().IntVar(&page.Limit, "limit", 0, "maximum number of rules, 0 for no limit")
+	cmd.Flags().IntVar(&page.Offset, "offset", 0, "number of rules to skip")
+}
+
+// loadLastUsed loads the usage and roles printRule needs when show is set by
+// --last-used, nil otherwise.
+func loadLastUsed(accessService *iamsnitch.AccessControlService, show bool) (*iamsnitch.LastUsed, error) {
+	if !show {
+		return nil, nil
+	}
+	return accessService.LastUsed()
 }
 
-func printOutput(acl []model.AccessControlRule) {
-	for _, r := range acl {
-		fmt.Printf("principal: %s\n", r.Principal.ID)
-		fmt.Printf("permission: %s\n", r.Permission.ID)
-		fmt.Printf("resource: %s\n", r.Resource.ID)
-		fmt.Println("via: ")
-
-		tabs := " "
-		for _, g := range r.GrantChain {
-			fmt.Printf("%v|-> %v\n", tabs, g)
-			tabs += " "
+// printRule prints a rule along with when it was last used, when lastUsed is
+// given and knows.
+func printRule(r *model.AccessControlRule, expanded []model.Resource, expand bool, lastUsed *iamsnitch.LastUsed) {
+	fmt.Printf("principal: %s\n", r.Principal.ID)
+	fmt.Printf("permission: %s\n", r.Permission.ID)
+	fmt.Printf("resource: %s\n", r.Resource.ID)
+	if lastUsed != nil {
+		if t := lastUsed.Rule(r); t != nil {
+			fmt.Printf("last used: %v\n", t.Format("2006-01-02"))
 		}
-		fmt.Println("")
+		if t := lastUsed.Role(r); t != nil {
+			fmt.Printf("role last used: %v\n", t.Format("2006-01-02"))
+		}
+	}
+	if expand {
+		fmt.Println("expands to: ")
+		for _, er := range expanded {
+			fmt.Printf(" - %v\n", er.ID)
+		}
+	}
+	fmt.Println("via: ")
+	printGrantChain(r.GrantChain)
+	fmt.Println("")
+}
+
+func printGrantChain(chain []model.GrantIface) {
+	tabs := " "
+	for _, g := range chain {
+		fmt.Printf("%v|-> %v\n", tabs, g)
+		tabs += " "
 	}
 }
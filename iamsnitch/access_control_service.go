@@ -1,10 +1,20 @@
 package iamsnitch
 
 import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/jeandreh/iam-snitch/internal/domain/model"
 	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/jeandreh/iam-snitch/internal/query"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
 )
 
+// errPageFull stops streaming rules once a page is complete.
+var errPageFull = errors.New("page full")
+
 type AccessControlService struct {
 	provider ports.IAMProviderIface
 	cache    ports.CacheIface
@@ -17,10 +27,15 @@ func NewAccessControlService(provider ports.IAMProviderIface, cache ports.CacheI
 	}
 }
 
+// RefreshACL saves the rules of the provider, then deletes the cached rules
+// of the accounts it returned rules for that it didn't return again, such as
+// the ones of deleted roles or detached policies.
 func (a *AccessControlService) RefreshACL() (err error) {
 	var nextPage ports.PageIface
 	var rules []model.AccessControlRule
 
+	start := time.Now()
+	scope := make(map[string]bool)
 	for ok := true; ok; ok = nextPage.HasNext() {
 		rules, nextPage, err = a.provider.FetchACL(nextPage)
 		if err != nil {
@@ -30,15 +45,234 @@ func (a *AccessControlService) RefreshACL() (err error) {
 		if err = a.cache.SaveACL(rules); err != nil {
 			return err
 		}
+		for _, r := range rules {
+			if rg, ok := r.GrantChain[0].(model.RoleGrant); ok {
+				if roles := accountRoles(rg.ID); roles != "" {
+					scope[roles] = true
+				}
+			}
+		}
+	}
+
+	if len(scope) == 0 {
+		return nil
+	}
+	via := &model.Via{Roles: make([]string, 0, len(scope))}
+	for roles := range scope {
+		via.Roles = append(via.Roles, roles)
+	}
+	sort.Strings(via.Roles)
+	return a.cache.PruneACL(via, start)
+}
+
+// accountRoles is the pattern of every role of the account of the role ARN,
+// empty when it isn't one.
+func accountRoles(arn string) string {
+	i := strings.Index(arn, ":role/")
+	if i < 0 {
+		return ""
+	}
+	return arn[:i] + ":role/*"
+}
+
+// RefreshRoles saves the roles of the provider, then deletes the cached roles
+// of the accounts it returned roles for that it didn't return again.
+func (a *AccessControlService) RefreshRoles() (err error) {
+	var nextPage ports.PageIface
+	var roles []model.Role
+
+	start := time.Now()
+	scope := make(map[string]bool)
+	for ok := true; ok; ok = nextPage.HasNext() {
+		roles, nextPage, err = a.provider.FetchRoles(nextPage)
+		if err != nil {
+			return err
+		}
+
+		if err = a.cache.SaveRoles(roles); err != nil {
+			return err
+		}
+		for _, r := range roles {
+			if pattern := accountRoles(r.ARN); pattern != "" {
+				scope[pattern] = true
+			}
+		}
+	}
+
+	if len(scope) == 0 {
+		return nil
+	}
+	patterns := make([]string, 0, len(scope))
+	for pattern := range scope {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return a.cache.PruneRoles(patterns, start)
+}
+
+func (a *AccessControlService) RefreshPolicies() (err error) {
+	var nextPage ports.PageIface
+	var policies []model.Policy
+
+	for ok := true; ok; ok = nextPage.HasNext() {
+		policies, nextPage, err = a.provider.FetchPolicies(nextPage)
+		if err != nil {
+			return err
+		}
+
+		if err = a.cache.SavePolicies(policies); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 func (a *AccessControlService) WhoCan(permissions []string, resources []string, exact bool) ([]model.AccessControlRule, error) {
+	return a.WhoCanVia(permissions, resources, model.Via{}, exact)
+}
+
+// WhoCanVia is WhoCan restricted to the rules granted through via, e.g. to
+// assess the blast radius of a policy before editing it.
+func (a *AccessControlService) WhoCanVia(permissions []string, resources []string, via model.Via, exact bool) ([]model.AccessControlRule, error) {
+	if err := via.Validate(); err != nil {
+		return nil, err
+	}
 	return a.cache.Find(&model.Filter{
 		Permissions: permissions,
 		Resources:   resources,
+		Via:         via,
+		ExactMatch:  exact,
+	})
+}
+
+// WhoCanEach streams the page of the WhoCanVia rules to fn.
+func (a *AccessControlService) WhoCanEach(permissions []string, resources []string, via model.Via, exact bool, page model.Page, fn func(model.AccessControlRule) error) error {
+	if err := via.Validate(); err != nil {
+		return err
+	}
+	return a.cache.FindEach(&model.Filter{
+		Permissions: permissions,
+		Resources:   resources,
+		Via:         via,
 		ExactMatch:  exact,
+		Page:        page,
+	}, fn)
+}
+
+func (a *AccessControlService) WhatCan(principals []string, exact bool) ([]model.AccessControlRule, error) {
+	return a.cache.Find(&model.Filter{
+		Principals: principals,
+		ExactMatch: exact,
+	})
+}
+
+// WhatCanEach streams the page of the WhatCan rules to fn.
+func (a *AccessControlService) WhatCanEach(principals []string, exact bool, page model.Page, fn func(model.AccessControlRule) error) error {
+	return a.cache.FindEach(&model.Filter{
+		Principals: principals,
+		ExactMatch: exact,
+		Page:       page,
+	}, fn)
+}
+
+// Query returns the rules matching the query expression.
+func (a *AccessControlService) Query(expr string) ([]model.AccessControlRule, error) {
+	acl := make([]model.AccessControlRule, 0)
+	err := a.QueryEach(expr, model.Page{}, func(r model.AccessControlRule) error {
+		acl = append(acl, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// QueryEach streams the page of the rules matching the query expression to
+// fn. The cache narrows them down and sorts them, then the whole expression
+// is evaluated on each, so the offset and limit are applied here.
+func (a *AccessControlService) QueryEach(expr string, page model.Page, fn func(model.AccessControlRule) error) error {
+	q, err := query.Parse(expr)
+	if err != nil {
+		return err
+	}
+	if err := page.Validate(); err != nil {
+		return err
+	}
+
+	// the expression decides on the effect
+	filter := q.Filter()
+	filter.IncludeDeny = true
+	filter.Sort = page.Sort
+	filter.After = page.After
+
+	return a.findPage(filter, page, q.Match, fn)
+}
+
+// findPage streams the rules found with filter that keep accepts to fn,
+// skipping the first page.Offset of them and stopping after page.Limit. The
+// filter is expected to carry the sort and cursor of the page.
+func (a *AccessControlService) findPage(filter *model.Filter, page model.Page, keep func(*model.AccessControlRule) bool, fn func(model.AccessControlRule) error) error {
+	skipped, matched := 0, 0
+	err := a.cache.FindEach(filter, func(r model.AccessControlRule) error {
+		if !keep(&r) {
+			return nil
+		}
+		if skipped < page.Offset {
+			skipped++
+			return nil
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+		if matched++; matched == page.Limit {
+			return errPageFull
+		}
+		return nil
 	})
+	if err == errPageFull {
+		return nil
+	}
+	return err
+}
+
+func (a *AccessControlService) RefreshInventory(inventory ports.InventoryProviderIface) (err error) {
+	var nextPage ports.PageIface
+	var resources []model.Resource
+
+	for ok := true; ok; ok = nextPage.HasNext() {
+		resources, nextPage, err = inventory.FetchResources(nextPage)
+		if err != nil {
+			return err
+		}
+
+		if err = a.cache.SaveResources(resources); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExpandResources lists the inventoried resources covered by the rule that
+// also satisfy at least one of the resources of interest.
+func (a *AccessControlService) ExpandResources(rule *model.AccessControlRule, resources []string, exact bool) ([]model.Resource, error) {
+	candidates, err := a.cache.FindResources(&model.Filter{
+		Resources: []string{rule.Resource.ID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := make([]model.Resource, 0, len(candidates))
+	for _, c := range candidates {
+		for _, r := range resources {
+			if (exact && c.ID == r) || (!exact && wildcard.Match(c.ID, r)) {
+				expanded = append(expanded, c)
+				break
+			}
+		}
+	}
+	return expanded, nil
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
 	"github.com/jeandreh/iam-snitch/internal/domain/model"
 	"github.com/jeandreh/iam-snitch/internal/mocks"
 	"github.com/stretchr/testify/require"
@@ -93,6 +94,189 @@ func TestRefreshACL(t *testing.T) {
 	}
 }
 
+func TestRefreshACLPrunes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rule := func(role string, permission string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: "AWS[*]"},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: "*"},
+			GrantChain: []model.GrantIface{model.NewRoleGrant(role)},
+		}
+	}
+	detached := rule("arn:aws:iam::111122223333:role/App", "s3:PutObject")
+	deleted := rule("arn:aws:iam::111122223333:role/Old", "s3:GetObject")
+	kept := rule("arn:aws:iam::111122223333:role/App", "s3:GetObject")
+	otherAccount := rule("arn:aws:iam::444455556666:role/App", "s3:PutObject")
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{detached, deleted, kept, otherAccount}))
+
+	iamMock := mocks.NewIAMProviderMock(ctrl)
+	pageMock := mocks.NewPageMock(ctrl)
+	iamMock.EXPECT().FetchACL(nil).Return([]model.AccessControlRule{kept}, pageMock, nil).Times(1)
+	pageMock.EXPECT().HasNext().Return(false).Times(1)
+
+	require.Nil(t, NewAccessControlService(iamMock, cache).RefreshACL())
+
+	acl, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{kept, otherAccount}, acl)
+}
+
+func TestRefreshRoles(t *testing.T) {
+	tests := []struct {
+		name         string
+		want         []model.Role
+		wantErrFetch error
+		wantErr      error
+	}{
+		{
+			"success",
+			[]model.Role{{ARN: "arn:aws:iam::111122223333:role/TestRole"}},
+			nil,
+			nil,
+		},
+		{
+			"error fetch",
+			nil,
+			fmt.Errorf("fetch error"),
+			fmt.Errorf("fetch error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			iamMock := mocks.NewIAMProviderMock(ctrl)
+			cacheMock := mocks.NewCacheMock(ctrl)
+
+			a := &AccessControlService{
+				provider: iamMock,
+				cache:    cacheMock,
+			}
+
+			pageMock := mocks.NewPageMock(ctrl)
+
+			iamMock.
+				EXPECT().
+				FetchRoles(nil).
+				Return(tt.want, pageMock, tt.wantErrFetch).
+				Times(1)
+
+			if tt.wantErrFetch == nil {
+				cacheMock.
+					EXPECT().
+					SaveRoles(gomock.Eq(tt.want)).
+					Return(nil).
+					Times(1)
+
+				pageMock.
+					EXPECT().
+					HasNext().
+					Return(false).
+					Times(1)
+
+				cacheMock.
+					EXPECT().
+					PruneRoles(gomock.Eq([]string{"arn:aws:iam::111122223333:role/*"}), gomock.Any()).
+					Return(nil).
+					Times(1)
+			}
+
+			require.Equal(t, tt.wantErr, a.RefreshRoles())
+		})
+	}
+}
+
+func TestRefreshRolesPrunes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kept := model.Role{ARN: "arn:aws:iam::111122223333:role/App", Name: "App"}
+	deleted := model.Role{ARN: "arn:aws:iam::111122223333:role/Old", Name: "Old"}
+	otherAccount := model.Role{ARN: "arn:aws:iam::444455556666:role/App", Name: "App"}
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveRoles([]model.Role{kept, deleted, otherAccount}))
+
+	iamMock := mocks.NewIAMProviderMock(ctrl)
+	pageMock := mocks.NewPageMock(ctrl)
+	iamMock.EXPECT().FetchRoles(nil).Return([]model.Role{kept}, pageMock, nil).Times(1)
+	pageMock.EXPECT().HasNext().Return(false).Times(1)
+
+	require.Nil(t, NewAccessControlService(iamMock, cache).RefreshRoles())
+
+	roles, err := cache.FindRoles()
+	require.Nil(t, err)
+	require.Equal(t, []model.Role{kept, otherAccount}, roles)
+}
+
+func TestRefreshPolicies(t *testing.T) {
+	tests := []struct {
+		name         string
+		want         []model.Policy
+		wantErrFetch error
+		wantErr      error
+	}{
+		{
+			"success",
+			[]model.Policy{{ARN: "arn:aws:iam::111122223333:policy/TestPolicy", Version: "v1"}},
+			nil,
+			nil,
+		},
+		{
+			"error fetch",
+			nil,
+			fmt.Errorf("fetch error"),
+			fmt.Errorf("fetch error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			iamMock := mocks.NewIAMProviderMock(ctrl)
+			cacheMock := mocks.NewCacheMock(ctrl)
+
+			a := &AccessControlService{
+				provider: iamMock,
+				cache:    cacheMock,
+			}
+
+			pageMock := mocks.NewPageMock(ctrl)
+
+			iamMock.
+				EXPECT().
+				FetchPolicies(nil).
+				Return(tt.want, pageMock, tt.wantErrFetch).
+				Times(1)
+
+			if tt.wantErrFetch == nil {
+				cacheMock.
+					EXPECT().
+					SavePolicies(gomock.Eq(tt.want)).
+					Return(nil).
+					Times(1)
+
+				pageMock.
+					EXPECT().
+					HasNext().
+					Return(false).
+					Times(1)
+			}
+
+			require.Equal(t, tt.wantErr, a.RefreshPolicies())
+		})
+	}
+}
+
 func TestWhoCan(t *testing.T) {
 	type args struct {
 		actions   []string
@@ -179,3 +363,185 @@ func TestWhoCan(t *testing.T) {
 		})
 	}
 }
+
+func TestWhoCanViaTypes(t *testing.T) {
+	cache := memory.New()
+	a := NewAccessControlService(nil, cache)
+
+	_, err := a.WhoCanVia([]string{"*"}, []string{"*"}, model.Via{Types: []string{model.ManagedPolicy}}, false)
+	require.Nil(t, err)
+
+	// the cache only holds rules of managed policies
+	_, err = a.WhoCanVia([]string{"*"}, []string{"*"}, model.Via{Types: []string{model.InlinePolicy}}, false)
+	require.EqualError(t, err, "inline policies aren't fetched, no rule is granted by one")
+
+	err = a.WhoCanEach([]string{"*"}, []string{"*"}, model.Via{Types: []string{"bogus"}}, false, model.Page{}, func(model.AccessControlRule) error {
+		return nil
+	})
+	require.EqualError(t, err, `unknown grant type "bogus"`)
+}
+
+func TestWhoCanIgnoresDeny(t *testing.T) {
+	read := escalationRule("AWS[arn:aws:iam::111122223333:role/Dev]", "arn:aws:iam::111122223333:role/DevRole", "s3:GetObject", "*")
+	deny := escalationRule("AWS[arn:aws:iam::111122223333:role/Ops]", "arn:aws:iam::111122223333:role/OpsRole", "*", "*")
+	deny.Effect = "Deny"
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{read, deny}))
+	a := NewAccessControlService(nil, cache)
+
+	acl, err := a.WhoCan([]string{"s3:GetObject"}, []string{"*"}, false)
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{read}, acl)
+
+	var streamed []model.AccessControlRule
+	err = a.WhoCanEach([]string{"*"}, []string{"*"}, model.Via{}, true, model.Page{Limit: 1}, func(r model.AccessControlRule) error {
+		streamed = append(streamed, r)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Empty(t, streamed)
+
+	// queries can still look for them
+	acl, err = a.Query("effect = Deny")
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{deny}, acl)
+}
+
+func TestQuery(t *testing.T) {
+	allow := model.AccessControlRule{
+		Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Dev]"},
+		Permission: model.Permission{ID: "s3:GetObject"},
+		Resource:   model.Resource{ID: "arn:aws:s3:::prod-data/*"},
+		GrantChain: []model.GrantIface{model.NewRoleGrant("arn:aws:iam::111122223333:role/Dev")},
+		Effect:     "Allow",
+	}
+	conditional := model.AccessControlRule{
+		Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Ops]"},
+		Permission: model.Permission{ID: "s3:GetObject"},
+		Resource:   model.Resource{ID: "arn:aws:s3:::prod-data/*"},
+		GrantChain: []model.GrantIface{model.NewRoleGrant("arn:aws:iam::111122223333:role/Ops")},
+		Effect:     "Allow",
+		Conditions: []model.Condition{{Operator: "Bool", Key: "aws:MultiFactorAuthPresent", Values: []string{"true"}}},
+	}
+	service := model.AccessControlRule{
+		Principal:  model.Principal{ID: "Service[ec2.amazonaws.com]"},
+		Permission: model.Permission{ID: "s3:*"},
+		Resource:   model.Resource{ID: "*"},
+		GrantChain: []model.GrantIface{model.NewRoleGrant("arn:aws:iam::111122223333:role/Instance")},
+		Effect:     "Allow",
+	}
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{allow, conditional, service}))
+	a := NewAccessControlService(nil, cache)
+
+	got, err := a.Query(`action ~ "s3:Get*" and resource ~ "arn:aws:s3:::prod-*" and not principal ~ "Service[*]" and effect = Allow and condition missing`)
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{allow}, got)
+
+	_, err = a.Query(`action ~`)
+	require.EqualError(t, err, "expected a value after ~ but found end of query at position 9")
+
+	// the offset and limit count the rules matching the whole expression
+	var paged []model.AccessControlRule
+	err = a.QueryEach(`effect = Allow and not principal ~ "*Dev]"`, model.Page{Sort: model.SortByPrincipal, Offset: 1, Limit: 1}, func(r model.AccessControlRule) error {
+		paged = append(paged, r)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{service}, paged)
+}
+
+func TestExpandResources(t *testing.T) {
+	inventory := []model.Resource{
+		{ID: "arn:aws:s3:::prod-data"},
+		{ID: "arn:aws:s3:::dev-data"},
+	}
+	tests := []struct {
+		name      string
+		resources []string
+		exact     bool
+		want      []model.Resource
+	}{
+		{
+			"wildcard",
+			[]string{"arn:aws:s3:::prod-*"},
+			false,
+			[]model.Resource{{ID: "arn:aws:s3:::prod-data"}},
+		},
+		{
+			"exact",
+			[]string{"arn:aws:s3:::dev-data", "arn:aws:s3:::prod-*"},
+			true,
+			[]model.Resource{{ID: "arn:aws:s3:::dev-data"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cacheMock := mocks.NewCacheMock(ctrl)
+
+			a := &AccessControlService{
+				cache: cacheMock,
+			}
+
+			rule := model.AccessControlRule{
+				Resource: model.Resource{ID: "arn:aws:s3:::*"},
+			}
+
+			cacheMock.
+				EXPECT().
+				FindResources(gomock.Eq(&model.Filter{
+					Resources: []string{"arn:aws:s3:::*"},
+				})).
+				Return(inventory, nil).
+				Times(1)
+
+			got, err := a.ExpandResources(&rule, tt.resources, tt.exact)
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWhatCan(t *testing.T) {
+	dev := model.AccessControlRule{
+		Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Dev]"},
+		Permission: model.Permission{ID: "s3:GetObject"},
+		Resource:   model.Resource{ID: "*"},
+		GrantChain: []model.GrantIface{model.NewRoleGrant("arn:aws:iam::111122223333:role/Dev")},
+	}
+	anyone := model.AccessControlRule{
+		Principal:  model.Principal{ID: "AWS[*]"},
+		Permission: model.Permission{ID: "sqs:SendMessage"},
+		Resource:   model.Resource{ID: "*"},
+		GrantChain: []model.GrantIface{model.NewRoleGrant("arn:aws:iam::111122223333:role/Queue")},
+	}
+
+	tests := []struct {
+		name       string
+		principals []string
+		exact      bool
+		want       []model.AccessControlRule
+	}{
+		{"wildcard", []string{"AWS[arn:aws:iam::111122223333:role/Dev]"}, false, []model.AccessControlRule{dev, anyone}},
+		{"exact", []string{"AWS[arn:aws:iam::111122223333:role/Dev]"}, true, []model.AccessControlRule{dev}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := memory.New()
+			require.Nil(t, cache.SaveACL([]model.AccessControlRule{dev, anyone}))
+
+			a := NewAccessControlService(nil, cache)
+
+			got, err := a.WhatCan(tt.principals, tt.exact)
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package iamsnitch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+// Assert evaluates each assertion against the cache. Invalid assertions are
+// reported through AssertionResult.Err rather than aborting the run.
+func (a *AccessControlService) Assert(assertions []model.Assertion) ([]model.AssertionResult, error) {
+	results := make([]model.AssertionResult, 0, len(assertions))
+	for _, as := range assertions {
+		result := model.AssertionResult{Assertion: as}
+
+		if err := validateAssertion(&as); err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+
+		var rules []model.AccessControlRule
+		var err error
+		if len(as.Principals) > 0 {
+			rules, err = a.WhatCan(as.Principals, false)
+		} else {
+			rules, err = a.WhoCan(as.Permissions, as.Resources, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range rules {
+			if violates(&as, &r) {
+				result.Violations = append(result.Violations, r)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func validateAssertion(as *model.Assertion) error {
+	if len(as.Principals) > 0 {
+		if len(as.DenyAccessLevels) == 0 {
+			return fmt.Errorf("assertion %q on principals requires deny_access_levels", as.Name)
+		}
+		for _, l := range as.DenyAccessLevels {
+			if !isAccessLevel(l) {
+				return fmt.Errorf("assertion %q has unknown access level %q", as.Name, l)
+			}
+		}
+		return nil
+	}
+
+	if len(as.Permissions) == 0 || len(as.Resources) == 0 {
+		return fmt.Errorf("assertion %q requires either principals or permissions and resources", as.Name)
+	}
+	if !as.Nobody && len(as.Only) == 0 && len(as.Accounts) == 0 {
+		return fmt.Errorf("assertion %q requires one of only, accounts or nobody", as.Name)
+	}
+	return nil
+}
+
+func violates(as *model.Assertion, r *model.AccessControlRule) bool {
+	if len(as.Principals) > 0 {
+		for _, l := range as.DenyAccessLevels {
+			if model.HasAccessLevel(r.Permission.ID, l) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if as.Nobody {
+		return true
+	}
+	if len(as.Only) > 0 && !principalAllowed(r.Principal.ID, as.Only) {
+		return true
+	}
+	if len(as.Accounts) > 0 {
+		if typ, _ := r.Principal.Split(); typ == "Service" {
+			return false
+		}
+		account := r.Principal.Account()
+		for _, a := range as.Accounts {
+			if a == account {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// principalAllowed treats a wildcard in the principal as "anyone", so it's
+// only covered by an identical pattern or by * itself.
+func principalAllowed(principal string, patterns []string) bool {
+	wide := strings.Contains(principal, "*")
+	for _, p := range patterns {
+		if p == "*" || p == principal || (!wide && wildcard.Match(principal, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAccessLevel(level model.AccessLevel) bool {
+	for _, l := range model.AccessLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
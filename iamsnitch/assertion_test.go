@@ -0,0 +1,131 @@
+package iamsnitch
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssert(t *testing.T) {
+	deployer := escalationRule("AWS[arn:aws:iam::111122223333:role/deployer]", "arn:aws:iam::111122223333:role/Deploy", "iam:PassRole", "arn:aws:iam::111122223333:role/app-*")
+	external := escalationRule("AWS[arn:aws:iam::999988887777:root]", "arn:aws:iam::111122223333:role/Partner", "s3:GetObject", "arn:aws:s3:::pii-*")
+	anyone := escalationRule("AWS[*]", "arn:aws:iam::111122223333:role/Public", "iam:PassRole", "*")
+	service := escalationRule("Service[lambda.amazonaws.com]", "arn:aws:iam::111122223333:role/Lambda", "s3:GetObject", "*")
+	readonly := escalationRule("AWS[arn:aws:iam::111122223333:role/readonly]", "arn:aws:iam::111122223333:role/ReadOnly", "s3:Get*", "*")
+	writer := escalationRule("AWS[arn:aws:iam::111122223333:role/readonly]", "arn:aws:iam::111122223333:role/ReadOnly", "s3:PutObject", "*")
+
+	tests := []struct {
+		name           string
+		assertion      model.Assertion
+		rules          []model.AccessControlRule
+		wantFilter     *model.Filter
+		wantViolations []model.AccessControlRule
+		wantErr        bool
+	}{
+		{
+			"only passes",
+			model.Assertion{
+				Name:        "only deployer",
+				Permissions: []string{"iam:PassRole"},
+				Resources:   []string{"arn:aws:iam::*:role/app-*"},
+				Only:        []string{"AWS[arn:aws:iam::*:role/deployer]"},
+			},
+			[]model.AccessControlRule{deployer},
+			&model.Filter{
+				Permissions: []string{"iam:PassRole"},
+				Resources:   []string{"arn:aws:iam::*:role/app-*"},
+			},
+			nil,
+			false,
+		},
+		{
+			"only fails on wildcard principal",
+			model.Assertion{
+				Name:        "only deployer",
+				Permissions: []string{"iam:PassRole"},
+				Resources:   []string{"arn:aws:iam::*:role/app-*"},
+				Only:        []string{"AWS[arn:aws:iam::*:role/deployer]"},
+			},
+			[]model.AccessControlRule{deployer, anyone},
+			&model.Filter{
+				Permissions: []string{"iam:PassRole"},
+				Resources:   []string{"arn:aws:iam::*:role/app-*"},
+			},
+			[]model.AccessControlRule{anyone},
+			false,
+		},
+		{
+			"accounts",
+			model.Assertion{
+				Name:        "pii stays in the account",
+				Permissions: []string{"s3:GetObject"},
+				Resources:   []string{"arn:aws:s3:::pii-*"},
+				Accounts:    []string{"111122223333"},
+			},
+			[]model.AccessControlRule{external, service},
+			&model.Filter{
+				Permissions: []string{"s3:GetObject"},
+				Resources:   []string{"arn:aws:s3:::pii-*"},
+			},
+			[]model.AccessControlRule{external},
+			false,
+		},
+		{
+			"access levels",
+			model.Assertion{
+				Name:             "readonly",
+				Principals:       []string{"AWS[arn:aws:iam::111122223333:role/readonly]"},
+				DenyAccessLevels: []model.AccessLevel{model.Write},
+			},
+			[]model.AccessControlRule{readonly, writer},
+			&model.Filter{
+				Principals: []string{"AWS[arn:aws:iam::111122223333:role/readonly]"},
+			},
+			[]model.AccessControlRule{writer},
+			false,
+		},
+		{
+			"invalid",
+			model.Assertion{
+				Name:        "missing expectation",
+				Permissions: []string{"s3:GetObject"},
+				Resources:   []string{"*"},
+			},
+			nil,
+			nil,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cacheMock := mocks.NewCacheMock(ctrl)
+
+			a := &AccessControlService{
+				cache: cacheMock,
+			}
+
+			if tt.wantFilter != nil {
+				cacheMock.
+					EXPECT().
+					Find(gomock.Eq(tt.wantFilter)).
+					Return(tt.rules, nil).
+					Times(1)
+			}
+
+			results, err := a.Assert([]model.Assertion{tt.assertion})
+
+			require.Nil(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, tt.wantViolations, results[0].Violations)
+			require.Equal(t, tt.wantErr, results[0].Err != nil)
+			require.Equal(t, !tt.wantErr && tt.wantViolations == nil, results[0].Passed())
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package iamsnitch
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+type AuditConfig struct {
+	KnownAccounts []string
+	UnusedAfter   time.Duration
+	Now           time.Time
+}
+
+// Check inspects the cache and reports findings. Custom checks are added to
+// every audit with RegisterCheck.
+type Check interface {
+	ID() string
+	Description() string
+	Severity() model.Severity
+	Run(cache ports.CacheIface, config *AuditConfig) ([]model.Finding, error)
+}
+
+var checks []Check
+
+func RegisterCheck(c Check) {
+	for _, rc := range checks {
+		if rc.ID() == c.ID() {
+			panic(fmt.Sprintf("check %v registered twice", c.ID()))
+		}
+	}
+	checks = append(checks, c)
+}
+
+func Checks() []Check {
+	return append([]Check{}, checks...)
+}
+
+// CheckInfos describes the registered checks.
+func CheckInfos() []model.CheckInfo {
+	infos := make([]model.CheckInfo, 0, len(checks))
+	for _, c := range checks {
+		infos = append(infos, model.CheckInfo{ID: c.ID(), Description: c.Description(), Severity: c.Severity()})
+	}
+	return infos
+}
+
+func (a *AccessControlService) Audit(config *AuditConfig) ([]model.Finding, error) {
+	var findings []model.Finding
+	for _, c := range checks {
+		f, err := c.Run(a.cache, config)
+		if err != nil {
+			return nil, fmt.Errorf("check %v failed: %w", c.ID(), err)
+		}
+		findings = append(findings, f...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings, nil
+}
@@ -0,0 +1,215 @@
+package iamsnitch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+type builtinCheck struct {
+	id          string
+	description string
+	severity    model.Severity
+	run         func(c *builtinCheck, cache ports.CacheIface, config *AuditConfig) ([]model.Finding, error)
+}
+
+func (c *builtinCheck) ID() string {
+	return c.id
+}
+
+func (c *builtinCheck) Description() string {
+	return c.description
+}
+
+func (c *builtinCheck) Severity() model.Severity {
+	return c.severity
+}
+
+func (c *builtinCheck) Run(cache ports.CacheIface, config *AuditConfig) ([]model.Finding, error) {
+	return c.run(c, cache, config)
+}
+
+func (c *builtinCheck) finding(principal string, location model.Location, format string, args ...interface{}) model.Finding {
+	return model.Finding{
+		CheckID:   c.id,
+		Severity:  c.severity,
+		Principal: model.Principal{ID: principal},
+		Location:  location,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+func statementLocation(arn string, index int) model.Location {
+	return model.Location{
+		ARN:            arn,
+		StatementIndex: &index,
+	}
+}
+
+func init() {
+	RegisterCheck(&builtinCheck{
+		id:          "admin-access",
+		description: "principal is allowed every action on every resource",
+		severity:    model.Critical,
+		run:         checkAdminAccess,
+	})
+	RegisterCheck(&builtinCheck{
+		id:          "trust-wildcard-principal",
+		description: "trust policy allows any principal to assume the role",
+		severity:    model.Critical,
+		run:         forEachTrustStatement(checkWildcardPrincipal),
+	})
+	RegisterCheck(&builtinCheck{
+		id:          "trust-unknown-account",
+		description: "trust policy allows an account that isn't known to assume the role",
+		severity:    model.High,
+		run:         forEachTrustStatement(checkUnknownAccount),
+	})
+	RegisterCheck(&builtinCheck{
+		id:          "trust-confused-deputy",
+		description: "service trust without aws:SourceAccount or aws:SourceArn conditions",
+		severity:    model.Medium,
+		run:         forEachTrustStatement(checkConfusedDeputy),
+	})
+	RegisterCheck(&builtinCheck{
+		id:          "trust-oidc-without-sub",
+		description: "OIDC trust without a condition on the sub claim",
+		severity:    model.High,
+		run:         forEachTrustStatement(checkOIDCWithoutSub),
+	})
+	RegisterCheck(&builtinCheck{
+		id:          "unused-role",
+		description: "role hasn't been used within the configured period",
+		severity:    model.Low,
+		run:         checkUnusedRole,
+	})
+}
+
+func checkAdminAccess(c *builtinCheck, cache ports.CacheIface, config *AuditConfig) ([]model.Finding, error) {
+	rules, err := cache.Find(&model.Filter{
+		Permissions: []string{"*"},
+		Resources:   []string{"*"},
+		ExactMatch:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make([]model.Finding, 0, len(rules))
+	for _, r := range rules {
+		findings = append(findings, c.finding(r.Principal.ID, statementLocation(grantChainPolicy(r.GrantChain), r.StatementIndex), "%v is allowed *:* on * via %v", r.Principal.ID, r.GrantChain))
+	}
+	return findings, nil
+}
+
+func checkWildcardPrincipal(c *builtinCheck, role *model.Role, ts *model.TrustStatement, config *AuditConfig) *model.Finding {
+	typ, id := ts.Principal.Split()
+	if id != "*" {
+		return nil
+	}
+	f := c.finding(ts.Principal.ID, statementLocation(role.ARN, ts.StatementIndex), "role %v can be assumed by any %v principal", role.Name, typ)
+	return &f
+}
+
+func checkUnknownAccount(c *builtinCheck, role *model.Role, ts *model.TrustStatement, config *AuditConfig) *model.Finding {
+	typ, _ := ts.Principal.Split()
+	account := ts.Principal.Account()
+	if typ != "AWS" || account == "" || account == role.Account() {
+		return nil
+	}
+	for _, ka := range config.KnownAccounts {
+		if ka == account {
+			return nil
+		}
+	}
+	f := c.finding(ts.Principal.ID, statementLocation(role.ARN, ts.StatementIndex), "role %v trusts unknown account %v", role.Name, account)
+	return &f
+}
+
+func checkConfusedDeputy(c *builtinCheck, role *model.Role, ts *model.TrustStatement, config *AuditConfig) *model.Finding {
+	typ, service := ts.Principal.Split()
+	if typ != "Service" || hasConditionKey(ts.Conditions, "aws:SourceAccount", "aws:SourceArn", "aws:SourceOrgID") {
+		return nil
+	}
+	f := c.finding(ts.Principal.ID, statementLocation(role.ARN, ts.StatementIndex), "role %v trusts %v without aws:SourceAccount or aws:SourceArn conditions", role.Name, service)
+	return &f
+}
+
+func checkOIDCWithoutSub(c *builtinCheck, role *model.Role, ts *model.TrustStatement, config *AuditConfig) *model.Finding {
+	typ, provider := ts.Principal.Split()
+	if typ != "Federated" || !strings.Contains(provider, ":oidc-provider/") {
+		return nil
+	}
+	for _, cond := range ts.Conditions {
+		if strings.HasSuffix(cond.Key, ":sub") {
+			return nil
+		}
+	}
+	f := c.finding(ts.Principal.ID, statementLocation(role.ARN, ts.StatementIndex), "role %v trusts OIDC provider %v without a sub condition", role.Name, provider)
+	return &f
+}
+
+func checkUnusedRole(c *builtinCheck, cache ports.CacheIface, config *AuditConfig) ([]model.Finding, error) {
+	if config.UnusedAfter == 0 {
+		return nil, nil
+	}
+
+	roles, err := cache.FindRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := config.Now.Add(-config.UnusedAfter)
+
+	var findings []model.Finding
+	for _, r := range roles {
+		switch {
+		case r.LastUsed == nil && r.CreateDate.Before(cutoff):
+			findings = append(findings, c.finding("", model.Location{ARN: r.ARN}, "role %v has never been used", r.Name))
+		case r.LastUsed != nil && r.LastUsed.Before(cutoff):
+			findings = append(findings, c.finding("", model.Location{ARN: r.ARN}, "role %v was last used on %v", r.Name, r.LastUsed.Format("2006-01-02")))
+		}
+	}
+	return findings, nil
+}
+
+func forEachTrustStatement(check func(c *builtinCheck, role *model.Role, ts *model.TrustStatement, config *AuditConfig) *model.Finding) func(c *builtinCheck, cache ports.CacheIface, config *AuditConfig) ([]model.Finding, error) {
+	return func(c *builtinCheck, cache ports.CacheIface, config *AuditConfig) ([]model.Finding, error) {
+		roles, err := cache.FindRoles()
+		if err != nil {
+			return nil, err
+		}
+
+		var findings []model.Finding
+		for _, r := range roles {
+			for _, ts := range r.Trust {
+				if f := check(c, &r, &ts, config); f != nil {
+					findings = append(findings, *f)
+				}
+			}
+		}
+		return findings, nil
+	}
+}
+
+func hasConditionKey(conditions []model.Condition, keys ...string) bool {
+	for _, c := range conditions {
+		for _, k := range keys {
+			if strings.EqualFold(c.Key, k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func grantChainPolicy(chain []model.GrantIface) string {
+	for _, g := range chain {
+		if pg, ok := g.(model.PolicyGrant); ok {
+			return pg.ID
+		}
+	}
+	return ""
+}
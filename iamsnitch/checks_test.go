@@ -0,0 +1,184 @@
+package iamsnitch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	now := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	recently := now.Add(-24 * time.Hour)
+	created := now.Add(-365 * 24 * time.Hour)
+
+	admin := escalationRule("AWS[arn:aws:iam::111122223333:role/Admin]", "arn:aws:iam::111122223333:role/AdminRole", "*", "*")
+
+	tests := []struct {
+		name  string
+		rules []model.AccessControlRule
+		roles []model.Role
+		want  []model.Finding
+	}{
+		{
+			"admin access",
+			[]model.AccessControlRule{admin},
+			nil,
+			[]model.Finding{
+				{
+					CheckID:   "admin-access",
+					Severity:  model.Critical,
+					Principal: admin.Principal,
+					Location:  statementLocation("arn:aws:iam::111122223333:policy/TestPolicy", 0),
+					Message:   "AWS[arn:aws:iam::111122223333:role/Admin] is allowed *:* on * via [Role:arn:aws:iam::111122223333:role/AdminRole Policy:arn:aws:iam::111122223333:policy/TestPolicy]",
+				},
+			},
+		},
+		{
+			"trust policies",
+			nil,
+			[]model.Role{
+				auditRole("Public", &recently, model.TrustStatement{
+					Principal: model.Principal{ID: "AWS[*]"},
+				}),
+				auditRole("CrossAccount", &recently,
+					model.TrustStatement{
+						Principal:      model.Principal{ID: "AWS[arn:aws:iam::999988887777:root]"},
+						StatementIndex: 2,
+					},
+					model.TrustStatement{
+						Principal: model.Principal{ID: "AWS[444455556666]"},
+					},
+					model.TrustStatement{
+						Principal: model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+					},
+				),
+				auditRole("Service", &recently,
+					model.TrustStatement{
+						Principal: model.Principal{ID: "Service[events.amazonaws.com]"},
+					},
+					model.TrustStatement{
+						Principal: model.Principal{ID: "Service[sns.amazonaws.com]"},
+						Conditions: []model.Condition{
+							{Operator: "ArnLike", Key: "aws:SourceArn", Values: []string{"arn:aws:sns:*:111122223333:*"}},
+						},
+					},
+				),
+				auditRole("OIDC", &recently,
+					model.TrustStatement{
+						Principal: model.Principal{ID: "Federated[arn:aws:iam::111122223333:oidc-provider/token.actions.githubusercontent.com]"},
+						Conditions: []model.Condition{
+							{Operator: "StringEquals", Key: "token.actions.githubusercontent.com:aud", Values: []string{"sts.amazonaws.com"}},
+						},
+					},
+				),
+			},
+			[]model.Finding{
+				{
+					CheckID:   "trust-wildcard-principal",
+					Severity:  model.Critical,
+					Principal: model.Principal{ID: "AWS[*]"},
+					Location:  statementLocation("arn:aws:iam::111122223333:role/Public", 0),
+					Message:   "role Public can be assumed by any AWS principal",
+				},
+				{
+					CheckID:   "trust-unknown-account",
+					Severity:  model.High,
+					Principal: model.Principal{ID: "AWS[arn:aws:iam::999988887777:root]"},
+					Location:  statementLocation("arn:aws:iam::111122223333:role/CrossAccount", 2),
+					Message:   "role CrossAccount trusts unknown account 999988887777",
+				},
+				{
+					CheckID:   "trust-oidc-without-sub",
+					Severity:  model.High,
+					Principal: model.Principal{ID: "Federated[arn:aws:iam::111122223333:oidc-provider/token.actions.githubusercontent.com]"},
+					Location:  statementLocation("arn:aws:iam::111122223333:role/OIDC", 0),
+					Message:   "role OIDC trusts OIDC provider arn:aws:iam::111122223333:oidc-provider/token.actions.githubusercontent.com without a sub condition",
+				},
+				{
+					CheckID:   "trust-confused-deputy",
+					Severity:  model.Medium,
+					Principal: model.Principal{ID: "Service[events.amazonaws.com]"},
+					Location:  statementLocation("arn:aws:iam::111122223333:role/Service", 0),
+					Message:   "role Service trusts events.amazonaws.com without aws:SourceAccount or aws:SourceArn conditions",
+				},
+			},
+		},
+		{
+			"unused roles",
+			nil,
+			[]model.Role{
+				auditRole("Never", nil),
+				auditRole("Stale", &created),
+				auditRole("Recent", &recently),
+			},
+			[]model.Finding{
+				{
+					CheckID:  "unused-role",
+					Severity: model.Low,
+					Location: model.Location{ARN: "arn:aws:iam::111122223333:role/Never"},
+					Message:  "role Never has never been used",
+				},
+				{
+					CheckID:  "unused-role",
+					Severity: model.Low,
+					Location: model.Location{ARN: "arn:aws:iam::111122223333:role/Stale"},
+					Message:  "role Stale was last used on 2020-07-01",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cacheMock := mocks.NewCacheMock(ctrl)
+
+			a := &AccessControlService{
+				cache: cacheMock,
+			}
+
+			cacheMock.EXPECT().Find(gomock.Any()).Return(tt.rules, nil).AnyTimes()
+			cacheMock.EXPECT().FindRoles().Return(tt.roles, nil).AnyTimes()
+
+			findings, err := a.Audit(&AuditConfig{
+				KnownAccounts: []string{"444455556666"},
+				UnusedAfter:   90 * 24 * time.Hour,
+				Now:           now,
+			})
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, findings)
+		})
+	}
+}
+
+func TestAuditIgnoresDeny(t *testing.T) {
+	admin := escalationRule("AWS[arn:aws:iam::111122223333:role/Admin]", "arn:aws:iam::111122223333:role/AdminRole", "*", "*")
+	denyAll := escalationRule("AWS[arn:aws:iam::111122223333:role/Dev]", "arn:aws:iam::111122223333:role/DevRole", "*", "*")
+	denyAll.Effect = "Deny"
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{admin, denyAll}))
+
+	findings, err := NewAccessControlService(nil, cache).Audit(&AuditConfig{Now: time.Now()})
+	require.Nil(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "admin-access", findings[0].CheckID)
+	require.Equal(t, admin.Principal, findings[0].Principal)
+}
+
+func auditRole(name string, lastUsed *time.Time, trust ...model.TrustStatement) model.Role {
+	return model.Role{
+		ARN:        "arn:aws:iam::111122223333:role/" + name,
+		Name:       name,
+		CreateDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		LastUsed:   lastUsed,
+		Trust:      trust,
+	}
+}
@@ -0,0 +1,265 @@
+package iamsnitch
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+var AssumeAdminRole = model.EscalationTechnique{
+	ID:          "sts-assume-admin-role",
+	Description: "assume a role that is allowed every action on every resource",
+	Permissions: []string{"sts:AssumeRole"},
+}
+
+// EscalationTechniques lists the privilege escalation primitives looked for
+// by Escalations. A principal matches a technique when it holds every one of
+// its permissions.
+var EscalationTechniques = []model.EscalationTechnique{
+	{
+		ID:          "iam-create-policy-version",
+		Description: "publish a new default version of a managed policy already attached to the principal",
+		Permissions: []string{"iam:CreatePolicyVersion"},
+	},
+	{
+		ID:          "iam-set-default-policy-version",
+		Description: "roll a managed policy back to a more permissive version",
+		Permissions: []string{"iam:SetDefaultPolicyVersion"},
+	},
+	{
+		ID:          "iam-attach-role-policy",
+		Description: "attach an administrator policy to a role",
+		Permissions: []string{"iam:AttachRolePolicy"},
+	},
+	{
+		ID:          "iam-attach-user-policy",
+		Description: "attach an administrator policy to a user",
+		Permissions: []string{"iam:AttachUserPolicy"},
+	},
+	{
+		ID:          "iam-attach-group-policy",
+		Description: "attach an administrator policy to a group",
+		Permissions: []string{"iam:AttachGroupPolicy"},
+	},
+	{
+		ID:          "iam-put-role-policy",
+		Description: "write an inline administrator policy into a role",
+		Permissions: []string{"iam:PutRolePolicy"},
+	},
+	{
+		ID:          "iam-put-user-policy",
+		Description: "write an inline administrator policy into a user",
+		Permissions: []string{"iam:PutUserPolicy"},
+	},
+	{
+		ID:          "iam-put-group-policy",
+		Description: "write an inline administrator policy into a group",
+		Permissions: []string{"iam:PutGroupPolicy"},
+	},
+	{
+		ID:          "iam-add-user-to-group",
+		Description: "join a more privileged group",
+		Permissions: []string{"iam:AddUserToGroup"},
+	},
+	{
+		ID:          "iam-create-access-key",
+		Description: "create access keys for another user",
+		Permissions: []string{"iam:CreateAccessKey"},
+	},
+	{
+		ID:          "iam-create-login-profile",
+		Description: "set a console password for a user that has none",
+		Permissions: []string{"iam:CreateLoginProfile"},
+	},
+	{
+		ID:          "iam-update-login-profile",
+		Description: "reset the console password of another user",
+		Permissions: []string{"iam:UpdateLoginProfile"},
+	},
+	{
+		ID:          "iam-update-assume-role-policy",
+		Description: "rewrite the trust policy of a role and assume it",
+		Permissions: []string{"iam:UpdateAssumeRolePolicy", "sts:AssumeRole"},
+	},
+	{
+		ID:          "iam-passrole-lambda",
+		Description: "pass a role to a new Lambda function and invoke it",
+		Permissions: []string{"iam:PassRole", "lambda:CreateFunction", "lambda:InvokeFunction"},
+	},
+	{
+		ID:          "iam-passrole-lambda-event-source",
+		Description: "pass a role to a new Lambda function triggered by an event source",
+		Permissions: []string{"iam:PassRole", "lambda:CreateFunction", "lambda:CreateEventSourceMapping"},
+	},
+	{
+		ID:          "lambda-update-function-code",
+		Description: "replace the code of an existing Lambda function running with a privileged role",
+		Permissions: []string{"lambda:UpdateFunctionCode"},
+	},
+	{
+		ID:          "iam-passrole-ec2",
+		Description: "pass a role to a new EC2 instance and read its credentials",
+		Permissions: []string{"iam:PassRole", "ec2:RunInstances"},
+	},
+	{
+		ID:          "iam-passrole-cloudformation",
+		Description: "pass a role to a new CloudFormation stack",
+		Permissions: []string{"iam:PassRole", "cloudformation:CreateStack"},
+	},
+	{
+		ID:          "iam-passrole-glue",
+		Description: "pass a role to a new Glue development endpoint",
+		Permissions: []string{"iam:PassRole", "glue:CreateDevEndpoint"},
+	},
+	{
+		ID:          "iam-passrole-datapipeline",
+		Description: "pass a role to a new Data Pipeline",
+		Permissions: []string{"iam:PassRole", "datapipeline:CreatePipeline", "datapipeline:PutPipelineDefinition"},
+	},
+}
+
+// Escalations reports the principals that can obtain broader access than
+// they currently hold. Principals that are already administrators are skipped.
+func (a *AccessControlService) Escalations() ([]model.EscalationPath, error) {
+	return a.EscalationsOf(nil, false)
+}
+
+// EscalationsOf is Escalations restricted to the principals matching any of
+// principals, or every principal when none is given. exact only applies to
+// the principals, the permissions of the techniques are always matched as
+// patterns.
+func (a *AccessControlService) EscalationsOf(principals []string, exact bool) ([]model.EscalationPath, error) {
+	admins, err := a.cache.Find(&model.Filter{
+		Permissions: []string{"*"},
+		Resources:   []string{"*"},
+		ExactMatch:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := a.cache.Find(&model.Filter{
+		Permissions: escalationPermissions(),
+		Resources:   []string{"*"},
+		Principals:  principals,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	asked := make(map[string]bool, len(principals))
+	for _, p := range principals {
+		asked[p] = true
+	}
+
+	isAdmin := make(map[string]bool, len(admins))
+	for _, r := range admins {
+		isAdmin[r.Principal.ID] = true
+	}
+
+	byPrincipal := make(map[string][]model.AccessControlRule)
+	for _, r := range rules {
+		if exact && !asked[r.Principal.ID] {
+			continue
+		}
+		if !isAdmin[r.Principal.ID] {
+			byPrincipal[r.Principal.ID] = append(byPrincipal[r.Principal.ID], r)
+		}
+	}
+
+	escalating := make([]string, 0, len(byPrincipal))
+	for p := range byPrincipal {
+		escalating = append(escalating, p)
+	}
+	sort.Strings(escalating)
+
+	var paths []model.EscalationPath
+	for _, p := range escalating {
+		for _, t := range EscalationTechniques {
+			if chain, ok := buildEscalationChain(t, byPrincipal[p]); ok {
+				paths = append(paths, model.EscalationPath{
+					Principal:  model.Principal{ID: p},
+					Technique:  t,
+					GrantChain: chain,
+				})
+			}
+		}
+		paths = append(paths, assumeAdminPaths(p, byPrincipal[p], admins)...)
+	}
+	return paths, nil
+}
+
+func escalationPermissions() []string {
+	seen := map[string]bool{}
+	var permissions []string
+	for _, t := range append(EscalationTechniques, AssumeAdminRole) {
+		for _, p := range t.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return permissions
+}
+
+func buildEscalationChain(t model.EscalationTechnique, rules []model.AccessControlRule) ([]model.GrantIface, bool) {
+	var chain []model.GrantIface
+	for _, p := range t.Permissions {
+		r, ok := findRuleFor(p, rules)
+		if !ok {
+			return nil, false
+		}
+		chain = append(chain, r.GrantChain...)
+		chain = append(chain, model.NewPermissionGrant(p, r.Resource.ID))
+	}
+	return chain, true
+}
+
+func assumeAdminPaths(principal string, rules []model.AccessControlRule, admins []model.AccessControlRule) []model.EscalationPath {
+	var paths []model.EscalationPath
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if !allowsAction(&r, "sts:AssumeRole") {
+			continue
+		}
+		for _, admin := range admins {
+			if len(admin.GrantChain) == 0 {
+				continue
+			}
+			role := admin.GrantChain[0]
+			rg, ok := role.(model.RoleGrant)
+			if !ok || seen[rg.ID] || !wildcard.Covers(r.Resource.ID, rg.ID) {
+				continue
+			}
+			seen[rg.ID] = true
+
+			chain := append([]model.GrantIface{}, r.GrantChain...)
+			chain = append(chain, model.NewPermissionGrant("sts:AssumeRole", r.Resource.ID), rg)
+			paths = append(paths, model.EscalationPath{
+				Principal:  model.Principal{ID: principal},
+				Technique:  AssumeAdminRole,
+				GrantChain: chain,
+			})
+		}
+	}
+	return paths
+}
+
+func findRuleFor(permission string, rules []model.AccessControlRule) (model.AccessControlRule, bool) {
+	for _, r := range rules {
+		if allowsAction(&r, permission) {
+			return r, true
+		}
+	}
+	return model.AccessControlRule{}, false
+}
+
+// allowsAction tells whether the rule grants the action. Actions are case
+// insensitive, and the rule has to cover all of it: iam:CreatePolicy doesn't
+// grant iam:CreatePolicyVersion even though the two patterns overlap.
+func allowsAction(r *model.AccessControlRule, action string) bool {
+	return wildcard.Covers(strings.ToLower(r.Permission.ID), strings.ToLower(action))
+}
@@ -0,0 +1,226 @@
+package iamsnitch
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscalations(t *testing.T) {
+	admin := escalationRule("AWS[arn:aws:iam::111122223333:role/Admin]", "arn:aws:iam::111122223333:role/AdminRole", "*", "*")
+	passRole := escalationRule("AWS[arn:aws:iam::111122223333:role/Dev]", "arn:aws:iam::111122223333:role/DevRole", "iam:PassRole", "*")
+	createFunction := escalationRule("AWS[arn:aws:iam::111122223333:role/Dev]", "arn:aws:iam::111122223333:role/DevRole", "lambda:*", "*")
+	assumeRole := escalationRule("Service[ec2.amazonaws.com]", "arn:aws:iam::111122223333:role/AppRole", "sts:AssumeRole", "arn:aws:iam::111122223333:role/Admin*")
+	// overlap with the technique permissions without granting them
+	createPolicy := escalationRule("AWS[arn:aws:iam::111122223333:role/Ops]", "arn:aws:iam::111122223333:role/OpsRole", "iam:CreatePolicy", "*")
+	assumeSAML := escalationRule("AWS[arn:aws:iam::111122223333:role/Ops]", "arn:aws:iam::111122223333:role/OpsRole", "sts:AssumeRoleWithSAML", "*")
+	assumeOther := escalationRule("AWS[arn:aws:iam::111122223333:role/Ops]", "arn:aws:iam::111122223333:role/OpsRole", "sts:AssumeRole", "arn:aws:iam::111122223333:role/Admin/*")
+
+	tests := []struct {
+		name    string
+		admins  []model.AccessControlRule
+		rules   []model.AccessControlRule
+		want    []model.EscalationPath
+		wantErr error
+	}{
+		{
+			"passrole and lambda",
+			[]model.AccessControlRule{admin},
+			[]model.AccessControlRule{admin, passRole, createFunction},
+			[]model.EscalationPath{
+				{
+					Principal: passRole.Principal,
+					Technique: escalationTechnique(t, "iam-passrole-lambda"),
+					GrantChain: []model.GrantIface{
+						passRole.GrantChain[0],
+						passRole.GrantChain[1],
+						model.NewPermissionGrant("iam:PassRole", "*"),
+						createFunction.GrantChain[0],
+						createFunction.GrantChain[1],
+						model.NewPermissionGrant("lambda:CreateFunction", "*"),
+						createFunction.GrantChain[0],
+						createFunction.GrantChain[1],
+						model.NewPermissionGrant("lambda:InvokeFunction", "*"),
+					},
+				},
+				{
+					Principal: passRole.Principal,
+					Technique: escalationTechnique(t, "iam-passrole-lambda-event-source"),
+					GrantChain: []model.GrantIface{
+						passRole.GrantChain[0],
+						passRole.GrantChain[1],
+						model.NewPermissionGrant("iam:PassRole", "*"),
+						createFunction.GrantChain[0],
+						createFunction.GrantChain[1],
+						model.NewPermissionGrant("lambda:CreateFunction", "*"),
+						createFunction.GrantChain[0],
+						createFunction.GrantChain[1],
+						model.NewPermissionGrant("lambda:CreateEventSourceMapping", "*"),
+					},
+				},
+				{
+					Principal: passRole.Principal,
+					Technique: escalationTechnique(t, "lambda-update-function-code"),
+					GrantChain: []model.GrantIface{
+						createFunction.GrantChain[0],
+						createFunction.GrantChain[1],
+						model.NewPermissionGrant("lambda:UpdateFunctionCode", "*"),
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"assume admin role",
+			[]model.AccessControlRule{admin},
+			[]model.AccessControlRule{admin, assumeRole},
+			[]model.EscalationPath{
+				{
+					Principal: assumeRole.Principal,
+					Technique: AssumeAdminRole,
+					GrantChain: []model.GrantIface{
+						assumeRole.GrantChain[0],
+						assumeRole.GrantChain[1],
+						model.NewPermissionGrant("sts:AssumeRole", "arn:aws:iam::111122223333:role/Admin*"),
+						admin.GrantChain[0],
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"overlapping permissions",
+			[]model.AccessControlRule{admin},
+			[]model.AccessControlRule{admin, createPolicy, assumeSAML, assumeOther},
+			nil,
+			nil,
+		},
+		{
+			"no escalation",
+			nil,
+			[]model.AccessControlRule{passRole},
+			nil,
+			nil,
+		},
+		{
+			"find error",
+			nil,
+			nil,
+			nil,
+			fmt.Errorf("find error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cacheMock := mocks.NewCacheMock(ctrl)
+
+			a := &AccessControlService{
+				cache: cacheMock,
+			}
+
+			cacheMock.
+				EXPECT().
+				Find(gomock.Eq(&model.Filter{
+					Permissions: []string{"*"},
+					Resources:   []string{"*"},
+					ExactMatch:  true,
+				})).
+				Return(tt.admins, tt.wantErr).
+				Times(1)
+
+			if tt.wantErr == nil {
+				cacheMock.
+					EXPECT().
+					Find(gomock.Eq(&model.Filter{
+						Permissions: escalationPermissions(),
+						Resources:   []string{"*"},
+					})).
+					Return(tt.rules, nil).
+					Times(1)
+			}
+
+			paths, err := a.Escalations()
+
+			require.Equal(t, tt.wantErr, err)
+			require.Equal(t, tt.want, paths)
+		})
+	}
+}
+
+func TestEscalationsOf(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	passRole := escalationRule("AWS[arn:aws:iam::111122223333:role/Dev]", "arn:aws:iam::111122223333:role/DevRole", "iam:PassRole", "*")
+	runInstances := escalationRule("AWS[arn:aws:iam::111122223333:role/Dev]", "arn:aws:iam::111122223333:role/DevRole", "ec2:*", "*")
+	anyone := escalationRule("AWS[*]", "arn:aws:iam::111122223333:role/PublicRole", "iam:CreateAccessKey", "*")
+	cacheMock := mocks.NewCacheMock(ctrl)
+	cacheMock.
+		EXPECT().
+		Find(gomock.Eq(&model.Filter{Permissions: []string{"*"}, Resources: []string{"*"}, ExactMatch: true})).
+		Return(nil, nil).
+		Times(1)
+	// only the rules of the principals asked for are looked at, permissions
+	// are still matched as patterns so ec2:* grants ec2:RunInstances
+	cacheMock.
+		EXPECT().
+		Find(gomock.Eq(&model.Filter{
+			Permissions: escalationPermissions(),
+			Resources:   []string{"*"},
+			Principals:  []string{"AWS[arn:aws:iam::111122223333:role/Dev]"},
+		})).
+		Return([]model.AccessControlRule{passRole, runInstances, anyone}, nil).
+		Times(1)
+
+	paths, err := NewAccessControlService(nil, cacheMock).EscalationsOf([]string{"AWS[arn:aws:iam::111122223333:role/Dev]"}, true)
+	require.Nil(t, err)
+	require.Len(t, paths, 1)
+	require.Equal(t, "iam-passrole-ec2", paths[0].Technique.ID)
+	require.Equal(t, model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Dev]"}, paths[0].Principal)
+}
+
+func TestEscalationsIgnoreDeny(t *testing.T) {
+	admin := escalationRule("AWS[arn:aws:iam::111122223333:role/Admin]", "arn:aws:iam::111122223333:role/AdminRole", "*", "*")
+	// denying everything neither makes Ops an administrator nor lets it escalate
+	denyAll := escalationRule("AWS[arn:aws:iam::111122223333:role/Ops]", "arn:aws:iam::111122223333:role/OpsRole", "*", "*")
+	denyAll.Effect = "Deny"
+	denyAssume := escalationRule("AWS[arn:aws:iam::111122223333:role/Dev]", "arn:aws:iam::111122223333:role/DevRole", "sts:AssumeRole", "*")
+	denyAssume.Effect = "Deny"
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{admin, denyAll, denyAssume}))
+
+	paths, err := NewAccessControlService(nil, cache).Escalations()
+	require.Nil(t, err)
+	require.Empty(t, paths)
+}
+
+func escalationTechnique(t *testing.T, id string) model.EscalationTechnique {
+	for _, et := range EscalationTechniques {
+		if et.ID == id {
+			return et
+		}
+	}
+	t.Fatalf("unknown escalation technique %v", id)
+	return model.EscalationTechnique{}
+}
+
+func escalationRule(principal string, role string, permission string, resource string) model.AccessControlRule {
+	return model.AccessControlRule{
+		Principal:  model.Principal{ID: principal},
+		Permission: model.Permission{ID: permission},
+		Resource:   model.Resource{ID: resource},
+		GrantChain: []model.GrantIface{
+			model.NewRoleGrant(role),
+			model.NewPolicyGrant("arn:aws:iam::111122223333:policy/TestPolicy"),
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package iamsnitch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+// Account is an account the cache is refreshed from. Usage, when set, is
+// where the usage of its roles is collected from after its policies.
+type Account struct {
+	// ID names the account in errors, empty for the default credentials
+	ID       string
+	Provider ports.IAMProviderIface
+	Usage    ports.UsageProviderIface
+}
+
+// Refresh refreshes the cache from each account, up to concurrency accounts
+// at a time. Every account is refreshed even when another fails, and the
+// errors are returned together.
+func Refresh(cache ports.CacheIface, accounts []Account, concurrency int) error {
+	if len(accounts) == 1 && accounts[0].ID == "" {
+		return refreshAccount(cache, &accounts[0])
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	errs := make(chan error, len(accounts))
+	for i := range accounts {
+		wg.Add(1)
+		go func(account *Account) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := refreshAccount(cache, account); err != nil {
+				errs <- fmt.Errorf("failed to refresh account %v: %w", account.ID, err)
+			}
+		}(&accounts[i])
+	}
+	wg.Wait()
+	close(errs)
+
+	var failed []string
+	for err := range errs {
+		failed = append(failed, err.Error())
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("%v of %v accounts failed to refresh:\n%v", len(failed), len(accounts), strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+func refreshAccount(cache ports.CacheIface, account *Account) error {
+	accessService := NewAccessControlService(account.Provider, cache)
+
+	if err := accessService.RefreshACL(); err != nil {
+		return err
+	}
+
+	if err := accessService.RefreshRoles(); err != nil {
+		return err
+	}
+
+	if err := accessService.RefreshPolicies(); err != nil {
+		return err
+	}
+
+	if account.Usage != nil {
+		return accessService.RefreshUsage(account.Usage)
+	}
+	return nil
+}
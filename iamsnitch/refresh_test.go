@@ -0,0 +1,65 @@
+package iamsnitch
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rule := func(role string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: "AWS[*]"},
+			Permission: model.Permission{ID: "s3:GetObject"},
+			Resource:   model.Resource{ID: "*"},
+			GrantChain: []model.GrantIface{model.NewRoleGrant(role)},
+		}
+	}
+	dev := rule("arn:aws:iam::111122223333:role/Dev")
+	used := model.Usage{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "s3:*"}
+
+	// the first account refreshes with its usage, the others fail
+	ok := mocks.NewIAMProviderMock(ctrl)
+	usage := mocks.NewUsageProviderMock(ctrl)
+	page := mocks.NewPageMock(ctrl)
+	page.EXPECT().HasNext().Return(false).AnyTimes()
+	ok.EXPECT().FetchACL(nil).Return([]model.AccessControlRule{dev}, page, nil)
+	ok.EXPECT().FetchRoles(nil).Return(nil, page, nil)
+	ok.EXPECT().FetchPolicies(nil).Return(nil, page, nil)
+	usage.EXPECT().FetchUsage(nil).Return([]model.Usage{used}, page, nil)
+
+	failing := func() *mocks.IAMProviderMock {
+		m := mocks.NewIAMProviderMock(ctrl)
+		m.EXPECT().FetchACL(nil).Return(nil, nil, fmt.Errorf("AccessDenied"))
+		return m
+	}
+
+	cache := memory.New()
+	err := Refresh(cache, []Account{
+		{ID: "111122223333", Provider: ok, Usage: usage},
+		{ID: "555566667777", Provider: failing()},
+		{ID: "444455556666", Provider: failing()},
+	}, 2)
+	require.EqualError(t, err, "2 of 3 accounts failed to refresh:\n"+
+		"failed to refresh account 444455556666: AccessDenied\n"+
+		"failed to refresh account 555566667777: AccessDenied")
+
+	acl, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{dev}, acl)
+	recorded, err := cache.FindUsage(used.LastUsed)
+	require.Nil(t, err)
+	require.Equal(t, []model.Usage{used}, recorded)
+
+	// the default credentials fail on their own
+	err = Refresh(cache, []Account{{Provider: failing()}}, 1)
+	require.EqualError(t, err, "AccessDenied")
+}
@@ -0,0 +1,120 @@
+package iamsnitch
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+// ruleRisks tell the factors a rule contributes to. Escalation is found over
+// every rule of the principal instead.
+var ruleRisks = []struct {
+	factor  model.RiskFactor
+	matches func(r *model.AccessControlRule) bool
+}{
+	{model.RiskWildcardAction, func(r *model.AccessControlRule) bool {
+		return strings.Contains(r.Permission.ID, "*")
+	}},
+	{model.RiskWildcardResource, func(r *model.AccessControlRule) bool {
+		return r.Resource.ID == "*"
+	}},
+	{model.RiskWriteAccess, func(r *model.AccessControlRule) bool {
+		return model.HasAccessLevel(r.Permission.ID, model.Write)
+	}},
+	{model.RiskPermissionsManagement, func(r *model.AccessControlRule) bool {
+		return model.HasAccessLevel(r.Permission.ID, model.PermissionsManagement)
+	}},
+	{model.RiskCrossAccount, isCrossAccount},
+	{model.RiskPublic, func(r *model.AccessControlRule) bool {
+		_, id := r.Principal.Split()
+		return id == "*"
+	}},
+	{model.RiskNoMFA, func(r *model.AccessControlRule) bool {
+		sensitive := model.HasAccessLevel(r.Permission.ID, model.Write) ||
+			model.HasAccessLevel(r.Permission.ID, model.PermissionsManagement)
+		return sensitive && !hasConditionKey(r.Conditions, "aws:MultiFactorAuthPresent", "aws:MultiFactorAuthAge")
+	}},
+}
+
+// isCrossAccount tells whether the principal belongs to another account than
+// the role it assumes to get the rule.
+func isCrossAccount(r *model.AccessControlRule) bool {
+	account := r.Principal.Account()
+	if account == "" {
+		return false
+	}
+	for _, g := range r.GrantChain {
+		if rg, ok := g.(model.RoleGrant); ok {
+			ra := model.ARNAccount(rg.ID)
+			return ra != "" && ra != account
+		}
+	}
+	return false
+}
+
+// RiskScores scores the principals matching any of principals, or every
+// principal when none is given, from their cached rules. The highest scores
+// come first. Deny rules don't add to the risk.
+func (a *AccessControlService) RiskScores(principals []string, exact bool) ([]model.RiskScore, error) {
+	counts := make(map[string]map[string]int)
+	err := a.cache.FindEach(&model.Filter{
+		Principals: principals,
+		ExactMatch: exact,
+	}, func(r model.AccessControlRule) error {
+		pc, ok := counts[r.Principal.ID]
+		if !ok {
+			pc = make(map[string]int)
+			counts[r.Principal.ID] = pc
+		}
+		for _, rr := range ruleRisks {
+			if rr.matches(&r) {
+				pc[rr.factor.ID]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := a.EscalationsOf(principals, exact)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if pc, ok := counts[p.Principal.ID]; ok {
+			pc[model.RiskEscalation.ID]++
+		}
+	}
+
+	factors := []model.RiskFactor{model.RiskEscalation}
+	for _, rr := range ruleRisks {
+		factors = append(factors, rr.factor)
+	}
+
+	scores := make([]model.RiskScore, 0, len(counts))
+	for principal, pc := range counts {
+		s := model.RiskScore{Principal: model.Principal{ID: principal}}
+		for _, f := range factors {
+			if n := pc[f.ID]; n > 0 {
+				s.Score += f.Points
+				s.Factors = append(s.Factors, model.RiskContribution{Factor: f, Count: n})
+			}
+		}
+		if s.Score > model.MaxRiskScore {
+			s.Score = model.MaxRiskScore
+		}
+		sort.SliceStable(s.Factors, func(i, j int) bool {
+			return s.Factors[i].Factor.Points > s.Factors[j].Factor.Points
+		})
+		scores = append(scores, s)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Principal.ID < scores[j].Principal.ID
+	})
+	return scores, nil
+}
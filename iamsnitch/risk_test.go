@@ -0,0 +1,70 @@
+package iamsnitch
+
+import (
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskScores(t *testing.T) {
+	rule := func(principal string, permission string, resource string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: principal},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: resource},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+				model.NewPolicyGrant("arn:aws:iam::111122223333:policy/SomePolicy"),
+			},
+			Effect: "Allow",
+		}
+	}
+
+	mfa := rule("AWS[arn:aws:iam::111122223333:role/Ops]", "s3:PutObject", "arn:aws:s3:::bucket/*")
+	mfa.Conditions = []model.Condition{{Operator: "Bool", Key: "aws:MultiFactorAuthPresent", Values: []string{"true"}}}
+	denied := rule("AWS[arn:aws:iam::111122223333:role/Ops]", "*", "*")
+	denied.Effect = "Deny"
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{
+		rule("AWS[arn:aws:iam::111122223333:role/Dev]", "s3:GetObject", "arn:aws:s3:::bucket/*"),
+		rule("AWS[arn:aws:iam::444455556666:root]", "iam:PassRole", "*"),
+		rule("AWS[arn:aws:iam::444455556666:root]", "ec2:RunInstances", "*"),
+		rule("AWS[arn:aws:iam::444455556666:root]", "s3:*", "*"),
+		mfa,
+		denied,
+	}))
+
+	scores, err := NewAccessControlService(nil, cache).RiskScores(nil, false)
+
+	require.Nil(t, err)
+	require.Equal(t, []model.RiskScore{
+		{
+			Principal: model.Principal{ID: "AWS[arn:aws:iam::444455556666:root]"},
+			Score:     85,
+			Factors: []model.RiskContribution{
+				{Factor: model.RiskEscalation, Count: 1},
+				{Factor: model.RiskPermissionsManagement, Count: 1},
+				{Factor: model.RiskCrossAccount, Count: 3},
+				{Factor: model.RiskWildcardAction, Count: 1},
+				{Factor: model.RiskNoMFA, Count: 3},
+				{Factor: model.RiskWildcardResource, Count: 3},
+				{Factor: model.RiskWriteAccess, Count: 3},
+			},
+		},
+		{
+			Principal: model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Ops]"},
+			Score:     5,
+			Factors:   []model.RiskContribution{{Factor: model.RiskWriteAccess, Count: 1}},
+		},
+		{
+			Principal: model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Dev]"},
+		},
+	}, scores)
+
+	scores, err = NewAccessControlService(nil, cache).RiskScores([]string{"AWS[arn:aws:iam::111122223333:role/Dev]"}, true)
+	require.Nil(t, err)
+	require.Len(t, scores, 1)
+}
@@ -0,0 +1,259 @@
+package iamsnitch
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+// collapseThreshold is how many resources under a common parent, or actions
+// of a service starting with the same verb, are replaced by a wildcard. A
+// wildcard is only used when the principal is already allowed everything it
+// covers, so a suggestion never grants more than the current policies.
+const collapseThreshold = 3
+
+// actionVerb is the verb an action name starts with, such as Get, List or
+// Describe.
+var actionVerb = regexp.MustCompile(`^[A-Z][a-z]+`)
+
+// SuggestPolicy builds the least privilege policy that still allows what the
+// principal was recorded doing since the given time, and diffs it against
+// the access its current policies allow. Usage that doesn't name a resource
+// keeps the resource of the rule that allowed it, and usage only conditional
+// rules allow keeps their conditions.
+func (a *AccessControlService) SuggestPolicy(principal string, exact bool, since time.Time) (*model.PolicySuggestion, error) {
+	rules, err := a.WhatCan([]string{principal}, exact)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := a.cache.FindUsage(since)
+	if err != nil {
+		return nil, err
+	}
+	byIdentity := make(map[string][]model.Usage)
+	for _, u := range usage {
+		byIdentity[u.Identity] = append(byIdentity[u.Identity], u)
+	}
+
+	// usage allowed unconditionally needs no condition, otherwise it keeps
+	// the conditions of every rule that could have allowed it
+	via := make(map[model.Access]map[string][]model.Condition)
+	for _, r := range rules {
+		for _, u := range byIdentity[r.Identity()] {
+			if !u.Exercises(&r) {
+				continue
+			}
+			// usage of a whole service only tells the rule was used, not
+			// which of its actions
+			access := model.Access{Action: u.Action, Resource: u.Resource}
+			if u.ServiceLevel() {
+				access.Action = r.Permission.ID
+			}
+			if access.Resource == "" {
+				access.Resource = r.Resource.ID
+			}
+			if via[access] == nil {
+				via[access] = make(map[string][]model.Condition)
+			}
+			via[access][model.FormatConditions(r.Conditions)] = r.Conditions
+		}
+	}
+
+	conditions := make(map[string][]model.Condition)
+	used := make(map[string]map[string]map[string]bool)
+	for access, byCondition := range via {
+		if _, ok := byCondition[""]; ok {
+			byCondition = map[string][]model.Condition{"": nil}
+		}
+		for condition, c := range byCondition {
+			conditions[condition] = c
+			if used[condition] == nil {
+				used[condition] = make(map[string]map[string]bool)
+			}
+			if used[condition][access.Action] == nil {
+				used[condition][access.Action] = make(map[string]bool)
+			}
+			used[condition][access.Action][access.Resource] = true
+		}
+	}
+
+	granted := func(condition string, action string, resource string) bool {
+		for _, r := range rules {
+			if model.FormatConditions(r.Conditions) == condition &&
+				wildcard.Covers(strings.ToLower(r.Permission.ID), strings.ToLower(action)) &&
+				wildcard.Covers(r.Resource.ID, resource) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// actions used on the same resources under the same conditions share a
+	// statement
+	statements := make(map[string]*model.SuggestedStatement)
+	for condition, actions := range used {
+		for action, resources := range actions {
+			collapsed := collapseResources(resources, func(resource string) bool {
+				return granted(condition, action, resource)
+			})
+			key := condition + "\n" + strings.Join(collapsed, "\n")
+			if statements[key] == nil {
+				statements[key] = &model.SuggestedStatement{Resources: collapsed, Conditions: conditions[condition]}
+			}
+			statements[key].Actions = append(statements[key].Actions, action)
+		}
+	}
+
+	s := &model.PolicySuggestion{Principal: principal, Since: since}
+	for _, st := range statements {
+		condition := model.FormatConditions(st.Conditions)
+		st.Actions = collapseActions(st.Actions, func(action string) bool {
+			for _, r := range st.Resources {
+				if !granted(condition, action, r) {
+					return false
+				}
+			}
+			return true
+		})
+		s.Statements = append(s.Statements, *st)
+	}
+	sort.Slice(s.Statements, func(i, j int) bool {
+		si, sj := s.Statements[i], s.Statements[j]
+		if si.Actions[0] != sj.Actions[0] {
+			return si.Actions[0] < sj.Actions[0]
+		}
+		return model.FormatConditions(si.Conditions) < model.FormatConditions(sj.Conditions)
+	})
+
+	s.Diff = diffAccess(rules, s.Statements)
+	return s, nil
+}
+
+// collapseResources replaces the resources sharing a parent path with a
+// wildcard under it when there are enough of them and allowed accepts it,
+// then drops the resources covered by another.
+func collapseResources(resources map[string]bool, allowed func(string) bool) []string {
+	byParent := make(map[string][]string)
+	for r := range resources {
+		parent := r[:strings.LastIndexAny(r, "/:")+1]
+		byParent[parent] = append(byParent[parent], r)
+	}
+
+	var collapsed []string
+	for parent, children := range byParent {
+		if candidate := parent + "*"; len(children) >= collapseThreshold && allowed(candidate) {
+			collapsed = append(collapsed, candidate)
+			continue
+		}
+		collapsed = append(collapsed, children...)
+	}
+	return dropCovered(collapsed, wildcard.Covers)
+}
+
+// collapseActions replaces the actions of a service starting with the same
+// verb with a wildcard after it when there are enough of them and allowed
+// accepts it, then drops the actions covered by another.
+func collapseActions(actions []string, allowed func(string) bool) []string {
+	byVerb := make(map[string][]string)
+	for _, a := range actions {
+		prefix := a
+		if i := strings.IndexByte(a, ':'); i >= 0 {
+			prefix = a[:i+1] + actionVerb.FindString(a[i+1:])
+		}
+		byVerb[prefix] = append(byVerb[prefix], a)
+	}
+
+	var collapsed []string
+	for prefix, verbActions := range byVerb {
+		if candidate := prefix + "*"; !strings.HasSuffix(prefix, ":") &&
+			len(verbActions) >= collapseThreshold && allowed(candidate) {
+			collapsed = append(collapsed, candidate)
+			continue
+		}
+		collapsed = append(collapsed, verbActions...)
+	}
+	return dropCovered(collapsed, func(pattern, action string) bool {
+		return wildcard.Covers(strings.ToLower(pattern), strings.ToLower(action))
+	})
+}
+
+// dropCovered sorts the values, leaving out the ones another value covers.
+func dropCovered(values []string, covers func(string, string) bool) []string {
+	sort.Strings(values)
+	kept := make([]string, 0, len(values))
+	for i, v := range values {
+		covered := false
+		for j, other := range values {
+			if i != j && covers(other, v) && (!covers(v, other) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// diffAccess compares the access allowed by the rules with the access of the
+// statements, ordered by action, resource and condition. Access is only kept
+// under the same conditions.
+func diffAccess(rules []model.AccessControlRule, statements []model.SuggestedStatement) []model.AccessChange {
+	suggested := make(map[model.Access]bool)
+	for _, st := range statements {
+		condition := model.FormatConditions(st.Conditions)
+		for _, a := range st.Actions {
+			for _, r := range st.Resources {
+				suggested[model.Access{Action: a, Resource: r, Condition: condition}] = true
+			}
+		}
+	}
+
+	var diff []model.AccessChange
+	current := make(map[model.Access]bool)
+	seen := make(map[model.AccessChange]bool)
+	for _, r := range rules {
+		access := model.Access{
+			Action:    r.Permission.ID,
+			Resource:  r.Resource.ID,
+			Condition: model.FormatConditions(r.Conditions),
+		}
+		current[access] = true
+		c := model.AccessChange{Op: model.AccessRemoved, Access: access, Policy: grantChainPolicy(r.GrantChain)}
+		if suggested[access] {
+			c.Op = model.AccessKept
+		}
+		if !seen[c] {
+			seen[c] = true
+			diff = append(diff, c)
+		}
+	}
+	for access := range suggested {
+		if !current[access] {
+			diff = append(diff, model.AccessChange{Op: model.AccessAdded, Access: access})
+		}
+	}
+
+	sort.Slice(diff, func(i, j int) bool {
+		di, dj := diff[i], diff[j]
+		if di.Access != dj.Access {
+			if di.Access.Action != dj.Access.Action {
+				return di.Access.Action < dj.Access.Action
+			}
+			if di.Access.Resource != dj.Access.Resource {
+				return di.Access.Resource < dj.Access.Resource
+			}
+			return di.Access.Condition < dj.Access.Condition
+		}
+		if di.Op != dj.Op {
+			return di.Op < dj.Op
+		}
+		return di.Policy < dj.Policy
+	})
+	return diff
+}
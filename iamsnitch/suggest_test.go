@@ -0,0 +1,183 @@
+package iamsnitch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestPolicy(t *testing.T) {
+	role := "arn:aws:iam::111122223333:role/Dev"
+	policy := "arn:aws:iam::111122223333:policy/Dev"
+	rule := func(permission string, resource string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: resource},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant(role),
+				model.NewPolicyGrant(policy),
+			},
+			Effect: "Allow",
+		}
+	}
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{
+		rule("s3:*", "arn:aws:s3:::bucket/*"),
+		rule("ec2:Describe*", "*"),
+		rule("sqs:SendMessage", "arn:aws:sqs:us-east-1:111122223333:queue"),
+		rule("dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/a"),
+		rule("dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/b"),
+		rule("dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/c"),
+	}))
+
+	now := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	used := func(action string, resource string) model.Usage {
+		return model.Usage{Identity: role, Action: action, Resource: resource, LastUsed: now}
+	}
+	require.Nil(t, cache.SaveUsage([]model.Usage{
+		// enough objects of a folder to collapse them
+		used("s3:GetObject", "arn:aws:s3:::bucket/logs/1"),
+		used("s3:GetObject", "arn:aws:s3:::bucket/logs/2"),
+		used("s3:GetObject", "arn:aws:s3:::bucket/logs/3"),
+		used("s3:PutObject", "arn:aws:s3:::bucket/out/1"),
+		// enough verbs to collapse them, on the resource of the rule
+		used("ec2:DescribeInstances", ""),
+		used("ec2:DescribeVolumes", ""),
+		used("ec2:DescribeImages", ""),
+		// not collapsed into table/* since it isn't granted
+		used("dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/a"),
+		used("dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/b"),
+		used("dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/c"),
+		// too old
+		{Identity: role, Action: "sqs:SendMessage", LastUsed: now.Add(-100 * 24 * time.Hour)},
+	}))
+
+	since := now.Add(-90 * 24 * time.Hour)
+	s, err := NewAccessControlService(nil, cache).SuggestPolicy("AWS[arn:aws:iam::111122223333:root]", true, since)
+	require.Nil(t, err)
+
+	require.Equal(t, []model.SuggestedStatement{
+		{
+			Actions: []string{"dynamodb:GetItem"},
+			Resources: []string{
+				"arn:aws:dynamodb:us-east-1:111122223333:table/a",
+				"arn:aws:dynamodb:us-east-1:111122223333:table/b",
+				"arn:aws:dynamodb:us-east-1:111122223333:table/c",
+			},
+		},
+		{Actions: []string{"ec2:Describe*"}, Resources: []string{"*"}},
+		{Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::bucket/logs/*"}},
+		{Actions: []string{"s3:PutObject"}, Resources: []string{"arn:aws:s3:::bucket/out/1"}},
+	}, s.Statements)
+
+	change := func(op string, action string, resource string, policy string) model.AccessChange {
+		return model.AccessChange{Op: op, Access: model.Access{Action: action, Resource: resource}, Policy: policy}
+	}
+	require.Equal(t, []model.AccessChange{
+		change(model.AccessKept, "dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/a", policy),
+		change(model.AccessKept, "dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/b", policy),
+		change(model.AccessKept, "dynamodb:GetItem", "arn:aws:dynamodb:us-east-1:111122223333:table/c", policy),
+		change(model.AccessKept, "ec2:Describe*", "*", policy),
+		change(model.AccessRemoved, "s3:*", "arn:aws:s3:::bucket/*", policy),
+		change(model.AccessAdded, "s3:GetObject", "arn:aws:s3:::bucket/logs/*", ""),
+		change(model.AccessAdded, "s3:PutObject", "arn:aws:s3:::bucket/out/1", ""),
+		change(model.AccessRemoved, "sqs:SendMessage", "arn:aws:sqs:us-east-1:111122223333:queue", policy),
+	}, s.Diff)
+}
+
+func TestSuggestPolicyConditions(t *testing.T) {
+	role := "arn:aws:iam::111122223333:role/Dev"
+	policy := "arn:aws:iam::111122223333:policy/Dev"
+	mfa := []model.Condition{{Operator: "Bool", Key: "aws:MultiFactorAuthPresent", Values: []string{"true"}}}
+	rule := func(permission string, resource string, conditions []model.Condition) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: resource},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant(role),
+				model.NewPolicyGrant(policy),
+			},
+			Effect:     "Allow",
+			Conditions: conditions,
+		}
+	}
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{
+		rule("s3:GetObject", "arn:aws:s3:::bucket/*", mfa),
+		rule("sqs:SendMessage", "arn:aws:sqs:us-east-1:111122223333:*", mfa),
+		rule("sqs:SendMessage", "arn:aws:sqs:us-east-1:111122223333:queue", nil),
+	}))
+
+	now := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	require.Nil(t, cache.SaveUsage([]model.Usage{
+		// only allowed with MFA
+		{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key", LastUsed: now},
+		// allowed without MFA as well
+		{Identity: role, Action: "sqs:SendMessage", Resource: "arn:aws:sqs:us-east-1:111122223333:queue", LastUsed: now},
+	}))
+
+	s, err := NewAccessControlService(nil, cache).SuggestPolicy("AWS[arn:aws:iam::111122223333:root]", true, now.Add(-time.Hour))
+	require.Nil(t, err)
+
+	require.Equal(t, []model.SuggestedStatement{
+		{Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::bucket/key"}, Conditions: mfa},
+		{Actions: []string{"sqs:SendMessage"}, Resources: []string{"arn:aws:sqs:us-east-1:111122223333:queue"}},
+	}, s.Statements)
+
+	condition := "Bool aws:MultiFactorAuthPresent=true"
+	change := func(op string, action string, resource string, condition string, policy string) model.AccessChange {
+		return model.AccessChange{
+			Op:     op,
+			Access: model.Access{Action: action, Resource: resource, Condition: condition},
+			Policy: policy,
+		}
+	}
+	require.Equal(t, []model.AccessChange{
+		change(model.AccessRemoved, "s3:GetObject", "arn:aws:s3:::bucket/*", condition, policy),
+		change(model.AccessAdded, "s3:GetObject", "arn:aws:s3:::bucket/key", condition, ""),
+		change(model.AccessRemoved, "sqs:SendMessage", "arn:aws:sqs:us-east-1:111122223333:*", condition, policy),
+		change(model.AccessKept, "sqs:SendMessage", "arn:aws:sqs:us-east-1:111122223333:queue", "", policy),
+	}, s.Diff)
+}
+
+func TestSuggestPolicyServiceUsage(t *testing.T) {
+	role := "arn:aws:iam::111122223333:role/Dev"
+	policy := "arn:aws:iam::111122223333:policy/Dev"
+	rule := func(permission string, resource string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: resource},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant(role),
+				model.NewPolicyGrant(policy),
+			},
+			Effect: "Allow",
+		}
+	}
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{
+		rule("sqs:SendMessage", "arn:aws:sqs:us-east-1:111122223333:queue"),
+		rule("s3:GetObject", "arn:aws:s3:::bucket/*"),
+	}))
+
+	// Access Advisor only tells the service was used, which keeps its rules
+	// without granting the rest of the service
+	now := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	require.Nil(t, cache.SaveUsage([]model.Usage{{Identity: role, Action: "sqs:*", LastUsed: now}}))
+
+	s, err := NewAccessControlService(nil, cache).SuggestPolicy("AWS[arn:aws:iam::111122223333:root]", true, now.Add(-time.Hour))
+	require.Nil(t, err)
+
+	require.Equal(t, []model.SuggestedStatement{
+		{Actions: []string{"sqs:SendMessage"}, Resources: []string{"arn:aws:sqs:us-east-1:111122223333:queue"}},
+	}, s.Statements)
+}
@@ -0,0 +1,29 @@
+package iamsnitch
+
+import "github.com/jeandreh/iam-snitch/internal/domain/model"
+
+// Summary aggregates the cached rules, keeping the top groups of each
+// aggregate, or all of them when top is 0.
+func (a *AccessControlService) Summary(top int) (*model.Summary, error) {
+	s := &model.Summary{}
+	writes := []model.AccessLevel{model.Write, model.PermissionsManagement}
+	aggregates := []struct {
+		agg  model.Aggregation
+		dest *[]model.Group
+	}{
+		{model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByPermission}, &s.ActionsPerPrincipal},
+		{model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByPermission, Levels: writes}, &s.WritersPerPrincipal},
+		{model.Aggregation{GroupBy: model.ByPolicy, Count: model.ByPrincipal}, &s.PrincipalsPerPolicy},
+		{model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByService}, &s.ServicesPerPrincipal},
+	}
+
+	for _, ag := range aggregates {
+		ag.agg.Limit = top
+		groups, err := a.cache.Aggregate(&model.Filter{}, &ag.agg)
+		if err != nil {
+			return nil, err
+		}
+		*ag.dest = groups
+	}
+	return s, nil
+}
@@ -0,0 +1,40 @@
+package iamsnitch
+
+import (
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	rule := func(principal string, permission string, policy string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: principal},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: "*"},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+				model.NewPolicyGrant(policy),
+			},
+		}
+	}
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{
+		rule("AWS[a]", "s3:GetObject", "arn:aws:iam::aws:policy/ReadOnlyAccess"),
+		rule("AWS[b]", "s3:GetObject", "arn:aws:iam::aws:policy/ReadOnlyAccess"),
+		rule("AWS[b]", "sqs:SendMessage", "arn:aws:iam::111122223333:policy/Queue"),
+	}))
+
+	s, err := NewAccessControlService(nil, cache).Summary(1)
+
+	require.Nil(t, err)
+	require.Equal(t, &model.Summary{
+		ActionsPerPrincipal:  []model.Group{{Key: "AWS[b]", Count: 2, Values: []string{"s3:GetObject", "sqs:SendMessage"}}},
+		WritersPerPrincipal:  []model.Group{{Key: "AWS[b]", Count: 1, Values: []string{"sqs:SendMessage"}}},
+		PrincipalsPerPolicy:  []model.Group{{Key: "arn:aws:iam::aws:policy/ReadOnlyAccess", Count: 2, Values: []string{"AWS[a]", "AWS[b]"}}},
+		ServicesPerPrincipal: []model.Group{{Key: "AWS[b]", Count: 2, Values: []string{"s3", "sqs"}}},
+	}, s)
+}
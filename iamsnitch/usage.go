@@ -0,0 +1,112 @@
+package iamsnitch
+
+import (
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+// RefreshUsage records the usage found in the logs of the provider, such as
+// CloudTrail logs.
+func (a *AccessControlService) RefreshUsage(provider ports.UsageProviderIface) (err error) {
+	var nextPage ports.PageIface
+	var usage []model.Usage
+
+	for ok := true; ok; ok = nextPage.HasNext() {
+		usage, nextPage, err = provider.FetchUsage(nextPage)
+		if err != nil {
+			return err
+		}
+
+		if err = a.cache.SaveUsage(usage); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WhatCanUnusedEach streams the page of the WhatCan rules that no usage
+// recorded at or after since exercises, i.e. the permissions that could be
+// removed without breaking what the principals have been doing.
+func (a *AccessControlService) WhatCanUnusedEach(principals []string, exact bool, since time.Time, page model.Page, fn func(model.AccessControlRule) error) error {
+	if err := page.Validate(); err != nil {
+		return err
+	}
+
+	usage, err := a.cache.FindUsage(since)
+	if err != nil {
+		return err
+	}
+	byIdentity := make(map[string][]model.Usage)
+	for _, u := range usage {
+		byIdentity[u.Identity] = append(byIdentity[u.Identity], u)
+	}
+
+	unused := func(r *model.AccessControlRule) bool {
+		for _, u := range byIdentity[r.Identity()] {
+			if u.Exercises(r) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a.findPage(&model.Filter{
+		Principals: principals,
+		ExactMatch: exact,
+		Page:       model.Page{Sort: page.Sort, After: page.After},
+	}, page, unused, fn)
+}
+
+// LastUsed tells when the cached rules were last exercised, from the usage
+// loaded from CloudTrail or Access Advisor, and when the roles they act as
+// were last used, as reported by IAM.
+type LastUsed struct {
+	byIdentity map[string][]model.Usage
+	roles      map[string]*time.Time
+}
+
+// LastUsed loads every recorded usage and role for lookups.
+func (a *AccessControlService) LastUsed() (*LastUsed, error) {
+	usage, err := a.cache.FindUsage(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	roles, err := a.cache.FindRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LastUsed{
+		byIdentity: make(map[string][]model.Usage),
+		roles:      make(map[string]*time.Time, len(roles)),
+	}
+	for _, u := range usage {
+		l.byIdentity[u.Identity] = append(l.byIdentity[u.Identity], u)
+	}
+	for _, r := range roles {
+		l.roles[r.ARN] = r.LastUsed
+	}
+	return l, nil
+}
+
+// Rule returns the time of the latest usage the rule allows, nil when none
+// was recorded.
+func (l *LastUsed) Rule(r *model.AccessControlRule) *time.Time {
+	var last *time.Time
+	for _, u := range l.byIdentity[r.Identity()] {
+		if u.Exercises(r) && (last == nil || u.LastUsed.After(*last)) {
+			t := u.LastUsed
+			last = &t
+		}
+	}
+	return last
+}
+
+// Role returns when the role the rule acts as was last used, nil when it
+// never was or the role wasn't refreshed.
+func (l *LastUsed) Role(r *model.AccessControlRule) *time.Time {
+	return l.roles[r.Identity()]
+}
@@ -0,0 +1,126 @@
+package iamsnitch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/aws"
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshUsage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	day := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	first := []model.Usage{{Identity: "a", Action: "s3:GetObject", LastUsed: day}}
+	second := []model.Usage{{Identity: "b", Action: "s3:PutObject", LastUsed: day}}
+
+	next := "1"
+	provider := mocks.NewUsageProviderMock(ctrl)
+	gomock.InOrder(
+		provider.EXPECT().FetchUsage(nil).Return(first, aws.NewPageToken(&next), nil),
+		provider.EXPECT().FetchUsage(aws.NewPageToken(&next)).Return(second, aws.NewPageToken(nil), nil),
+	)
+
+	cache := memory.New()
+	require.Nil(t, NewAccessControlService(nil, cache).RefreshUsage(provider))
+
+	got, err := cache.FindUsage(day)
+	require.Nil(t, err)
+	require.Equal(t, append(first, second...), got)
+}
+
+func TestWhatCanUnusedEach(t *testing.T) {
+	rule := func(permission string, resource string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: resource},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant("arn:aws:iam::111122223333:role/Dev"),
+				model.NewPolicyGrant("arn:aws:iam::111122223333:policy/Dev"),
+			},
+			Effect: "Allow",
+		}
+	}
+	read := rule("s3:Get*", "arn:aws:s3:::bucket/*")
+	write := rule("s3:PutObject", "arn:aws:s3:::bucket/*")
+	queue := rule("sqs:SendMessage", "*")
+	denied := rule("s3:DeleteObject", "*")
+	denied.Effect = "Deny"
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{read, write, queue, denied}))
+
+	now := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	require.Nil(t, cache.SaveUsage([]model.Usage{
+		{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key", LastUsed: now},
+		// too old to count
+		{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "s3:PutObject", LastUsed: now.Add(-100 * 24 * time.Hour)},
+		// another role
+		{Identity: "arn:aws:iam::111122223333:role/Ops", Action: "sqs:SendMessage", LastUsed: now},
+	}))
+
+	service := NewAccessControlService(nil, cache)
+	since := now.Add(-90 * 24 * time.Hour)
+
+	var unused []model.AccessControlRule
+	err := service.WhatCanUnusedEach(nil, false, since, model.Page{Sort: model.SortByPermission}, func(r model.AccessControlRule) error {
+		unused = append(unused, r)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{write, queue}, unused)
+
+	unused = nil
+	err = service.WhatCanUnusedEach(nil, false, since, model.Page{Sort: model.SortByPermission, Offset: 1, Limit: 1}, func(r model.AccessControlRule) error {
+		unused = append(unused, r)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{queue}, unused)
+}
+
+func TestLastUsed(t *testing.T) {
+	dev := "arn:aws:iam::111122223333:role/Dev"
+	rule := func(role string, permission string) *model.AccessControlRule {
+		return &model.AccessControlRule{
+			Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: "*"},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant(role),
+				model.NewPolicyGrant("arn:aws:iam::111122223333:policy/Dev"),
+			},
+			Effect: "Allow",
+		}
+	}
+
+	older := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	cache := memory.New()
+	require.Nil(t, cache.SaveRoles([]model.Role{{ARN: dev, Name: "Dev", LastUsed: &newer}}))
+	require.Nil(t, cache.SaveUsage([]model.Usage{
+		{Identity: dev, Action: "s3:*", LastUsed: older},
+		{Identity: dev, Action: "s3:GetObject", LastUsed: newer},
+	}))
+
+	lastUsed, err := NewAccessControlService(nil, cache).LastUsed()
+	require.Nil(t, err)
+
+	require.Equal(t, &newer, lastUsed.Rule(rule(dev, "s3:GetObject")))
+	// usage of the whole service exercises every rule of the service
+	require.Equal(t, &older, lastUsed.Rule(rule(dev, "s3:PutObject")))
+	require.Equal(t, &newer, lastUsed.Rule(rule(dev, "s3:*")))
+	require.Nil(t, lastUsed.Rule(rule(dev, "sqs:SendMessage")))
+	require.Equal(t, &newer, lastUsed.Role(rule(dev, "sqs:SendMessage")))
+
+	other := rule("arn:aws:iam::111122223333:role/Ops", "s3:GetObject")
+	require.Nil(t, lastUsed.Rule(other))
+	require.Nil(t, lastUsed.Role(other))
+}
@@ -0,0 +1,102 @@
+package iamsnitch
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+// WhatIf applies the overlay to the cached rules of a role and returns the
+// access it gains and loses, leaving the cache untouched. Access still
+// granted through another policy isn't a change. Only the principals assuming
+// the role directly are compared, access reaching it through other roles is
+// left out on both sides since the overlay doesn't rebuild their chains.
+func (a *AccessControlService) WhatIf(roleARN string, overlay ports.OverlayIface) ([]model.RuleChange, error) {
+	roles, err := a.cache.FindRoles()
+	if err != nil {
+		return nil, err
+	}
+	var role *model.Role
+	for i := range roles {
+		if roles[i].ARN == roleARN {
+			role = &roles[i]
+			break
+		}
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %v not found in cache, run iamsnitch refresh", roleARN)
+	}
+
+	var current []model.AccessControlRule
+	// the overlay rebuilds the Deny rules too, they're compared like the others
+	filter := &model.Filter{Via: model.Via{Roles: []string{roleARN}}, ExactMatch: true, IncludeDeny: true}
+	err = a.cache.FindEach(filter, func(r model.AccessControlRule) error {
+		// the role may be an intermediate step of the chain, or reached
+		// through another role whose principal it doesn't trust
+		if directGrant(&r, roleARN) {
+			current = append(current, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := a.cache.FindPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	rebuilt, err := overlay.Rebuild(role, current, policies)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := append(ruleChanges(model.AccessRemoved, current, rebuilt), ruleChanges(model.AccessAdded, rebuilt, current)...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		ri, rj := &changes[i].Rule, &changes[j].Rule
+		if ri.Principal.ID != rj.Principal.ID {
+			return ri.Principal.ID < rj.Principal.ID
+		}
+		if ri.Permission.ID != rj.Permission.ID {
+			return ri.Permission.ID < rj.Permission.ID
+		}
+		if ri.Resource.ID != rj.Resource.ID {
+			return ri.Resource.ID < rj.Resource.ID
+		}
+		return changes[i].Op < changes[j].Op
+	})
+	return changes, nil
+}
+
+// directGrant reports whether the rule lets its principal act as the role by
+// assuming it directly.
+func directGrant(r *model.AccessControlRule, roleARN string) bool {
+	return len(r.GrantChain) > 0 && r.GrantChain[0] == model.NewRoleGrant(roleARN) && r.Identity() == roleARN
+}
+
+// ruleChanges returns the rules granting access none of the others grant,
+// once per access.
+func ruleChanges(op string, rules []model.AccessControlRule, others []model.AccessControlRule) []model.RuleChange {
+	kept := make(map[string]bool, len(others))
+	for i := range others {
+		kept[ruleAccess(&others[i])] = true
+	}
+
+	var changes []model.RuleChange
+	for _, r := range rules {
+		access := ruleAccess(&r)
+		if kept[access] {
+			continue
+		}
+		kept[access] = true
+		changes = append(changes, model.RuleChange{Op: op, Rule: r, Policy: grantChainPolicy(r.GrantChain)})
+	}
+	return changes
+}
+
+func ruleAccess(r *model.AccessControlRule) string {
+	return fmt.Sprintf("%v\x00%v\x00%v\x00%v\x00%v", r.Effect, r.Principal.ID, r.Permission.ID, r.Resource.ID, model.FormatConditions(r.Conditions))
+}
@@ -0,0 +1,124 @@
+package iamsnitch
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhatIf(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dev := "arn:aws:iam::111122223333:role/Dev"
+	rule := func(principal string, roles []string, policy string, permission string) model.AccessControlRule {
+		var chain []model.GrantIface
+		for _, r := range roles {
+			chain = append(chain, model.NewRoleGrant(r))
+		}
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: principal},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: "*"},
+			GrantChain: append(chain, model.NewPolicyGrant(policy)),
+			Effect:     "Allow",
+		}
+	}
+	root := "AWS[arn:aws:iam::111122223333:root]"
+	read := rule(root, []string{dev}, "arn:aws:iam::111122223333:policy/Read", "s3:GetObject")
+	write := rule(root, []string{dev}, "arn:aws:iam::111122223333:policy/Write", "s3:PutObject")
+	// acts as the Ops role through Dev, Ops' rules don't change
+	ops := rule(root, []string{dev, "arn:aws:iam::111122223333:role/Ops"}, "arn:aws:iam::111122223333:policy/Ops", "ec2:*")
+	// acts as Dev through the Jump role, Dev doesn't trust it directly
+	partner := "AWS[arn:aws:iam::444455556666:root]"
+	jump := rule(partner, []string{"arn:aws:iam::111122223333:role/Jump", dev}, "arn:aws:iam::111122223333:policy/Write", "s3:PutObject")
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveRoles([]model.Role{{ARN: dev, Name: "Dev"}}))
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{read, write, ops, jump}))
+
+	// s3:GetObject moves to another policy, s3:PutObject goes away
+	moved := rule(root, []string{dev}, "policy.json", "s3:GetObject")
+	queue := rule(root, []string{dev}, "policy.json", "sqs:SendMessage")
+	overlay := mocks.NewOverlayMock(ctrl)
+	overlay.
+		EXPECT().
+		Rebuild(&model.Role{ARN: dev, Name: "Dev"}, []model.AccessControlRule{read, write}, gomock.Any()).
+		Return([]model.AccessControlRule{moved, queue}, nil)
+
+	changes, err := NewAccessControlService(nil, cache).WhatIf(dev, overlay)
+	require.Nil(t, err)
+	require.Equal(t, []model.RuleChange{
+		{Op: model.AccessRemoved, Rule: write, Policy: "arn:aws:iam::111122223333:policy/Write"},
+		{Op: model.AccessAdded, Rule: queue, Policy: "policy.json"},
+	}, changes)
+
+	// a new trust policy doesn't drop the principals reaching Dev through Jump
+	lambda := "Service[lambda.amazonaws.com]"
+	overlay.
+		EXPECT().
+		Rebuild(&model.Role{ARN: dev, Name: "Dev"}, []model.AccessControlRule{read, write}, gomock.Any()).
+		Return([]model.AccessControlRule{
+			rule(lambda, []string{dev}, "arn:aws:iam::111122223333:policy/Read", "s3:GetObject"),
+			rule(lambda, []string{dev}, "arn:aws:iam::111122223333:policy/Write", "s3:PutObject"),
+		}, nil)
+
+	changes, err = NewAccessControlService(nil, cache).WhatIf(dev, overlay)
+	require.Nil(t, err)
+	require.Equal(t, []model.RuleChange{
+		{Op: model.AccessRemoved, Rule: read, Policy: "arn:aws:iam::111122223333:policy/Read"},
+		{Op: model.AccessRemoved, Rule: write, Policy: "arn:aws:iam::111122223333:policy/Write"},
+		{
+			Op:     model.AccessAdded,
+			Rule:   rule(lambda, []string{dev}, "arn:aws:iam::111122223333:policy/Read", "s3:GetObject"),
+			Policy: "arn:aws:iam::111122223333:policy/Read",
+		},
+		{
+			Op:     model.AccessAdded,
+			Rule:   rule(lambda, []string{dev}, "arn:aws:iam::111122223333:policy/Write", "s3:PutObject"),
+			Policy: "arn:aws:iam::111122223333:policy/Write",
+		},
+	}, changes)
+
+	_, err = NewAccessControlService(nil, cache).WhatIf("arn:aws:iam::111122223333:role/Missing", overlay)
+	require.EqualError(t, err, "role arn:aws:iam::111122223333:role/Missing not found in cache, run iamsnitch refresh")
+}
+
+func TestWhatIfConditions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dev := "arn:aws:iam::111122223333:role/Dev"
+	read := model.AccessControlRule{
+		Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+		Permission: model.Permission{ID: "s3:GetObject"},
+		Resource:   model.Resource{ID: "*"},
+		GrantChain: []model.GrantIface{model.NewRoleGrant(dev), model.NewPolicyGrant("arn:aws:iam::111122223333:policy/Read")},
+		Effect:     "Allow",
+	}
+
+	cache := memory.New()
+	require.Nil(t, cache.SaveRoles([]model.Role{{ARN: dev, Name: "Dev"}}))
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{read}))
+
+	// the same access only with MFA is a change
+	mfa := read
+	mfa.GrantChain = []model.GrantIface{model.NewRoleGrant(dev), model.NewPolicyGrant("policy.json")}
+	mfa.Conditions = []model.Condition{{Operator: "Bool", Key: "aws:MultiFactorAuthPresent", Values: []string{"true"}}}
+	overlay := mocks.NewOverlayMock(ctrl)
+	overlay.
+		EXPECT().
+		Rebuild(&model.Role{ARN: dev, Name: "Dev"}, []model.AccessControlRule{read}, gomock.Any()).
+		Return([]model.AccessControlRule{mfa}, nil)
+
+	changes, err := NewAccessControlService(nil, cache).WhatIf(dev, overlay)
+	require.Nil(t, err)
+	require.Equal(t, []model.RuleChange{
+		{Op: model.AccessAdded, Rule: mfa, Policy: "policy.json"},
+		{Op: model.AccessRemoved, Rule: read, Policy: "arn:aws:iam::111122223333:policy/Read"},
+	}, changes)
+}
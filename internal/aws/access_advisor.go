@@ -0,0 +1,129 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/sirupsen/logrus"
+)
+
+// FetchUsage collects the Access Advisor last accessed data of a page of
+// roles. A service the role used is recorded as used through any of its
+// actions, svc:*, since most of them aren't tracked individually; the
+// actions IAM does track are recorded on top of it. Access Advisor doesn't
+// tell resources, so none is recorded.
+func (a *IAMProvider) FetchUsage(page ports.PageIface) ([]model.Usage, ports.PageIface, error) {
+	roles, nextPage, err := a.fetchRoles(page)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"page":  page,
+			"error": err,
+		}).Error("failed to fetch roles from aws")
+		return nil, nil, err
+	}
+
+	// jobs of all the roles run at the same time, then they're collected
+	jobs := make(map[string]*string, len(roles))
+	for _, role := range roles {
+		out, err := a.cli.GenerateServiceLastAccessedDetails(a.ctx, &iam.GenerateServiceLastAccessedDetailsInput{
+			Arn:         role.Arn,
+			Granularity: types.AccessAdvisorUsageGranularityTypeActionLevel,
+		})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"role":  *role.Arn,
+				"error": err,
+			}).Error("failed to generate last accessed details")
+			return nil, nil, err
+		}
+		jobs[*role.Arn] = out.JobId
+	}
+
+	var usage []model.Usage
+	for _, role := range roles {
+		services, err := a.fetchLastAccessed(jobs[*role.Arn])
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"role":  *role.Arn,
+				"error": err,
+			}).Error("failed to fetch last accessed details")
+			return nil, nil, err
+		}
+		usage = append(usage, lastAccessedUsage(*role.Arn, services)...)
+	}
+
+	fmt.Printf("last accessed details found for %v roles\n", len(jobs))
+
+	return usage, nextPage, nil
+}
+
+// fetchLastAccessed waits for the job to complete and reads all its pages.
+// A job still in progress after pollAttempts checks is given up on.
+func (a *IAMProvider) fetchLastAccessed(jobID *string) ([]types.ServiceLastAccessed, error) {
+	var services []types.ServiceLastAccessed
+	var marker *string
+	for attempts := 1; ; attempts++ {
+		out, err := a.cli.GetServiceLastAccessedDetails(a.ctx, &iam.GetServiceLastAccessedDetailsInput{
+			JobId:  jobID,
+			Marker: marker,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch out.JobStatus {
+		case types.JobStatusTypeInProgress:
+			if attempts >= a.pollAttempts {
+				return nil, fmt.Errorf("job %v still in progress after %v checks", *jobID, attempts)
+			}
+			time.Sleep(a.pollInterval)
+			continue
+		case types.JobStatusTypeFailed:
+			if out.Error != nil && out.Error.Message != nil {
+				return nil, fmt.Errorf("job %v failed: %v", *jobID, *out.Error.Message)
+			}
+			return nil, fmt.Errorf("job %v failed", *jobID)
+		}
+
+		services = append(services, out.ServicesLastAccessed...)
+		if !out.IsTruncated {
+			return services, nil
+		}
+		marker = out.Marker
+	}
+}
+
+func lastAccessedUsage(identity string, services []types.ServiceLastAccessed) []model.Usage {
+	var usage []model.Usage
+	for _, s := range services {
+		if s.ServiceNamespace == nil || s.LastAuthenticated == nil {
+			continue
+		}
+		usage = append(usage, model.Usage{
+			Identity: identity,
+			Action:   *s.ServiceNamespace + ":*",
+			LastUsed: *s.LastAuthenticated,
+		})
+
+		for _, ta := range s.TrackedActionsLastAccessed {
+			if ta.ActionName == nil || ta.LastAccessedTime == nil {
+				continue
+			}
+			action := *ta.ActionName
+			if !strings.Contains(action, ":") {
+				action = *s.ServiceNamespace + ":" + action
+			}
+			usage = append(usage, model.Usage{
+				Identity: identity,
+				Action:   action,
+				LastUsed: *ta.LastAccessedTime,
+			})
+		}
+	}
+	return usage
+}
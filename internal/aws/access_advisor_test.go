@@ -0,0 +1,186 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchUsage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	iamMock := mocks.NewIAMClientMock(ctrl)
+
+	a := &IAMProvider{
+		ctx:          ctx,
+		cli:          iamMock,
+		pollAttempts: 2,
+	}
+
+	iamMock.
+		EXPECT().
+		ListRoles(gomock.Eq(ctx), gomock.Eq(&iam.ListRolesInput{})).
+		Return(&iam.ListRolesOutput{
+			Roles: []types.Role{
+				{Arn: aws.String("arn:aws:iam::111122223333:role/Dev"), RoleName: aws.String("Dev")},
+			},
+			Marker: aws.String("nextPage"),
+		}, nil)
+
+	iamMock.
+		EXPECT().
+		GenerateServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GenerateServiceLastAccessedDetailsInput{
+			Arn:         aws.String("arn:aws:iam::111122223333:role/Dev"),
+			Granularity: types.AccessAdvisorUsageGranularityTypeActionLevel,
+		})).
+		Return(&iam.GenerateServiceLastAccessedDetailsOutput{JobId: aws.String("job")}, nil)
+
+	used := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	gomock.InOrder(
+		iamMock.
+			EXPECT().
+			GetServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GetServiceLastAccessedDetailsInput{JobId: aws.String("job")})).
+			Return(&iam.GetServiceLastAccessedDetailsOutput{JobStatus: types.JobStatusTypeInProgress}, nil),
+		iamMock.
+			EXPECT().
+			GetServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GetServiceLastAccessedDetailsInput{JobId: aws.String("job")})).
+			Return(&iam.GetServiceLastAccessedDetailsOutput{
+				JobStatus: types.JobStatusTypeCompleted,
+				ServicesLastAccessed: []types.ServiceLastAccessed{
+					{
+						ServiceNamespace:  aws.String("s3"),
+						LastAuthenticated: &used,
+						TrackedActionsLastAccessed: []types.TrackedActionLastAccessed{
+							{ActionName: aws.String("CreateBucket"), LastAccessedTime: &used},
+							{ActionName: aws.String("DeleteBucket")},
+						},
+					},
+					// never used
+					{ServiceNamespace: aws.String("sqs")},
+				},
+				IsTruncated: true,
+				Marker:      aws.String("more"),
+			}, nil),
+		iamMock.
+			EXPECT().
+			GetServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GetServiceLastAccessedDetailsInput{
+				JobId:  aws.String("job"),
+				Marker: aws.String("more"),
+			})).
+			Return(&iam.GetServiceLastAccessedDetailsOutput{
+				JobStatus: types.JobStatusTypeCompleted,
+				ServicesLastAccessed: []types.ServiceLastAccessed{
+					{ServiceNamespace: aws.String("ec2"), LastAuthenticated: &used},
+				},
+			}, nil),
+	)
+
+	usage, nextPage, err := a.FetchUsage(nil)
+
+	require.Nil(t, err)
+	require.Equal(t, aws.String("nextPage"), nextPage.Next())
+	require.Equal(t, []model.Usage{
+		{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "s3:*", LastUsed: used},
+		{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "s3:CreateBucket", LastUsed: used},
+		{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "ec2:*", LastUsed: used},
+	}, usage)
+}
+
+func TestFetchUsageGenerateError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	iamMock := mocks.NewIAMClientMock(ctrl)
+
+	a := &IAMProvider{
+		ctx: ctx,
+		cli: iamMock,
+	}
+
+	iamMock.
+		EXPECT().
+		ListRoles(gomock.Eq(ctx), gomock.Eq(&iam.ListRolesInput{})).
+		Return(&iam.ListRolesOutput{
+			Roles: []types.Role{
+				{Arn: aws.String("arn:aws:iam::111122223333:role/Dev"), RoleName: aws.String("Dev")},
+				{Arn: aws.String("arn:aws:iam::111122223333:role/Broken"), RoleName: aws.String("Broken")},
+			},
+		}, nil)
+	iamMock.
+		EXPECT().
+		GenerateServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GenerateServiceLastAccessedDetailsInput{
+			Arn:         aws.String("arn:aws:iam::111122223333:role/Dev"),
+			Granularity: types.AccessAdvisorUsageGranularityTypeActionLevel,
+		})).
+		Return(&iam.GenerateServiceLastAccessedDetailsOutput{JobId: aws.String("job")}, nil)
+	// the usage of a role missing would report its rules unused
+	iamMock.
+		EXPECT().
+		GenerateServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GenerateServiceLastAccessedDetailsInput{
+			Arn:         aws.String("arn:aws:iam::111122223333:role/Broken"),
+			Granularity: types.AccessAdvisorUsageGranularityTypeActionLevel,
+		})).
+		Return(nil, errors.New("throttled"))
+
+	_, _, err := a.FetchUsage(nil)
+	require.EqualError(t, err, "throttled")
+}
+
+func TestFetchUsageJobFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	iamMock := mocks.NewIAMClientMock(ctrl)
+
+	a := &IAMProvider{
+		ctx: ctx,
+		cli: iamMock,
+	}
+
+	iamMock.
+		EXPECT().
+		GetServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GetServiceLastAccessedDetailsInput{JobId: aws.String("job")})).
+		Return(&iam.GetServiceLastAccessedDetailsOutput{
+			JobStatus: types.JobStatusTypeFailed,
+			Error:     &types.ErrorDetails{Code: aws.String("Throttling"), Message: aws.String("rate exceeded")},
+		}, nil)
+
+	_, err := a.fetchLastAccessed(aws.String("job"))
+	require.EqualError(t, err, "job job failed: rate exceeded")
+}
+
+func TestFetchUsageJobInProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	iamMock := mocks.NewIAMClientMock(ctrl)
+
+	a := &IAMProvider{
+		ctx:          ctx,
+		cli:          iamMock,
+		pollAttempts: 3,
+	}
+
+	iamMock.
+		EXPECT().
+		GetServiceLastAccessedDetails(gomock.Eq(ctx), gomock.Eq(&iam.GetServiceLastAccessedDetailsInput{JobId: aws.String("job")})).
+		Return(&iam.GetServiceLastAccessedDetailsOutput{JobStatus: types.JobStatusTypeInProgress}, nil).
+		Times(3)
+
+	_, err := a.fetchLastAccessed(aws.String("job"))
+	require.EqualError(t, err, "job job still in progress after 3 checks")
+}
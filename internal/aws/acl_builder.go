@@ -31,19 +31,19 @@ func (b *ACLBuilder) Build() []model.AccessControlRule {
 }
 
 func (b *ACLBuilder) processStatements(pr *Principal, po *IdentityPolicy) {
-	for _, s := range po.Statements {
-		b.processStatement(pr, po, &s)
+	for i, s := range po.Statements {
+		b.processStatement(pr, po, i, &s)
 	}
 }
 
-func (b *ACLBuilder) processStatement(pr *Principal, po *IdentityPolicy, s *Statement) {
+func (b *ACLBuilder) processStatement(pr *Principal, po *IdentityPolicy, si int, s *Statement) {
 	for _, r := range s.Resources {
-		b.processRules(pr, po, r, s.Actions)
+		b.processRules(pr, po, si, s, r)
 	}
 }
 
-func (b *ACLBuilder) processRules(pr *Principal, po *IdentityPolicy, r string, al []string) {
-	for _, a := range al {
+func (b *ACLBuilder) processRules(pr *Principal, po *IdentityPolicy, si int, s *Statement, r string) {
+	for _, a := range s.Actions {
 		rule := model.AccessControlRule{
 			Principal: model.Principal{ID: pr.String()},
 			Permission: model.Permission{
@@ -54,6 +54,9 @@ func (b *ACLBuilder) processRules(pr *Principal, po *IdentityPolicy, r string, a
 				model.NewRoleGrant(*b.role.Arn),
 				model.NewPolicyGrant(po.ARN),
 			},
+			StatementIndex: si,
+			Effect:         s.Effect,
+			Conditions:     s.mapConditions(),
 		}
 		b.acl = append(b.acl, rule)
 	}
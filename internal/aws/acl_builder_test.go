@@ -64,6 +64,7 @@ func TestBuildACL(t *testing.T) {
 					Resource: model.Resource{
 						ID: "arn:aws:ec2:*:*:instance/someinstanceid",
 					},
+					Effect: "Allow",
 					GrantChain: []model.GrantIface{
 						model.RoleGrant{
 							Grant: model.Grant{
@@ -89,6 +90,7 @@ func TestBuildACL(t *testing.T) {
 					Resource: model.Resource{
 						ID: "arn:aws:ec2:*:*:instance/someotherinstance",
 					},
+					Effect: "Allow",
 					GrantChain: []model.GrantIface{
 						model.RoleGrant{
 							Grant: model.Grant{
@@ -152,6 +154,7 @@ func TestBuildACL(t *testing.T) {
 					Resource: model.Resource{
 						ID: "arn:aws:ec2:*:*:instance/someinstanceid",
 					},
+					Effect: "Allow",
 					GrantChain: []model.GrantIface{
 						model.RoleGrant{
 							Grant: model.Grant{
@@ -177,6 +180,7 @@ func TestBuildACL(t *testing.T) {
 					Resource: model.Resource{
 						ID: "arn:aws:ec2:*:*:instance/someinstanceid",
 					},
+					Effect: "Allow",
 					GrantChain: []model.GrantIface{
 						model.RoleGrant{
 							Grant: model.Grant{
@@ -194,6 +198,133 @@ func TestBuildACL(t *testing.T) {
 				},
 			},
 		},
+		{
+			"two statements",
+			fields{
+				types.Role{
+					Arn:      aws.String("arn:aws:iam::111122223333:role/SomeRole"),
+					RoleName: aws.String("SomeRole"),
+				},
+				[]Principal{
+					{
+						Type: AWS,
+						ID:   "arn:aws:iam::111122223333:role/TestRole",
+					},
+				},
+				[]IdentityPolicy{
+					{
+						ARN:  "arn:aws:iam::111122223333:policy/TestPolicy",
+						Name: "TestPolicy",
+						Policy: Policy{
+							Version: "2012-10-17",
+							Statements: []Statement{
+								{
+									Effect:    "Allow",
+									Actions:   []string{"ec2:CreateInstance"},
+									Resources: []string{"arn:aws:ec2:*:*:instance/someinstanceid"},
+								},
+								{
+									Effect:    "Allow",
+									Actions:   []string{"ec2:DescribeInstance"},
+									Resources: []string{"*"},
+								},
+							},
+						},
+					},
+				},
+			},
+			[]model.AccessControlRule{
+				{
+					Principal: model.Principal{
+						ID: "AWS[arn:aws:iam::111122223333:role/TestRole]",
+					},
+					Permission: model.Permission{
+						ID: "ec2:CreateInstance",
+					},
+					Resource: model.Resource{
+						ID: "arn:aws:ec2:*:*:instance/someinstanceid",
+					},
+					Effect: "Allow",
+					GrantChain: []model.GrantIface{
+						model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+						model.NewPolicyGrant("arn:aws:iam::111122223333:policy/TestPolicy"),
+					},
+					StatementIndex: 0,
+				},
+				{
+					Principal: model.Principal{
+						ID: "AWS[arn:aws:iam::111122223333:role/TestRole]",
+					},
+					Permission: model.Permission{
+						ID: "ec2:DescribeInstance",
+					},
+					Resource: model.Resource{
+						ID: "*",
+					},
+					Effect: "Allow",
+					GrantChain: []model.GrantIface{
+						model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+						model.NewPolicyGrant("arn:aws:iam::111122223333:policy/TestPolicy"),
+					},
+					StatementIndex: 1,
+				},
+			},
+		},
+		{
+			"deny with conditions",
+			fields{
+				types.Role{
+					Arn:      aws.String("arn:aws:iam::111122223333:role/SomeRole"),
+					RoleName: aws.String("SomeRole"),
+				},
+				[]Principal{
+					{
+						Type: AWS,
+						ID:   "arn:aws:iam::111122223333:role/TestRole",
+					},
+				},
+				[]IdentityPolicy{
+					{
+						ARN:  "arn:aws:iam::111122223333:policy/TestPolicy",
+						Name: "TestPolicy",
+						Policy: Policy{
+							Version: "2012-10-17",
+							Statements: []Statement{
+								{
+									Effect:    "Deny",
+									Actions:   []string{"s3:DeleteObject"},
+									Resources: []string{"*"},
+									Conditions: []Condition{
+										{Operator: "BoolIfExists", Key: "aws:MultiFactorAuthPresent", Values: []string{"false"}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			[]model.AccessControlRule{
+				{
+					Principal: model.Principal{
+						ID: "AWS[arn:aws:iam::111122223333:role/TestRole]",
+					},
+					Permission: model.Permission{
+						ID: "s3:DeleteObject",
+					},
+					Resource: model.Resource{
+						ID: "*",
+					},
+					Effect: "Deny",
+					Conditions: []model.Condition{
+						{Operator: "BoolIfExists", Key: "aws:MultiFactorAuthPresent", Values: []string{"false"}},
+					},
+					GrantChain: []model.GrantIface{
+						model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+						model.NewPolicyGrant("arn:aws:iam::111122223333:policy/TestPolicy"),
+					},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
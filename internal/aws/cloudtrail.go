@@ -0,0 +1,234 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+type cloudTrailLog struct {
+	Records []cloudTrailEvent `json:"Records"`
+}
+
+type cloudTrailEvent struct {
+	EventTime    time.Time `json:"eventTime"`
+	EventSource  string    `json:"eventSource"`
+	EventName    string    `json:"eventName"`
+	ErrorCode    string    `json:"errorCode"`
+	UserIdentity struct {
+		Type           string `json:"type"`
+		ARN            string `json:"arn"`
+		InvokedBy      string `json:"invokedBy"`
+		SessionContext struct {
+			SessionIssuer struct {
+				ARN string `json:"arn"`
+			} `json:"sessionIssuer"`
+		} `json:"sessionContext"`
+	} `json:"userIdentity"`
+	Resources []struct {
+		ARN string `json:"ARN"`
+	} `json:"resources"`
+}
+
+// eventServices are the event sources whose name differs from the service
+// prefix of their actions.
+var eventServices = map[string]string{
+	"monitoring": "cloudwatch",
+	"email":      "ses",
+}
+
+// eventActions are the events that aren't authorized by the action of the
+// same name.
+var eventActions = map[string]string{
+	"s3:ListBuckets":             "s3:ListAllMyBuckets",
+	"s3:ListObjects":             "s3:ListBucket",
+	"s3:ListObjectsV2":           "s3:ListBucket",
+	"s3:ListObjectVersions":      "s3:ListBucketVersions",
+	"s3:HeadBucket":              "s3:ListBucket",
+	"s3:HeadObject":              "s3:GetObject",
+	"s3:CopyObject":              "s3:PutObject",
+	"s3:CreateMultipartUpload":   "s3:PutObject",
+	"s3:UploadPart":              "s3:PutObject",
+	"s3:UploadPartCopy":          "s3:PutObject",
+	"s3:CompleteMultipartUpload": "s3:PutObject",
+	"s3:DeleteObjects":           "s3:DeleteObject",
+	"s3:GetBucketEncryption":     "s3:GetEncryptionConfiguration",
+	"s3:PutBucketEncryption":     "s3:PutEncryptionConfiguration",
+	"s3:DeleteBucketEncryption":  "s3:PutEncryptionConfiguration",
+	"s3:GetBucketLifecycle":      "s3:GetLifecycleConfiguration",
+	"s3:PutBucketLifecycle":      "s3:PutLifecycleConfiguration",
+	"s3:DeleteBucketLifecycle":   "s3:PutLifecycleConfiguration",
+	"s3:GetBucketReplication":    "s3:GetReplicationConfiguration",
+	"s3:PutBucketReplication":    "s3:PutReplicationConfiguration",
+	"s3:DeleteBucketReplication": "s3:PutReplicationConfiguration",
+	"s3:DeleteBucketCors":        "s3:PutBucketCORS",
+	"s3:DeleteBucketTagging":     "s3:PutBucketTagging",
+	"lambda:Invoke":              "lambda:InvokeFunction",
+}
+
+// eventVersion is the API version some services, such as Lambda, append to
+// their event names.
+var eventVersion = regexp.MustCompile(`\d{8}(v\d+)?$`)
+
+// ParseCloudTrail reads the usage out of a CloudTrail log file, gzipped as
+// delivered to S3 or not. Events denied to their caller didn't exercise any
+// permission and are left out.
+func ParseCloudTrail(data []byte) ([]model.Usage, error) {
+	if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(gz); err != nil {
+			return nil, err
+		}
+	}
+
+	var log cloudTrailLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, err
+	}
+
+	var usage []model.Usage
+	for _, e := range log.Records {
+		if strings.Contains(e.ErrorCode, "AccessDenied") || strings.Contains(e.ErrorCode, "Unauthorized") {
+			continue
+		}
+		identity := e.identity()
+		if identity == "" || e.EventSource == "" || e.EventName == "" {
+			continue
+		}
+
+		u := model.Usage{Identity: identity, Action: e.action(), LastUsed: e.EventTime}
+		if len(e.Resources) == 0 {
+			usage = append(usage, u)
+		}
+		for _, r := range e.Resources {
+			u.Resource = r.ARN
+			usage = append(usage, u)
+		}
+	}
+	return model.MergeUsage(usage), nil
+}
+
+// identity is the user or role behind the event. Sessions of assumed roles
+// and federated users are attributed to the role or user that issued them,
+// events of AWS services have none.
+func (e *cloudTrailEvent) identity() string {
+	ui := &e.UserIdentity
+	switch ui.Type {
+	case "AssumedRole", "FederatedUser":
+		if ui.SessionContext.SessionIssuer.ARN != "" {
+			return ui.SessionContext.SessionIssuer.ARN
+		}
+	case "AWSService":
+		// services acting on their own aren't granted anything by the cached
+		// rules
+		return ""
+	}
+	return ui.ARN
+}
+
+// action is the IAM action authorizing the event.
+func (e *cloudTrailEvent) action() string {
+	service := strings.TrimSuffix(e.EventSource, ".amazonaws.com")
+	if s, ok := eventServices[service]; ok {
+		service = s
+	}
+	action := service + ":" + eventVersion.ReplaceAllString(e.EventName, "")
+	if a, ok := eventActions[action]; ok {
+		return a
+	}
+	return action
+}
+
+// CloudTrailFiles reads CloudTrail logs from local files, one file per page.
+// Directories are walked for .json and .json.gz files.
+type CloudTrailFiles struct {
+	paths []string
+	files []string
+}
+
+func NewCloudTrailFiles(paths []string) *CloudTrailFiles {
+	return &CloudTrailFiles{
+		paths: paths,
+	}
+}
+
+func (f *CloudTrailFiles) FetchUsage(page ports.PageIface) ([]model.Usage, ports.PageIface, error) {
+	if f.files == nil {
+		if err := f.listFiles(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	i := 0
+	if page != nil && page.HasNext() {
+		var err error
+		if i, err = strconv.Atoi(*page.Next()); err != nil {
+			return nil, nil, fmt.Errorf("invalid page token %v", *page.Next())
+		}
+	}
+	if i >= len(f.files) {
+		return nil, NewPageToken(nil), nil
+	}
+
+	data, err := ioutil.ReadFile(f.files[i])
+	if err != nil {
+		return nil, nil, err
+	}
+	usage, err := ParseCloudTrail(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse CloudTrail log %v: %w", f.files[i], err)
+	}
+
+	var next *string
+	if i+1 < len(f.files) {
+		next = aws.String(strconv.Itoa(i + 1))
+	}
+	return usage, NewPageToken(next), nil
+}
+
+func (f *CloudTrailFiles) listFiles() error {
+	f.files = []string{}
+	for _, p := range f.paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			f.files = append(f.files, p)
+			continue
+		}
+
+		var found []string
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".json.gz")) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Strings(found)
+		f.files = append(f.files, found...)
+	}
+	return nil
+}
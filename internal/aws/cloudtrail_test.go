@@ -0,0 +1,231 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+const testTrail = `{"Records": [
+	{
+		"eventTime": "2021-12-01T10:00:00Z",
+		"eventSource": "s3.amazonaws.com",
+		"eventName": "GetObject",
+		"userIdentity": {
+			"type": "AssumedRole",
+			"arn": "arn:aws:sts::111122223333:assumed-role/Dev/session",
+			"sessionContext": {"sessionIssuer": {"arn": "arn:aws:iam::111122223333:role/Dev"}}
+		},
+		"resources": [
+			{"ARN": "arn:aws:s3:::bucket/key", "type": "AWS::S3::Object"},
+			{"ARN": "arn:aws:s3:::bucket", "type": "AWS::S3::Bucket"}
+		]
+	},
+	{
+		"eventTime": "2021-12-01T09:00:00Z",
+		"eventSource": "s3.amazonaws.com",
+		"eventName": "GetObject",
+		"userIdentity": {
+			"type": "AssumedRole",
+			"arn": "arn:aws:sts::111122223333:assumed-role/Dev/other",
+			"sessionContext": {"sessionIssuer": {"arn": "arn:aws:iam::111122223333:role/Dev"}}
+		},
+		"resources": [{"ARN": "arn:aws:s3:::bucket/key"}]
+	},
+	{
+		"eventTime": "2021-12-01T11:00:00Z",
+		"eventSource": "lambda.amazonaws.com",
+		"eventName": "UpdateFunctionCode20150331v2",
+		"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/alice"}
+	},
+	{
+		"eventTime": "2021-12-01T12:00:00Z",
+		"eventSource": "monitoring.amazonaws.com",
+		"eventName": "PutMetricData",
+		"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/alice"}
+	},
+	{
+		"eventTime": "2021-12-01T12:00:00Z",
+		"eventSource": "sts.amazonaws.com",
+		"eventName": "AssumeRole",
+		"userIdentity": {"type": "AWSService", "invokedBy": "ec2.amazonaws.com"}
+	},
+	{
+		"eventTime": "2021-12-01T12:00:00Z",
+		"eventSource": "s3.amazonaws.com",
+		"eventName": "ListObjectsV2",
+		"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/alice"},
+		"resources": [{"ARN": "arn:aws:s3:::bucket"}]
+	},
+	{
+		"eventTime": "2021-12-01T13:00:00Z",
+		"eventSource": "iam.amazonaws.com",
+		"eventName": "CreateUser",
+		"errorCode": "AccessDenied",
+		"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/alice"}
+	}
+]}`
+
+func testTrailUsage() []model.Usage {
+	at := func(hour int) time.Time {
+		return time.Date(2021, 12, 1, hour, 0, 0, 0, time.UTC)
+	}
+	return []model.Usage{
+		{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key", LastUsed: at(10)},
+		{Identity: "arn:aws:iam::111122223333:role/Dev", Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket", LastUsed: at(10)},
+		{Identity: "arn:aws:iam::111122223333:user/alice", Action: "lambda:UpdateFunctionCode", LastUsed: at(11)},
+		{Identity: "arn:aws:iam::111122223333:user/alice", Action: "cloudwatch:PutMetricData", LastUsed: at(12)},
+		{Identity: "arn:aws:iam::111122223333:user/alice", Action: "s3:ListBucket", Resource: "arn:aws:s3:::bucket", LastUsed: at(12)},
+	}
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.Nil(t, err)
+	require.Nil(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestParseCloudTrail(t *testing.T) {
+	got, err := ParseCloudTrail([]byte(testTrail))
+	require.Nil(t, err)
+	require.Equal(t, testTrailUsage(), got)
+
+	got, err = ParseCloudTrail(gzipped(t, testTrail))
+	require.Nil(t, err)
+	require.Equal(t, testTrailUsage(), got)
+
+	_, err = ParseCloudTrail([]byte("not json"))
+	require.NotNil(t, err)
+}
+
+func TestCloudTrailEventAction(t *testing.T) {
+	tests := []struct {
+		source string
+		name   string
+		want   string
+	}{
+		{"s3.amazonaws.com", "GetObject", "s3:GetObject"},
+		{"s3.amazonaws.com", "ListObjects", "s3:ListBucket"},
+		{"s3.amazonaws.com", "ListObjectsV2", "s3:ListBucket"},
+		{"s3.amazonaws.com", "HeadObject", "s3:GetObject"},
+		{"s3.amazonaws.com", "ListBuckets", "s3:ListAllMyBuckets"},
+		{"s3.amazonaws.com", "DeleteObjects", "s3:DeleteObject"},
+		{"s3.amazonaws.com", "CompleteMultipartUpload", "s3:PutObject"},
+		{"s3.amazonaws.com", "PutBucketEncryption", "s3:PutEncryptionConfiguration"},
+		{"monitoring.amazonaws.com", "PutMetricData", "cloudwatch:PutMetricData"},
+		{"lambda.amazonaws.com", "Invoke20150331", "lambda:InvokeFunction"},
+		{"lambda.amazonaws.com", "UpdateFunctionCode20150331v2", "lambda:UpdateFunctionCode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := cloudTrailEvent{EventSource: tt.source, EventName: tt.name}
+			require.Equal(t, tt.want, e.action())
+		})
+	}
+}
+
+func TestCloudTrailFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudtrail")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "2021", "12"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "2021", "12", "a.json.gz"), gzipped(t, testTrail), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "2021", "12", "b.json"), []byte(`{"Records": []}`), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "2021", "12", "digest.txt"), []byte("ignored"), 0644))
+
+	files := NewCloudTrailFiles([]string{dir})
+
+	usage, page, err := files.FetchUsage(nil)
+	require.Nil(t, err)
+	require.Equal(t, testTrailUsage(), usage)
+	require.True(t, page.HasNext())
+
+	usage, page, err = files.FetchUsage(page)
+	require.Nil(t, err)
+	require.Empty(t, usage)
+	require.False(t, page.HasNext())
+}
+
+func TestCloudTrailS3(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	s3Mock := mocks.NewS3ClientMock(ctrl)
+
+	trail := &CloudTrailS3{
+		ctx:    ctx,
+		cli:    s3Mock,
+		bucket: "bucket",
+		prefix: "AWSLogs/",
+	}
+
+	s3Mock.
+		EXPECT().
+		ListObjectsV2(gomock.Eq(ctx), gomock.Eq(&s3.ListObjectsV2Input{
+			Bucket: awssdk.String("bucket"),
+			Prefix: awssdk.String("AWSLogs/"),
+		})).
+		Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{
+				{Key: awssdk.String("AWSLogs/a.json.gz")},
+				{Key: awssdk.String("AWSLogs/digest.txt")},
+			},
+			IsTruncated:           true,
+			NextContinuationToken: awssdk.String("next"),
+		}, nil)
+	s3Mock.
+		EXPECT().
+		GetObject(gomock.Eq(ctx), gomock.Eq(&s3.GetObjectInput{
+			Bucket: awssdk.String("bucket"),
+			Key:    awssdk.String("AWSLogs/a.json.gz"),
+		})).
+		Return(&s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(gzipped(t, testTrail)))}, nil)
+
+	usage, page, err := trail.FetchUsage(nil)
+	require.Nil(t, err)
+	require.Equal(t, testTrailUsage(), usage)
+	require.True(t, page.HasNext())
+
+	s3Mock.
+		EXPECT().
+		ListObjectsV2(gomock.Eq(ctx), gomock.Eq(&s3.ListObjectsV2Input{
+			Bucket:            awssdk.String("bucket"),
+			Prefix:            awssdk.String("AWSLogs/"),
+			ContinuationToken: awssdk.String("next"),
+		})).
+		Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: awssdk.String("AWSLogs/missing.json.gz")}},
+		}, nil)
+	s3Mock.
+		EXPECT().
+		GetObject(gomock.Eq(ctx), gomock.Eq(&s3.GetObjectInput{
+			Bucket: awssdk.String("bucket"),
+			Key:    awssdk.String("AWSLogs/missing.json.gz"),
+		})).
+		Return(nil, errors.New("NoSuchKey"))
+
+	_, _, err = trail.FetchUsage(page)
+	require.EqualError(t, err, "unable to fetch CloudTrail log s3://bucket/AWSLogs/missing.json.gz: NoSuchKey")
+
+	_, err = NewCloudTrailS3(&awssdk.Config{}, "bucket/AWSLogs")
+	require.EqualError(t, err, "invalid S3 location bucket/AWSLogs, expected s3://bucket/prefix")
+}
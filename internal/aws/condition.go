@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+type Condition struct {
+	Operator string
+	Key      string
+	Values   []string
+}
+
+func (s *Statement) mapConditions() []model.Condition {
+	if len(s.Conditions) == 0 {
+		return nil
+	}
+	conditions := make([]model.Condition, 0, len(s.Conditions))
+	for _, c := range s.Conditions {
+		conditions = append(conditions, model.Condition{
+			Operator: c.Operator,
+			Key:      c.Key,
+			Values:   c.Values,
+		})
+	}
+	return conditions
+}
+
+func (s *Statement) unmarshalConditions(data interface{}) error {
+	operators, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid Condition format")
+	}
+
+	for _, op := range sortedKeys(operators) {
+		keys, ok := operators[op].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid Condition operator %v", op)
+		}
+
+		for _, k := range sortedKeys(keys) {
+			values, err := conditionValues(keys[k])
+			if err != nil {
+				return err
+			}
+			s.Conditions = append(s.Conditions, Condition{
+				Operator: op,
+				Key:      k,
+				Values:   values,
+			})
+		}
+	}
+	return nil
+}
+
+func (s *Statement) marshalConditions() map[string]map[string]interface{} {
+	if len(s.Conditions) == 0 {
+		return nil
+	}
+	operators := make(map[string]map[string]interface{})
+	for _, c := range s.Conditions {
+		if operators[c.Operator] == nil {
+			operators[c.Operator] = make(map[string]interface{})
+		}
+		operators[c.Operator][c.Key] = stringOrList(c.Values)
+	}
+	return operators
+}
+
+func conditionValues(data interface{}) ([]string, error) {
+	switch v := data.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, i := range v {
+			values = append(values, fmt.Sprint(i))
+		}
+		return values, nil
+	case string, bool, float64:
+		return []string{fmt.Sprint(v)}, nil
+	}
+	return nil, fmt.Errorf("unknown Condition values format")
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,53 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// ConfigOptions selects the shared config profile and region to load, and an
+// optional role to assume with those credentials.
+type ConfigOptions struct {
+	Profile    string
+	Region     string
+	RoleARN    string
+	ExternalID string
+}
+
+func LoadConfig(o *ConfigOptions) (*aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if o.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(o.Profile))
+	}
+	if o.Region != "" {
+		opts = append(opts, config.WithRegion(o.Region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.RoleARN != "" {
+		cfg = AssumeRole(cfg, o.RoleARN, o.ExternalID)
+	}
+	return &cfg, nil
+}
+
+// AssumeRole returns a copy of cfg whose credentials are obtained by assuming
+// roleARN. Credentials are refreshed as they expire.
+func AssumeRole(cfg aws.Config, roleARN string, externalID string) aws.Config {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		if externalID != "" {
+			o.ExternalID = aws.String(externalID)
+		}
+	})
+
+	assumed := cfg.Copy()
+	assumed.Credentials = aws.NewCredentialsCache(provider)
+	return assumed
+}
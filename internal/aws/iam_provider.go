@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -17,6 +18,10 @@ import (
 type IAMProvider struct {
 	ctx context.Context
 	cli IAMClientIface
+	// pollInterval is the wait between two checks of an Access Advisor job
+	pollInterval time.Duration
+	// pollAttempts is how many times a job is checked before giving up on it
+	pollAttempts int
 }
 
 func NewIAMProvider(cfg *aws.Config) (as *IAMProvider, err error) {
@@ -32,8 +37,10 @@ func NewIAMProvider(cfg *aws.Config) (as *IAMProvider, err error) {
 	}
 
 	as = &IAMProvider{
-		ctx: ctx,
-		cli: iam.NewFromConfig(*cfg),
+		ctx:          ctx,
+		cli:          iam.NewFromConfig(*cfg),
+		pollInterval: 2 * time.Second,
+		pollAttempts: 150,
 	}
 	return as, err
 }
@@ -57,7 +64,7 @@ func (a *IAMProvider) FetchACL(page ports.PageIface) ([]model.AccessControlRule,
 				"principal": *role.AssumeRolePolicyDocument,
 				"error":     err,
 			}).Error("failed to fetch principal from trust policy")
-			continue
+			return nil, nil, err
 		}
 
 		policies, err := a.fetchAttachedPolicies(&role)
@@ -66,7 +73,7 @@ func (a *IAMProvider) FetchACL(page ports.PageIface) ([]model.AccessControlRule,
 				"role":  *(role.Arn),
 				"error": err,
 			}).Error("failed to fetch policies attached to role")
-			continue
+			return nil, nil, err
 	}
 
 		newRules := NewACLBuilder(role, principals, policies).Build()
@@ -109,15 +116,13 @@ func (a *IAMProvider) getPrincipals(role *types.Role) ([]Principal, error) {
 }
 
 func (a *IAMProvider) fetchAttachedPolicies(role *types.Role) ([]IdentityPolicy, error) {
-	lp, err := a.cli.ListAttachedRolePolicies(a.ctx, &iam.ListAttachedRolePoliciesInput{
-		RoleName: role.RoleName,
-	})
+	attached, err := a.listAttachedPolicies(role)
 	if err != nil {
 		return nil, err
 	}
 
-	policies := make([]IdentityPolicy, 0, len(lp.AttachedPolicies))
-	for _, attachedRolePolicy := range lp.AttachedPolicies {
+	policies := make([]IdentityPolicy, 0, len(attached))
+	for _, attachedRolePolicy := range attached {
 		np, err := a.fetchIdentityPolicy(&attachedRolePolicy)
 		if err != nil {
 			return nil, err
@@ -127,6 +132,16 @@ func (a *IAMProvider) fetchAttachedPolicies(role *types.Role) ([]IdentityPolicy,
 	return policies, nil
 }
 
+func (a *IAMProvider) listAttachedPolicies(role *types.Role) ([]types.AttachedPolicy, error) {
+	lp, err := a.cli.ListAttachedRolePolicies(a.ctx, &iam.ListAttachedRolePoliciesInput{
+		RoleName: role.RoleName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lp.AttachedPolicies, nil
+}
+
 func (a *IAMProvider) fetchIdentityPolicy(ap *types.AttachedPolicy) (*IdentityPolicy, error) {
 	gp, err := a.cli.GetPolicy(a.ctx, &iam.GetPolicyInput{
 		PolicyArn: ap.PolicyArn,
@@ -154,3 +169,158 @@ func (a *IAMProvider) fetchIdentityPolicy(ap *types.AttachedPolicy) (*IdentityPo
 	}
 	return np, nil
 }
+
+func (a *IAMProvider) FetchRoles(page ports.PageIface) ([]model.Role, ports.PageIface, error) {
+	roles, nextPage, err := a.fetchRoles(page)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"page":  page,
+			"error": err,
+		}).Error("failed to fetch roles from aws")
+		return nil, nil, err
+	}
+
+	mr := make([]model.Role, 0, len(roles))
+	for _, role := range roles {
+		trust, err := a.getTrustStatements(&role)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"role":  *(role.Arn),
+				"error": err,
+			}).Error("failed to parse trust policy")
+			return nil, nil, err
+		}
+
+		// ListRoles doesn't return RoleLastUsed
+		gr, err := a.cli.GetRole(a.ctx, &iam.GetRoleInput{
+			RoleName: role.RoleName,
+		})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"role":  *(role.Arn),
+				"error": err,
+			}).Error("failed to fetch role details")
+			return nil, nil, err
+		}
+
+		attached, err := a.listAttachedPolicies(&role)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"role":  *(role.Arn),
+				"error": err,
+			}).Error("failed to fetch attached policies")
+			return nil, nil, err
+		}
+		policies := make([]string, 0, len(attached))
+		for _, p := range attached {
+			policies = append(policies, *p.PolicyArn)
+		}
+
+		r := model.Role{
+			ARN:      *role.Arn,
+			Name:     *role.RoleName,
+			Trust:    trust,
+			Policies: policies,
+		}
+		if role.CreateDate != nil {
+			r.CreateDate = *role.CreateDate
+		}
+		if gr.Role != nil && gr.Role.RoleLastUsed != nil {
+			r.LastUsed = gr.Role.RoleLastUsed.LastUsedDate
+		}
+		mr = append(mr, r)
+	}
+
+	return mr, nextPage, nil
+}
+
+// FetchPolicies lists the managed policies attached to any identity of the
+// account, with the document of their default version.
+func (a *IAMProvider) FetchPolicies(page ports.PageIface) ([]model.Policy, ports.PageIface, error) {
+	lpi := iam.ListPoliciesInput{
+		OnlyAttached: true,
+	}
+
+	if page != nil {
+		lpi.Marker = page.Next()
+	}
+
+	output, err := a.cli.ListPolicies(a.ctx, &lpi)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"page":  page,
+			"error": err,
+		}).Error("failed to fetch policies from aws")
+		return nil, nil, err
+	}
+
+	policies := make([]model.Policy, 0, len(output.Policies))
+	for _, p := range output.Policies {
+		pv, err := a.cli.GetPolicyVersion(a.ctx, &iam.GetPolicyVersionInput{
+			PolicyArn: p.Arn,
+			VersionId: p.DefaultVersionId,
+		})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"policy": *p.Arn,
+				"error":  err,
+			}).Error("failed to fetch policy version")
+			return nil, nil, err
+		}
+
+		pd, err := url.QueryUnescape(*pv.PolicyVersion.Document)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"policy": *p.Arn,
+				"error":  err,
+			}).Error("failed to decode policy document")
+			return nil, nil, err
+		}
+
+		policies = append(policies, model.Policy{
+			ARN:      *p.Arn,
+			Name:     *p.PolicyName,
+			Version:  *p.DefaultVersionId,
+			Document: pd,
+		})
+	}
+
+	return policies, NewPageToken(output.Marker), nil
+}
+
+func (a *IAMProvider) getTrustStatements(role *types.Role) ([]model.TrustStatement, error) {
+	policyDoc, err := url.QueryUnescape(*role.AssumeRolePolicyDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	assumePolicy, err := NewAssumePolicy(policyDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	var trust []model.TrustStatement
+	for i, s := range assumePolicy.Statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+
+		conditions := make([]model.Condition, 0, len(s.Conditions))
+		for _, c := range s.Conditions {
+			conditions = append(conditions, model.Condition{
+				Operator: c.Operator,
+				Key:      c.Key,
+				Values:   c.Values,
+			})
+		}
+
+		for _, p := range s.Principals.Items {
+			trust = append(trust, model.TrustStatement{
+				Principal:      model.Principal{ID: p.String()},
+				Conditions:     conditions,
+				StatementIndex: i,
+			})
+		}
+	}
+	return trust, nil
+}
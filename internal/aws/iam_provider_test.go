@@ -2,7 +2,9 @@ package aws
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
@@ -87,6 +89,7 @@ func TestFetchACL(t *testing.T) {
 					Permission: model.Permission{
 						ID: "someaction",
 					},
+					Effect: "Allow",
 					GrantChain: []model.GrantIface{
 						model.RoleGrant{
 							Grant: model.Grant{
@@ -167,6 +170,7 @@ func TestFetchACL(t *testing.T) {
 					Permission: model.Permission{
 						ID: "someaction",
 					},
+					Effect: "Allow",
 					GrantChain: []model.GrantIface{
 						model.RoleGrant{
 							Grant: model.Grant{
@@ -247,3 +251,302 @@ func TestFetchACL(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchRoles(t *testing.T) {
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	used := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		listRolesOutput  *iam.ListRolesOutput
+		getRoleOutput    *iam.GetRoleOutput
+		attachedPolicies []types.AttachedPolicy
+		want             []model.Role
+	}{
+		{
+			"trust with conditions",
+			&iam.ListRolesOutput{
+				Roles: []types.Role{
+					{
+						Arn:        aws.String("arn:aws:iam::111122223333:role/rolename"),
+						RoleName:   aws.String("rolename"),
+						CreateDate: &created,
+						AssumeRolePolicyDocument: aws.String(`{
+							"Version": "2012-10-17",
+							"Statement": [
+								{
+									"Effect": "Allow",
+									"Principal": {
+										"Service": "s3.amazonaws.com"
+									},
+									"Action": "sts:AssumeRole",
+									"Condition": {
+										"StringEquals": {
+											"aws:SourceAccount": "111122223333"
+										}
+									}
+								},
+								{
+									"Effect": "Deny",
+									"Principal": {
+										"AWS": "*"
+									},
+									"Action": "sts:AssumeRole"
+								}
+							]
+						}`),
+					},
+				},
+			},
+			&iam.GetRoleOutput{
+				Role: &types.Role{
+					RoleLastUsed: &types.RoleLastUsed{
+						LastUsedDate: &used,
+					},
+				},
+			},
+			[]types.AttachedPolicy{
+				{PolicyArn: aws.String("arn:aws:iam::111122223333:policy/TestPolicy"), PolicyName: aws.String("TestPolicy")},
+			},
+			[]model.Role{
+				{
+					ARN:        "arn:aws:iam::111122223333:role/rolename",
+					Name:       "rolename",
+					CreateDate: created,
+					LastUsed:   &used,
+					Trust: []model.TrustStatement{
+						{
+							Principal: model.Principal{ID: "Service[s3.amazonaws.com]"},
+							Conditions: []model.Condition{
+								{
+									Operator: "StringEquals",
+									Key:      "aws:SourceAccount",
+									Values:   []string{"111122223333"},
+								},
+							},
+						},
+					},
+					Policies: []string{"arn:aws:iam::111122223333:policy/TestPolicy"},
+				},
+			},
+		},
+		{
+			"never used",
+			&iam.ListRolesOutput{
+				Roles: []types.Role{
+					{
+						Arn:      aws.String("arn:aws:iam::111122223333:role/rolename"),
+						RoleName: aws.String("rolename"),
+						AssumeRolePolicyDocument: aws.String(`{
+							"Version": "2012-10-17",
+							"Statement": [
+								{
+									"Effect": "Allow",
+									"Principal": {
+										"AWS": "arn:aws:iam::444455556666:root"
+									},
+									"Action": "sts:AssumeRole"
+								}
+							]
+						}`),
+					},
+				},
+				Marker: aws.String("nextPage"),
+			},
+			&iam.GetRoleOutput{
+				Role: &types.Role{},
+			},
+			nil,
+			[]model.Role{
+				{
+					ARN:  "arn:aws:iam::111122223333:role/rolename",
+					Name: "rolename",
+					Trust: []model.TrustStatement{
+						{
+							Principal:  model.Principal{ID: "AWS[arn:aws:iam::444455556666:root]"},
+							Conditions: []model.Condition{},
+						},
+					},
+					Policies: []string{},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.TODO()
+			iamMock := mocks.NewIAMClientMock(ctrl)
+
+			a := &IAMProvider{
+				ctx: ctx,
+				cli: iamMock,
+			}
+
+			iamMock.
+				EXPECT().
+				ListRoles(gomock.Eq(ctx), gomock.Eq(&iam.ListRolesInput{})).
+				Return(tt.listRolesOutput, nil).
+				Times(1)
+
+			iamMock.
+				EXPECT().
+				GetRole(
+					gomock.Eq(ctx),
+					gomock.Eq(&iam.GetRoleInput{
+						RoleName: tt.listRolesOutput.Roles[0].RoleName,
+					}),
+				).
+				Return(tt.getRoleOutput, nil).
+				Times(1)
+			iamMock.
+				EXPECT().
+				ListAttachedRolePolicies(
+					gomock.Eq(ctx),
+					gomock.Eq(&iam.ListAttachedRolePoliciesInput{
+						RoleName: tt.listRolesOutput.Roles[0].RoleName,
+					}),
+				).
+				Return(&iam.ListAttachedRolePoliciesOutput{AttachedPolicies: tt.attachedPolicies}, nil).
+				Times(1)
+
+			roles, nextPage, err := a.FetchRoles(nil)
+
+			require.Nil(t, err)
+			require.Equal(t, tt.listRolesOutput.Marker, nextPage.Next())
+			require.Equal(t, tt.want, roles)
+		})
+	}
+}
+
+func TestFetchRolesGetRoleError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	iamMock := mocks.NewIAMClientMock(ctrl)
+
+	a := &IAMProvider{
+		ctx: ctx,
+		cli: iamMock,
+	}
+
+	iamMock.
+		EXPECT().
+		ListRoles(gomock.Eq(ctx), gomock.Eq(&iam.ListRolesInput{})).
+		Return(&iam.ListRolesOutput{
+			Roles: []types.Role{
+				{
+					Arn:                      aws.String("arn:aws:iam::111122223333:role/rolename"),
+					RoleName:                 aws.String("rolename"),
+					AssumeRolePolicyDocument: aws.String(`{"Version": "2012-10-17", "Statement": []}`),
+				},
+			},
+		}, nil)
+	iamMock.
+		EXPECT().
+		GetRole(gomock.Eq(ctx), gomock.Eq(&iam.GetRoleInput{RoleName: aws.String("rolename")})).
+		Return(nil, fmt.Errorf("AccessDenied"))
+
+	_, _, err := a.FetchRoles(nil)
+	require.EqualError(t, err, "AccessDenied")
+}
+
+func TestFetchPolicies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	iamMock := mocks.NewIAMClientMock(ctrl)
+
+	a := &IAMProvider{
+		ctx: ctx,
+		cli: iamMock,
+	}
+
+	iamMock.
+		EXPECT().
+		ListPolicies(gomock.Eq(ctx), gomock.Eq(&iam.ListPoliciesInput{OnlyAttached: true})).
+		Return(&iam.ListPoliciesOutput{
+			Policies: []types.Policy{
+				{
+					Arn:              aws.String("arn:aws:iam::111122223333:policy/TestPolicy"),
+					PolicyName:       aws.String("TestPolicy"),
+					DefaultVersionId: aws.String("v2"),
+				},
+			},
+			Marker: aws.String("nextPage"),
+		}, nil).
+		Times(1)
+
+	iamMock.
+		EXPECT().
+		GetPolicyVersion(
+			gomock.Eq(ctx),
+			gomock.Eq(&iam.GetPolicyVersionInput{
+				PolicyArn: aws.String("arn:aws:iam::111122223333:policy/TestPolicy"),
+				VersionId: aws.String("v2"),
+			}),
+		).
+		Return(&iam.GetPolicyVersionOutput{
+			PolicyVersion: &types.PolicyVersion{
+				Document: aws.String(`%7B%22Version%22%3A%222012-10-17%22%2C%22Statement%22%3A%5B%5D%7D`),
+			},
+		}, nil).
+		Times(1)
+
+	policies, nextPage, err := a.FetchPolicies(nil)
+
+	require.Nil(t, err)
+	require.Equal(t, aws.String("nextPage"), nextPage.Next())
+	require.Equal(t, []model.Policy{
+		{
+			ARN:      "arn:aws:iam::111122223333:policy/TestPolicy",
+			Name:     "TestPolicy",
+			Version:  "v2",
+			Document: `{"Version":"2012-10-17","Statement":[]}`,
+		},
+	}, policies)
+}
+
+func TestFetchPoliciesVersionError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+	iamMock := mocks.NewIAMClientMock(ctrl)
+
+	a := &IAMProvider{
+		ctx: ctx,
+		cli: iamMock,
+	}
+
+	iamMock.
+		EXPECT().
+		ListPolicies(gomock.Eq(ctx), gomock.Any()).
+		Return(&iam.ListPoliciesOutput{
+			Policies: []types.Policy{
+				{
+					Arn:              aws.String("arn:aws:iam::111122223333:policy/TestPolicy"),
+					PolicyName:       aws.String("TestPolicy"),
+					DefaultVersionId: aws.String("v2"),
+				},
+			},
+		}, nil).
+		Times(1)
+
+	iamMock.
+		EXPECT().
+		GetPolicyVersion(gomock.Eq(ctx), gomock.Any()).
+		Return(nil, fmt.Errorf("access denied")).
+		Times(1)
+
+	// a policy left out would be missing from the cache without notice
+	policies, nextPage, err := a.FetchPolicies(nil)
+
+	require.EqualError(t, err, "access denied")
+	require.Nil(t, nextPage)
+	require.Nil(t, policies)
+}
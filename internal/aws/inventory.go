@@ -0,0 +1,141 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+// InventoryFile reads resources from an offline export. Supported layouts are
+// the output of `aws resourcegroupstaggingapi get-resources`, the output of
+// `aws configservice select-resource-config` selecting arn and resourceType,
+// and a plain JSON list of ARNs or {"arn", "type"} objects.
+type InventoryFile struct {
+	path string
+}
+
+type inventoryItem struct {
+	ARN          string `json:"arn"`
+	Type         string `json:"type"`
+	ResourceType string `json:"resourceType"`
+}
+
+type taggingExport struct {
+	ResourceTagMappingList []struct {
+		ResourceARN string `json:"ResourceARN"`
+	} `json:"ResourceTagMappingList"`
+}
+
+type configExport struct {
+	Results []string `json:"Results"`
+}
+
+func NewInventoryFile(path string) *InventoryFile {
+	return &InventoryFile{
+		path: path,
+	}
+}
+
+func (f *InventoryFile) FetchResources(page ports.PageIface) ([]model.Resource, ports.PageIface, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resources, err := ParseInventory(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse inventory %v: %w", f.path, err)
+	}
+
+	return resources, NewPageToken(nil), nil
+}
+
+func ParseInventory(data []byte) ([]model.Resource, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	switch doc := v.(type) {
+	case []interface{}:
+		return parseInventoryList(doc)
+	case map[string]interface{}:
+		if _, ok := doc["ResourceTagMappingList"]; ok {
+			return parseTaggingExport(data)
+		}
+		if _, ok := doc["Results"]; ok {
+			return parseConfigExport(data)
+		}
+	}
+	return nil, fmt.Errorf("unknown inventory format")
+}
+
+func parseTaggingExport(data []byte) ([]model.Resource, error) {
+	var export taggingExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+
+	resources := make([]model.Resource, 0, len(export.ResourceTagMappingList))
+	for _, m := range export.ResourceTagMappingList {
+		resources = append(resources, newInventoryResource(m.ResourceARN, ""))
+	}
+	return resources, nil
+}
+
+func parseConfigExport(data []byte) ([]model.Resource, error) {
+	var export configExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+
+	resources := make([]model.Resource, 0, len(export.Results))
+	for _, r := range export.Results {
+		var item inventoryItem
+		if err := json.Unmarshal([]byte(r), &item); err != nil {
+			return nil, err
+		}
+		if item.ARN == "" {
+			return nil, fmt.Errorf("AWS Config result without arn: %v", r)
+		}
+		resources = append(resources, newInventoryResource(item.ARN, item.ResourceType))
+	}
+	return resources, nil
+}
+
+func parseInventoryList(items []interface{}) ([]model.Resource, error) {
+	resources := make([]model.Resource, 0, len(items))
+	for _, i := range items {
+		switch item := i.(type) {
+		case string:
+			resources = append(resources, newInventoryResource(item, ""))
+		case map[string]interface{}:
+			arn, ok := item["arn"].(string)
+			if !ok {
+				return nil, fmt.Errorf("inventory entry without arn: %v", item)
+			}
+			rt, _ := item["type"].(string)
+			resources = append(resources, newInventoryResource(arn, rt))
+		default:
+			return nil, fmt.Errorf("unable to convert %v to Resource", i)
+		}
+	}
+	return resources, nil
+}
+
+func newInventoryResource(arn string, resourceType string) model.Resource {
+	if resourceType == "" {
+		// arn:partition:service:region:account:resource
+		if parts := strings.SplitN(arn, ":", 4); len(parts) == 4 {
+			resourceType = parts[2]
+		}
+	}
+	return model.Resource{
+		ID:   arn,
+		Type: resourceType,
+	}
+}
@@ -0,0 +1,66 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInventory(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []model.Resource
+		wantErr bool
+	}{
+		{
+			"tagging api export",
+			`{"ResourceTagMappingList": [{"ResourceARN": "arn:aws:s3:::mybucket", "Tags": []}]}`,
+			[]model.Resource{
+				{ID: "arn:aws:s3:::mybucket", Type: "s3"},
+			},
+			false,
+		},
+		{
+			"aws config export",
+			`{"Results": ["{\"arn\":\"arn:aws:s3:::mybucket\",\"resourceType\":\"AWS::S3::Bucket\"}"]}`,
+			[]model.Resource{
+				{ID: "arn:aws:s3:::mybucket", Type: "AWS::S3::Bucket"},
+			},
+			false,
+		},
+		{
+			"plain list",
+			`["arn:aws:sqs:ap-southeast-2:111122223333:queue", {"arn": "arn:aws:s3:::mybucket", "type": "bucket"}]`,
+			[]model.Resource{
+				{ID: "arn:aws:sqs:ap-southeast-2:111122223333:queue", Type: "sqs"},
+				{ID: "arn:aws:s3:::mybucket", Type: "bucket"},
+			},
+			false,
+		},
+		{
+			"unknown format",
+			`{"Items": []}`,
+			nil,
+			true,
+		},
+		{
+			"entry without arn",
+			`[{"type": "bucket"}]`,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInventory([]byte(tt.data))
+			if tt.wantErr {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
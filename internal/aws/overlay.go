@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+// Overlay is a proposed change to the policies of a role: a trust policy
+// replacing the current one, policies to attach and ARNs of policies to
+// detach. It rebuilds the rules of the role from the cached snapshot rather
+// than AWS.
+type Overlay struct {
+	Trust  *AssumePolicy
+	Attach []IdentityPolicy
+	Detach []string
+}
+
+func (o *Overlay) Rebuild(role *model.Role, current []model.AccessControlRule, cached []model.Policy) ([]model.AccessControlRule, error) {
+	principals, err := o.principals(role, current)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := o.policies(role, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	r := types.Role{Arn: &role.ARN, RoleName: &role.Name}
+	return NewACLBuilder(r, principals, policies).Build(), nil
+}
+
+// principals returns the principals of the new trust policy, or the ones of
+// the cached rules, which WhatIf limits to the ones assuming the role
+// directly. A role without rules falls back to its cached trust.
+func (o *Overlay) principals(role *model.Role, current []model.AccessControlRule) ([]Principal, error) {
+	if o.Trust != nil {
+		// like FetchACL, only the first statement is taken into account
+		if len(o.Trust.Statements) == 0 {
+			return nil, fmt.Errorf("trust policy has no statements")
+		}
+		return o.Trust.Statements[0].Principals.Items, nil
+	}
+
+	var principals []Principal
+	seen := make(map[string]bool)
+	add := func(p model.Principal) {
+		if seen[p.ID] {
+			return
+		}
+		seen[p.ID] = true
+		t, id := p.Split()
+		principals = append(principals, Principal{Type(t), id})
+	}
+	for _, r := range current {
+		add(r.Principal)
+	}
+	if len(current) == 0 {
+		for _, t := range role.Trust {
+			add(t.Principal)
+		}
+	}
+	return principals, nil
+}
+
+// policies returns the policies attached to the role when it was refreshed
+// that aren't detached, followed by the attached ones.
+func (o *Overlay) policies(role *model.Role, cached []model.Policy) ([]IdentityPolicy, error) {
+	if role.Policies == nil {
+		return nil, fmt.Errorf("policies attached to %v not found in cache, run iamsnitch refresh", role.ARN)
+	}
+
+	byARN := make(map[string]*model.Policy, len(cached))
+	for i := range cached {
+		byARN[cached[i].ARN] = &cached[i]
+	}
+
+	attached := make(map[string]bool, len(role.Policies))
+	for _, arn := range role.Policies {
+		attached[arn] = true
+	}
+
+	detached := make(map[string]bool, len(o.Detach))
+	for _, arn := range o.Detach {
+		if !attached[arn] {
+			return nil, fmt.Errorf("policy %v isn't attached to %v", arn, role.ARN)
+		}
+		detached[arn] = true
+	}
+
+	policies := make([]IdentityPolicy, 0, len(role.Policies)+len(o.Attach))
+	for _, arn := range role.Policies {
+		if detached[arn] {
+			continue
+		}
+		p, ok := byARN[arn]
+		if !ok {
+			return nil, fmt.Errorf("policy %v not found in cache, run iamsnitch refresh", arn)
+		}
+		np, err := NewIdentityPolicy(p.ARN, p.Name, p.Document)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", arn, err)
+		}
+		policies = append(policies, *np)
+	}
+	return append(policies, o.Attach...), nil
+}
@@ -0,0 +1,175 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayRebuild(t *testing.T) {
+	role := &model.Role{
+		ARN:  "arn:aws:iam::111122223333:role/Dev",
+		Name: "Dev",
+		Trust: []model.TrustStatement{
+			{Principal: model.Principal{ID: "AWS[arn:aws:iam::111122223333:root]"}},
+		},
+	}
+	read := model.Policy{
+		ARN:      "arn:aws:iam::111122223333:policy/Read",
+		Name:     "Read",
+		Document: `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`,
+	}
+	write := model.Policy{
+		ARN:      "arn:aws:iam::111122223333:policy/Write",
+		Name:     "Write",
+		Document: `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": "s3:PutObject", "Resource": "*"}]}`,
+	}
+	rule := func(principal string, policy string, permission string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: principal},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: "*"},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant(role.ARN),
+				model.NewPolicyGrant(policy),
+			},
+			Effect: "Allow",
+		}
+	}
+	current := []model.AccessControlRule{
+		rule("AWS[arn:aws:iam::444455556666:root]", read.ARN, "s3:GetObject"),
+		rule("AWS[arn:aws:iam::444455556666:root]", write.ARN, "s3:PutObject"),
+	}
+	queue, err := NewIdentityPolicy("queue.json", "queue.json",
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": "sqs:SendMessage", "Resource": "*"}]}`)
+	require.Nil(t, err)
+	trust, err := NewAssumePolicy(
+		`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": {"Service": "lambda.amazonaws.com"}, "Action": "sts:AssumeRole"}]}`)
+	require.Nil(t, err)
+
+	type access struct {
+		principal  string
+		policy     string
+		permission string
+	}
+	attached := []string{read.ARN, write.ARN}
+
+	tests := []struct {
+		name     string
+		overlay  Overlay
+		attached []string
+		current  []model.AccessControlRule
+		want     []access
+		wantErr  string
+	}{
+		{
+			"attach",
+			Overlay{Attach: []IdentityPolicy{*queue}},
+			attached,
+			current,
+			[]access{
+				{"AWS[arn:aws:iam::444455556666:root]", read.ARN, "s3:GetObject"},
+				{"AWS[arn:aws:iam::444455556666:root]", write.ARN, "s3:PutObject"},
+				{"AWS[arn:aws:iam::444455556666:root]", "queue.json", "sqs:SendMessage"},
+			},
+			"",
+		},
+		{
+			"detach",
+			Overlay{Detach: []string{write.ARN}},
+			attached,
+			current,
+			[]access{
+				{"AWS[arn:aws:iam::444455556666:root]", read.ARN, "s3:GetObject"},
+			},
+			"",
+		},
+		{
+			"replace trust",
+			Overlay{Trust: trust},
+			attached,
+			current,
+			[]access{
+				{"Service[lambda.amazonaws.com]", read.ARN, "s3:GetObject"},
+				{"Service[lambda.amazonaws.com]", write.ARN, "s3:PutObject"},
+			},
+			"",
+		},
+		{
+			"role without rules uses its cached trust",
+			Overlay{Attach: []IdentityPolicy{*queue}},
+			[]string{},
+			nil,
+			[]access{
+				{"AWS[arn:aws:iam::111122223333:root]", "queue.json", "sqs:SendMessage"},
+			},
+			"",
+		},
+		{
+			// a policy granting nothing the cached rules show is attached all
+			// the same
+			"policies come from the role",
+			Overlay{},
+			attached,
+			current[:1],
+			[]access{
+				{"AWS[arn:aws:iam::444455556666:root]", read.ARN, "s3:GetObject"},
+				{"AWS[arn:aws:iam::444455556666:root]", write.ARN, "s3:PutObject"},
+			},
+			"",
+		},
+		{
+			"detach a policy that isn't attached",
+			Overlay{Detach: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}},
+			attached,
+			current,
+			nil,
+			"policy arn:aws:iam::aws:policy/ReadOnlyAccess isn't attached to arn:aws:iam::111122223333:role/Dev",
+		},
+		{
+			"policy missing from the cache",
+			Overlay{},
+			append(attached, "arn:aws:iam::111122223333:policy/Gone"),
+			current,
+			nil,
+			"policy arn:aws:iam::111122223333:policy/Gone not found in cache, run iamsnitch refresh",
+		},
+		{
+			"role cached before its policies were recorded",
+			Overlay{},
+			nil,
+			current,
+			nil,
+			"policies attached to arn:aws:iam::111122223333:role/Dev not found in cache, run iamsnitch refresh",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := *role
+			r.Policies = tt.attached
+			rules, err := tt.overlay.Rebuild(&r, tt.current, []model.Policy{read, write})
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+
+			got := make([]access, 0, len(rules))
+			for _, r := range rules {
+				require.Equal(t, model.NewRoleGrant(role.ARN), r.GrantChain[0])
+				got = append(got, access{r.Principal.ID, rulePolicy(&r), r.Permission.ID})
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func rulePolicy(r *model.AccessControlRule) string {
+	for _, g := range r.GrantChain {
+		if pg, ok := g.(model.PolicyGrant); ok {
+			return pg.ID
+		}
+	}
+	return ""
+}
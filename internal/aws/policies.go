@@ -2,6 +2,8 @@ package aws
 
 import (
 	"encoding/json"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
 )
 
 type Policy struct {
@@ -47,3 +49,25 @@ func NewAssumePolicy(policyDocument string) (*AssumePolicy, error) {
 
 	return &policy, nil
 }
+
+// policyVersion is the current version of the IAM policy language.
+const policyVersion = "2012-10-17"
+
+// NewSuggestedPolicy lays the statements of a suggestion out as an identity
+// policy document.
+func NewSuggestedPolicy(s *model.PolicySuggestion) *Policy {
+	policy := &Policy{Version: policyVersion, Statements: make([]Statement, 0, len(s.Statements))}
+	for _, st := range s.Statements {
+		var conditions []Condition
+		for _, c := range st.Conditions {
+			conditions = append(conditions, Condition{Operator: c.Operator, Key: c.Key, Values: c.Values})
+		}
+		policy.Statements = append(policy.Statements, Statement{
+			Effect:     "Allow",
+			Actions:    st.Actions,
+			Resources:  st.Resources,
+			Conditions: conditions,
+		})
+	}
+	return policy
+}
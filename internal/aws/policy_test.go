@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
 	"github.com/stretchr/testify/require"
 )
 
@@ -110,3 +111,35 @@ func TestDeserialisePolicyFromJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestNewSuggestedPolicy(t *testing.T) {
+	policy := NewSuggestedPolicy(&model.PolicySuggestion{
+		Statements: []model.SuggestedStatement{
+			{
+				Actions:    []string{"s3:GetObject"},
+				Resources:  []string{"arn:aws:s3:::bucket/key"},
+				Conditions: []model.Condition{{Operator: "Bool", Key: "aws:MultiFactorAuthPresent", Values: []string{"true"}}},
+			},
+			{Actions: []string{"sqs:SendMessage"}, Resources: []string{"arn:aws:sqs:us-east-1:111122223333:queue"}},
+		},
+	})
+
+	data, err := json.Marshal(policy)
+	require.Nil(t, err)
+	require.JSONEq(t, `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Action": "s3:GetObject",
+				"Resource": "arn:aws:s3:::bucket/key",
+				"Condition": {"Bool": {"aws:MultiFactorAuthPresent": "true"}}
+			},
+			{
+				"Effect": "Allow",
+				"Action": "sqs:SendMessage",
+				"Resource": "arn:aws:sqs:us-east-1:111122223333:queue"
+			}
+		]
+	}`, string(data))
+}
@@ -32,7 +32,29 @@ func (pl *PrincipalList) UnmarshalJSON(data []byte) error {
 	return pl.parsePrincipalList(v)
 }
 
+// MarshalJSON writes the principals by type, or * alone when any AWS
+// principal is allowed.
+func (pl PrincipalList) MarshalJSON() ([]byte, error) {
+	if len(pl.Items) == 1 && pl.Items[0] == (Principal{AWS, "*"}) {
+		return json.Marshal("*")
+	}
+
+	byType := make(map[Type][]string)
+	for _, p := range pl.Items {
+		byType[p.Type] = append(byType[p.Type], p.ID)
+	}
+	types := make(map[Type]interface{}, len(byType))
+	for t, ids := range byType {
+		types[t] = stringOrList(ids)
+	}
+	return json.Marshal(types)
+}
+
 func (pl *PrincipalList) parsePrincipalList(v interface{}) error {
+	if s, ok := v.(string); ok && s == "*" {
+		return pl.add(AWS, s)
+	}
+
 	pMap, ok := v.(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("invalid Principal found format")
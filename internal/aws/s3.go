@@ -0,0 +1,110 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+)
+
+// s3Timeout bounds each request to S3, reading the object included.
+const s3Timeout = 2 * time.Minute
+
+// CloudTrailS3 reads the CloudTrail logs delivered under an S3 prefix, a page
+// of the object listing per page.
+type CloudTrailS3 struct {
+	ctx    context.Context
+	cli    S3ClientIface
+	bucket string
+	prefix string
+}
+
+// NewCloudTrailS3 reads the logs under location, an s3://bucket/prefix URL.
+// The bucket is read from its own region, whatever the configured one.
+func NewCloudTrailS3(cfg *aws.Config, location string) (*CloudTrailS3, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 location %v, expected s3://bucket/prefix", location)
+	}
+
+	ctx := context.TODO()
+	httpClient := awshttp.NewBuildableClient().WithTimeout(s3Timeout)
+	region, err := manager.GetBucketRegion(ctx, s3.NewFromConfig(*cfg, func(o *s3.Options) {
+		o.HTTPClient = httpClient
+	}), u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the region of bucket %v: %w", u.Host, err)
+	}
+
+	return &CloudTrailS3{
+		ctx: ctx,
+		cli: s3.NewFromConfig(*cfg, func(o *s3.Options) {
+			o.Region = region
+			o.HTTPClient = httpClient
+		}),
+		bucket: u.Host,
+		prefix: strings.TrimPrefix(u.Path, "/"),
+	}, nil
+}
+
+func (s *CloudTrailS3) FetchUsage(page ports.PageIface) ([]model.Usage, ports.PageIface, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}
+	if page != nil && page.HasNext() {
+		input.ContinuationToken = page.Next()
+	}
+
+	listing, err := s.cli.ListObjectsV2(s.ctx, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list s3://%v/%v: %w", s.bucket, s.prefix, err)
+	}
+
+	var usage []model.Usage
+	for _, o := range listing.Contents {
+		key := aws.ToString(o.Key)
+		if !strings.HasSuffix(key, ".json") && !strings.HasSuffix(key, ".json.gz") {
+			continue
+		}
+		data, err := s.get(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to fetch CloudTrail log s3://%v/%v: %w", s.bucket, key, err)
+		}
+		u, err := ParseCloudTrail(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse CloudTrail log s3://%v/%v: %w", s.bucket, key, err)
+		}
+		usage = append(usage, u...)
+	}
+
+	var next *string
+	if listing.IsTruncated {
+		next = listing.NextContinuationToken
+	}
+	return usage, NewPageToken(next), nil
+}
+
+func (s *CloudTrailS3) get(key string) ([]byte, error) {
+	out, err := s.cli.GetObject(s.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
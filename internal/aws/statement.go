@@ -10,6 +10,39 @@ type Statement struct {
 	Principals PrincipalList `json:"Principal"`
 	Actions    []string      `json:"Action"`
 	Resources  []string      `json:"Resource"`
+	Conditions []Condition   `json:"Condition"`
+}
+
+// statementJSON lays a statement out the way IAM documents do, with single
+// actions and resources written as strings.
+type statementJSON struct {
+	Effect    string                            `json:"Effect"`
+	Principal *PrincipalList                    `json:"Principal,omitempty"`
+	Action    interface{}                       `json:"Action"`
+	Resource  interface{}                       `json:"Resource,omitempty"`
+	Condition map[string]map[string]interface{} `json:"Condition,omitempty"`
+}
+
+func (s Statement) MarshalJSON() ([]byte, error) {
+	sj := statementJSON{
+		Effect:    s.Effect,
+		Action:    stringOrList(s.Actions),
+		Condition: s.marshalConditions(),
+	}
+	if len(s.Principals.Items) > 0 {
+		sj.Principal = &s.Principals
+	}
+	if len(s.Resources) > 0 {
+		sj.Resource = stringOrList(s.Resources)
+	}
+	return json.Marshal(sj)
+}
+
+func stringOrList(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
 }
 
 func (s *Statement) UnmarshalJSON(data []byte) error {
@@ -44,6 +77,13 @@ func (s *Statement) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	conditions, ok := mapStmt["Condition"]
+	if ok {
+		if err := s.unmarshalConditions(conditions); err != nil {
+			return err
+		}
+	}
+
 	resources, ok := mapStmt["Resource"]
 	if ok {
 		return s.unmarshalResources(resources)
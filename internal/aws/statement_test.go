@@ -83,6 +83,34 @@ func TestDeserialiseStatementFromJSON(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"wildcard principal with conditions",
+			`{
+				"Effect":"Allow",
+				"Principal": "*",
+				"Action":"sts:AssumeRole",
+				"Condition": {
+					"StringEquals": {
+						"aws:SourceAccount": "111122223333",
+						"aws:PrincipalOrgID": ["o-1", "o-2"]
+					},
+					"Bool": {
+						"aws:MultiFactorAuthPresent": true
+					}
+				}
+			}`,
+			&Statement{
+				Effect:     "Allow",
+				Principals: PrincipalList{Items: []Principal{{AWS, "*"}}},
+				Actions:    []string{"sts:AssumeRole"},
+				Conditions: []Condition{
+					{"Bool", "aws:MultiFactorAuthPresent", []string{"true"}},
+					{"StringEquals", "aws:PrincipalOrgID", []string{"o-1", "o-2"}},
+					{"StringEquals", "aws:SourceAccount", []string{"111122223333"}},
+				},
+			},
+			nil,
+		},
 	}
 
 	for _, test := range tests {
@@ -101,3 +129,72 @@ func TestDeserialiseStatementFromJSON(t *testing.T) {
 	}
 
 }
+
+func TestSerialiseStatementToJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement Statement
+		want      string
+	}{
+		{
+			"single action and resource",
+			Statement{
+				Effect:    "Allow",
+				Actions:   []string{"ec2:DescribeInstance"},
+				Resources: []string{"*"},
+			},
+			`{"Effect": "Allow", "Action": "ec2:DescribeInstance", "Resource": "*"}`,
+		},
+		{
+			"trust statement",
+			Statement{
+				Effect: "Allow",
+				Principals: PrincipalList{Items: []Principal{
+					{Service, "ec2.amazonaws.com"},
+					{AWS, "arn:aws:iam::111122223333:root"},
+					{AWS, "arn:aws:iam::444455556666:root"},
+				}},
+				Actions: []string{"sts:AssumeRole", "sts:TagSession"},
+				Conditions: []Condition{
+					{"Bool", "aws:MultiFactorAuthPresent", []string{"true"}},
+					{"StringEquals", "aws:PrincipalOrgID", []string{"o-1", "o-2"}},
+					{"StringEquals", "aws:SourceAccount", []string{"111122223333"}},
+				},
+			},
+			`{
+				"Effect": "Allow",
+				"Principal": {
+					"AWS": ["arn:aws:iam::111122223333:root", "arn:aws:iam::444455556666:root"],
+					"Service": "ec2.amazonaws.com"
+				},
+				"Action": ["sts:AssumeRole", "sts:TagSession"],
+				"Condition": {
+					"Bool": {"aws:MultiFactorAuthPresent": "true"},
+					"StringEquals": {"aws:PrincipalOrgID": ["o-1", "o-2"], "aws:SourceAccount": "111122223333"}
+				}
+			}`,
+		},
+		{
+			"any principal",
+			Statement{
+				Effect:     "Deny",
+				Principals: PrincipalList{Items: []Principal{{AWS, "*"}}},
+				Actions:    []string{"s3:*"},
+				Resources:  []string{"arn:aws:s3:::bucket", "arn:aws:s3:::bucket/*"},
+			},
+			`{"Effect": "Deny", "Principal": "*", "Action": "s3:*", "Resource": ["arn:aws:s3:::bucket", "arn:aws:s3:::bucket/*"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.statement)
+			require.Nil(t, err)
+			require.JSONEq(t, test.want, string(data))
+
+			var statement Statement
+			require.Nil(t, json.Unmarshal(data, &statement))
+			require.Equal(t, test.statement, statement)
+		})
+	}
+}
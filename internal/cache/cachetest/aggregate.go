@@ -0,0 +1,140 @@
+// Package cachetest holds the conformance tests every implementation of
+// ports.CacheIface runs, so the caches keep the same semantics.
+package cachetest
+
+import (
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAggregate checks the groups Aggregate returns on a cache built by
+// newCache for each case.
+func TestAggregate(t *testing.T, newCache func(t *testing.T) ports.CacheIface) {
+	rules := aggregateRules()
+	wildcards := append(aggregateRules(),
+		aggregateRule("AWS[c]", "s3:*", "*", "arn:aws:iam::111122223333:policy/P3"),
+		aggregateRule("AWS[d]", "*", "*", "arn:aws:iam::111122223333:policy/P3"),
+	)
+
+	tests := []struct {
+		name   string
+		rules  []model.AccessControlRule
+		filter model.Filter
+		agg    model.Aggregation
+		want   []model.Group
+	}{
+		{
+			"actions per principal",
+			rules,
+			model.Filter{},
+			model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByPermission},
+			[]model.Group{
+				{Key: "AWS[a]", Count: 3, Values: []string{"iam:AttachRolePolicy", "s3:GetObject", "s3:PutObject"}},
+				{Key: "AWS[b]", Count: 1, Values: []string{"s3:GetObject"}},
+				{Key: "Service[ec2.amazonaws.com]", Count: 1, Values: []string{"ec2:DescribeInstances"}},
+			},
+		},
+		{
+			"wildcard actions per principal",
+			wildcards,
+			model.Filter{},
+			model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByPermission},
+			[]model.Group{
+				{Key: "AWS[d]", Count: 4, Values: []string{"*"}},
+				{Key: "AWS[a]", Count: 3, Values: []string{"iam:AttachRolePolicy", "s3:GetObject", "s3:PutObject"}},
+				{Key: "AWS[c]", Count: 2, Values: []string{"s3:*"}},
+				{Key: "AWS[b]", Count: 1, Values: []string{"s3:GetObject"}},
+				{Key: "Service[ec2.amazonaws.com]", Count: 1, Values: []string{"ec2:DescribeInstances"}},
+			},
+		},
+		{
+			"write actions",
+			rules,
+			model.Filter{},
+			model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByPermission, Levels: []model.AccessLevel{model.Write, model.PermissionsManagement}},
+			[]model.Group{
+				{Key: "AWS[a]", Count: 2, Values: []string{"iam:AttachRolePolicy", "s3:PutObject"}},
+			},
+		},
+		{
+			"principals per policy",
+			rules,
+			model.Filter{},
+			model.Aggregation{GroupBy: model.ByPolicy, Count: model.ByPrincipal},
+			[]model.Group{
+				{Key: "arn:aws:iam::111122223333:policy/P2", Count: 2, Values: []string{"AWS[a]", "AWS[b]"}},
+				{Key: "arn:aws:iam::111122223333:policy/P1", Count: 1, Values: []string{"AWS[a]"}},
+			},
+		},
+		{
+			"services per principal",
+			rules,
+			model.Filter{},
+			model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByService, Limit: 1},
+			[]model.Group{
+				{Key: "AWS[a]", Count: 2, Values: []string{"iam", "s3"}},
+			},
+		},
+		{
+			"wildcard services per principal",
+			wildcards,
+			model.Filter{Principals: []string{"AWS[d]"}},
+			model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByService},
+			[]model.Group{
+				{Key: "AWS[d]", Count: 1, Values: []string{"*"}},
+			},
+		},
+		{
+			"filtered",
+			rules,
+			model.Filter{Resources: []string{"arn:aws:s3:::bucket/key"}, Via: model.Via{Types: []string{model.ManagedPolicy}}},
+			model.Aggregation{GroupBy: model.ByResource, Count: model.ByPermission},
+			[]model.Group{
+				{Key: "*", Count: 3, Values: []string{"iam:AttachRolePolicy", "s3:GetObject", "s3:PutObject"}},
+				{Key: "arn:aws:s3:::bucket/*", Count: 1, Values: []string{"s3:GetObject"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCache(t)
+			require.Nil(t, c.SaveACL(tt.rules))
+
+			got, err := c.Aggregate(&tt.filter, &tt.agg)
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := newCache(t).Aggregate(&model.Filter{}, &model.Aggregation{GroupBy: model.ByPrincipal, Count: "effect"})
+	require.EqualError(t, err, `unknown aggregation field "effect"`)
+}
+
+// aggregateRules are rules of a few principals granted by several policies,
+// or by a trust policy alone.
+func aggregateRules() []model.AccessControlRule {
+	return []model.AccessControlRule{
+		aggregateRule("AWS[a]", "s3:GetObject", "arn:aws:s3:::bucket/*", "arn:aws:iam::111122223333:policy/P1"),
+		aggregateRule("AWS[a]", "s3:PutObject", "*", "arn:aws:iam::111122223333:policy/P1"),
+		aggregateRule("AWS[a]", "iam:AttachRolePolicy", "*", "arn:aws:iam::111122223333:policy/P2"),
+		aggregateRule("AWS[b]", "s3:GetObject", "*", "arn:aws:iam::111122223333:policy/P2"),
+		aggregateRule("Service[ec2.amazonaws.com]", "ec2:DescribeInstances", "*", ""),
+	}
+}
+
+func aggregateRule(principal string, permission string, resource string, policy string) model.AccessControlRule {
+	r := model.AccessControlRule{
+		Principal:  model.Principal{ID: principal},
+		Permission: model.Permission{ID: permission},
+		Resource:   model.Resource{ID: resource},
+		GrantChain: []model.GrantIface{model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole")},
+	}
+	if policy != "" {
+		r.GrantChain = append(r.GrantChain, model.NewPolicyGrant(policy))
+	}
+	return r
+}
@@ -0,0 +1,901 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormCache implements ports.CacheIface on any gorm dialect that provides a
+// match(pattern, value) SQL function with the semantics of wildcard.Match.
+type gormCache struct {
+	db *gorm.DB
+}
+
+// saveBatchSize bounds the rules written per statement, keeping the number of
+// bound variables under the limits of the databases.
+const saveBatchSize = 500
+
+// SaveACL upserts the rules by RuleID and replaces their grant chains. All the
+// rules are written in a single transaction, so a failed save leaves the cache
+// as it was.
+func (c *gormCache) SaveACL(rules []model.AccessControlRule) error {
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(rules); start += saveBatchSize {
+			end := start + saveBatchSize
+			if end > len(rules) {
+				end = len(rules)
+			}
+			if err := saveRules(tx, rules[start:end]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"rules": len(rules),
+			"error": err,
+		}).Error("failed to save rules to cache")
+		return err
+	}
+
+	fmt.Printf("%v rules saved to cache\n", len(rules))
+	return nil
+}
+
+// PruneACL deletes the rules granted through via, with their grant chains,
+// that weren't saved since before. It ends a refresh, so the statistics of the
+// tables are updated once all the rules are saved.
+func (c *gormCache) PruneACL(via *model.Via, before time.Time) error {
+	var ids []uint
+	tx := c.whereVia(c.db.Model(&AccessControlRule{}), via, false).
+		Where("access_control_rules.updated_at < ?", before).
+		Pluck("access_control_rules.id", &ids)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		return deleteRules(tx, ids)
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"rules": len(ids),
+			"error": err,
+		}).Error("failed to prune rules from cache")
+		return err
+	}
+
+	fmt.Printf("%v stale rules pruned from cache\n", len(ids))
+	analyze(c.db)
+	return nil
+}
+
+// deleteRules deletes the rules and their grant chains for good, so their
+// rule IDs can be saved again.
+func deleteRules(tx *gorm.DB, ids []uint) error {
+	for start := 0; start < len(ids); start += saveBatchSize {
+		end := start + saveBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := tx.Unscoped().Where("access_control_rule_id IN ?", ids[start:end]).Delete(&Grant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id IN ?", ids[start:end]).Delete(&AccessControlRule{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveRules(tx *gorm.DB, rules []model.AccessControlRule) error {
+	// a statement can't upsert the same row twice, the last rule wins
+	byID := make(map[string]*AccessControlRule, len(rules))
+	batch := make([]*AccessControlRule, 0, len(rules))
+	for i := range rules {
+		r, err := NewRule(&rules[i])
+		if err != nil {
+			return err
+		}
+		if prev, ok := byID[r.RuleID]; ok {
+			*prev = *r
+			continue
+		}
+		byID[r.RuleID] = r
+		batch = append(batch, r)
+	}
+
+	if err := saveReferences(tx, batch); err != nil {
+		return err
+	}
+
+	ruleIDs := make([]string, 0, len(batch))
+	for _, r := range batch {
+		ruleIDs = append(ruleIDs, r.RuleID)
+	}
+
+	result := tx.
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "rule_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"principal_id", "permission", "service", "resource_id", "statement_id", "updated_at",
+			}),
+		}).
+		Create(&batch)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// upserted rows don't report their primary key on every dialect
+	var saved []AccessControlRule
+	if err := tx.Unscoped().Select("id", "rule_id").Where("rule_id IN ?", ruleIDs).Find(&saved).Error; err != nil {
+		return err
+	}
+
+	ids := make([]uint, 0, len(saved))
+	var grants []Grant
+	for _, s := range saved {
+		ids = append(ids, s.ID)
+		for _, g := range byID[s.RuleID].GrantChain {
+			g.AccessControlRuleID = s.ID
+			grants = append(grants, g)
+		}
+	}
+
+	if err := tx.Unscoped().Where("access_control_rule_id IN ?", ids).Delete(&Grant{}).Error; err != nil {
+		return err
+	}
+	if len(grants) == 0 {
+		return nil
+	}
+	return tx.Omit(clause.Associations).CreateInBatches(grants, saveBatchSize).Error
+}
+
+// saveReferences inserts the principals, resources, roles, policies and
+// statements the rules refer to, keeping the ones already cached as they are,
+// and sets the foreign keys of the rules and their grant chains.
+func saveReferences(tx *gorm.DB, rules []*AccessControlRule) error {
+	var principals []*Principal
+	var resources []*Resource
+	var roles []*Role
+	var policies []*Policy
+	var principalKeys, resourceKeys, roleKeys, policyKeys naturalKeys
+	for _, r := range rules {
+		if principalKeys.add(r.Principal.Name) {
+			principals = append(principals, &r.Principal)
+		}
+		if resourceKeys.add(r.Resource.ARN) {
+			resources = append(resources, &r.Resource)
+		}
+		for _, g := range r.GrantChain {
+			if g.Role != nil && roleKeys.add(g.Role.ARN) {
+				roles = append(roles, g.Role)
+			}
+			if g.Policy != nil && policyKeys.add(g.Policy.ARN) {
+				policies = append(policies, g.Policy)
+			}
+		}
+	}
+
+	principalIDs, err := ensure(tx, &principals, "name", principalKeys.keys)
+	if err != nil {
+		return err
+	}
+	resourceIDs, err := ensure(tx, &resources, "arn", resourceKeys.keys)
+	if err != nil {
+		return err
+	}
+	roleIDs, err := ensure(tx, &roles, "arn", roleKeys.keys)
+	if err != nil {
+		return err
+	}
+	policyIDs, err := ensure(tx, &policies, "arn", policyKeys.keys)
+	if err != nil {
+		return err
+	}
+
+	statementIDs, err := ensureStatements(tx, rules, policyIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rules {
+		r.PrincipalID = principalIDs[r.Principal.Name]
+		r.ResourceID = resourceIDs[r.Resource.ARN]
+		for i := range r.GrantChain {
+			g := &r.GrantChain[i]
+			if g.Role != nil {
+				id := roleIDs[g.Role.ARN]
+				g.RoleID = &id
+			}
+			if g.Policy != nil {
+				id := policyIDs[g.Policy.ARN]
+				g.PolicyID = &id
+			}
+		}
+		if r.Statement != nil {
+			id := statementIDs[statementKey{policyIDs[r.Statement.Policy.ARN], r.Statement.StatementIndex}]
+			r.StatementID = &id
+		}
+	}
+	return nil
+}
+
+type statementKey struct {
+	policyID uint
+	index    int
+}
+
+func ensureStatements(tx *gorm.DB, rules []*AccessControlRule, policyIDs map[string]uint) (map[statementKey]uint, error) {
+	var statements []*Statement
+	var policies []uint
+	seen := make(map[statementKey]bool)
+	for _, r := range rules {
+		if r.Statement == nil {
+			continue
+		}
+		k := statementKey{policyIDs[r.Statement.Policy.ARN], r.Statement.StatementIndex}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		statements = append(statements, &Statement{
+			PolicyID:       k.policyID,
+			StatementIndex: k.index,
+			Effect:         r.Statement.Effect,
+			Conditions:     r.Statement.Conditions,
+		})
+		policies = append(policies, k.policyID)
+	}
+	if len(statements) == 0 {
+		return nil, nil
+	}
+
+	// a new version of the policy can change what a statement says
+	err := tx.
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "policy_id"}, {Name: "statement_index"}},
+			DoUpdates: clause.AssignmentColumns([]string{"effect", "conditions", "updated_at"}),
+		}).
+		Create(&statements).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []Statement
+	if err := tx.Unscoped().Select("id", "policy_id", "statement_index").Where("policy_id IN ?", policies).Find(&saved).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make(map[statementKey]uint, len(saved))
+	for _, s := range saved {
+		ids[statementKey{s.PolicyID, s.StatementIndex}] = s.ID
+	}
+	return ids, nil
+}
+
+// ensure inserts the rows that aren't cached yet, leaving the others as they
+// are, and returns the id of every row by its natural key stored in column.
+func ensure(tx *gorm.DB, rows interface{}, column string, keys []string) (map[string]uint, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(rows).Error; err != nil {
+		return nil, err
+	}
+
+	var saved []struct {
+		ID         uint
+		NaturalKey string
+	}
+	err := tx.Model(rows).Unscoped().
+		Select("id, "+column+" AS natural_key").
+		Where(column+" IN ?", keys).
+		Scan(&saved).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]uint, len(saved))
+	for _, s := range saved {
+		ids[s.NaturalKey] = s.ID
+	}
+	return ids, nil
+}
+
+// naturalKeys collects the distinct keys of the rows to ensure.
+type naturalKeys struct {
+	seen map[string]bool
+	keys []string
+}
+
+func (k *naturalKeys) add(key string) bool {
+	if k.seen == nil {
+		k.seen = make(map[string]bool)
+	}
+	if k.seen[key] {
+		return false
+	}
+	k.seen[key] = true
+	k.keys = append(k.keys, key)
+	return true
+}
+
+// findBatchSize bounds the rules, and their grant chains, held in memory at
+// once by FindEach.
+const findBatchSize = 1000
+
+// sortColumns are the columns holding each sort field.
+var sortColumns = map[string]clause.Column{
+	model.SortByPrincipal:  {Table: "Principal", Name: "name"},
+	model.SortByPermission: {Table: clause.CurrentTable, Name: "permission"},
+	model.SortByResource:   {Table: "Resource", Name: "arn"},
+}
+
+func (c *gormCache) Find(filter *model.Filter) ([]model.AccessControlRule, error) {
+	acl := make([]model.AccessControlRule, 0)
+	err := c.FindEach(filter, func(r model.AccessControlRule) error {
+		acl = append(acl, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// FindEach narrows wildcard filters down to the rules with a compatible
+// service or resource prefix, so match() is only evaluated on those
+// candidates. The rules are read in batches, each starting after the sort key
+// of the last rule of the previous one, so going through all of them doesn't
+// load them all or rescan the ones already read.
+func (c *gormCache) FindEach(filter *model.Filter, fn func(model.AccessControlRule) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	fields, _ := model.SortFields(filter.Sort)
+
+	// without a sort, rules come in the order they were saved
+	columns := []clause.Column{{Table: clause.CurrentTable, Name: "id"}}
+	if len(fields) > 0 {
+		columns = make([]clause.Column, 0, len(fields)+1)
+		for _, f := range fields {
+			columns = append(columns, sortColumns[f])
+		}
+		columns = append(columns, clause.Column{Table: clause.CurrentTable, Name: "rule_id"})
+	}
+
+	var after []interface{}
+	for _, k := range filter.After {
+		after = append(after, k)
+	}
+	offset, remaining := filter.Offset, filter.Limit
+
+	for {
+		size := findBatchSize
+		if filter.Limit > 0 && remaining < size {
+			size = remaining
+		}
+		if size == 0 {
+			return nil
+		}
+
+		var rules []AccessControlRule
+		tx := c.findQuery(filter)
+		if after != nil {
+			tx = tx.Where(afterKey(columns, after))
+		}
+		orderBy := make([]clause.OrderByColumn, 0, len(columns))
+		for _, col := range columns {
+			orderBy = append(orderBy, clause.OrderByColumn{Column: col})
+		}
+		tx = tx.Clauses(clause.OrderBy{Columns: orderBy}).Offset(offset).Limit(size).Find(&rules)
+		if tx.Error != nil {
+			return tx.Error
+		}
+
+		for _, r := range rules {
+			mr, err := r.Map()
+			if err != nil {
+				return err
+			}
+			if err := fn(mr); err != nil {
+				return err
+			}
+		}
+
+		if len(rules) < size {
+			return nil
+		}
+		offset = 0
+		remaining -= len(rules)
+		after = rowKey(&rules[len(rules)-1], fields)
+	}
+}
+
+func (c *gormCache) findQuery(filter *model.Filter) *gorm.DB {
+	tx := c.db.
+		Joins("Principal").
+		Joins("Resource").
+		Joins("Statement").
+		Preload("GrantChain", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("GrantChain.Role").
+		Preload("GrantChain.Policy")
+	return c.whereFilter(tx, filter)
+}
+
+// whereFilter keeps the rules matching the filter.
+func (c *gormCache) whereFilter(tx *gorm.DB, filter *model.Filter) *gorm.DB {
+	tx = c.whereRelated(tx, "access_control_rules.resource_id", &Resource{}, "arn", filter.Resources, filter.ExactMatch, resourceCandidates)
+	tx = whereMatches(tx, "access_control_rules.permission", filter.Permissions, filter.ExactMatch, permissionCandidates)
+	tx = c.whereRelated(tx, "access_control_rules.principal_id", &Principal{}, "name", filter.Principals, filter.ExactMatch, nil)
+	if !filter.IncludeDeny {
+		denies := c.db.Model(&Statement{}).Select("id").Where("LOWER(effect) = ?", "deny")
+		tx = tx.Where("(access_control_rules.statement_id IS NULL OR access_control_rules.statement_id NOT IN (?))", denies)
+	}
+	return c.whereVia(tx, &filter.Via, filter.ExactMatch)
+}
+
+// afterKey keeps the rows sorted after key, comparing the sort columns as a
+// row value.
+func afterKey(columns []clause.Column, key []interface{}) clause.Expr {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	vars := make([]interface{}, 0, 2*len(columns))
+	for _, col := range columns {
+		vars = append(vars, col)
+	}
+	return clause.Expr{
+		SQL:  fmt.Sprintf("(%s) > (%s)", placeholders, placeholders),
+		Vars: append(vars, key...),
+	}
+}
+
+// rowKey is the value of the sort columns for the rule.
+func rowKey(r *AccessControlRule, fields []string) []interface{} {
+	if len(fields) == 0 {
+		return []interface{}{r.ID}
+	}
+	key := make([]interface{}, 0, len(fields)+1)
+	for _, f := range fields {
+		switch f {
+		case model.SortByPrincipal:
+			key = append(key, r.Principal.Name)
+		case model.SortByPermission:
+			key = append(key, r.Permission)
+		case model.SortByResource:
+			key = append(key, r.Resource.ARN)
+		}
+	}
+	return append(key, r.RuleID)
+}
+
+// aggregateColumns hold the values of each aggregation field in the query
+// built by Aggregate.
+var aggregateColumns = map[string]string{
+	model.ByPrincipal:  "principals.name",
+	model.ByPermission: "access_control_rules.permission",
+	model.ByService:    "access_control_rules.service",
+	model.ByResource:   "resources.arn",
+	model.ByPolicy:     "policies.arn",
+}
+
+// Aggregate has the database reduce the rules to their distinct groups and
+// values, which are then tallied. The permission is only needed to check the
+// access levels, which are known to the domain model only.
+func (c *gormCache) Aggregate(filter *model.Filter, agg *model.Aggregation) ([]model.Group, error) {
+	if err := agg.Validate(); err != nil {
+		return nil, err
+	}
+
+	columns := []string{
+		aggregateColumns[agg.GroupBy] + " AS group_key",
+		aggregateColumns[agg.Count] + " AS value",
+	}
+	if len(agg.Levels) > 0 {
+		columns = append(columns, "access_control_rules.permission AS permission")
+	}
+
+	var rows []struct {
+		GroupKey   *string
+		Value      *string
+		Permission string
+	}
+	tx := c.db.
+		Model(&AccessControlRule{}).
+		Joins("JOIN principals ON principals.id = access_control_rules.principal_id").
+		Joins("JOIN resources ON resources.id = access_control_rules.resource_id").
+		Joins("LEFT JOIN statements ON statements.id = access_control_rules.statement_id").
+		Joins("LEFT JOIN policies ON policies.id = statements.policy_id")
+	tx = c.whereFilter(tx, filter).Distinct(columns).Scan(&rows)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	tally := model.NewTally(agg)
+	for _, r := range rows {
+		if r.GroupKey != nil && r.Value != nil {
+			tally.Add(*r.GroupKey, *r.Value, r.Permission)
+		}
+	}
+	return tally.Groups(), nil
+}
+
+func (c *gormCache) SaveResources(resources []model.Resource) error {
+	for _, r := range resources {
+		result := c.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "arn"}},
+			DoUpdates: clause.AssignmentColumns([]string{"type", "updated_at"}),
+		}).Create(NewResource(&r))
+		if result.Error != nil {
+			logrus.WithFields(logrus.Fields{
+				"resource": r,
+				"error":    result.Error,
+			}).Error("failed to save resource to cache")
+			return result.Error
+		}
+	}
+
+	fmt.Printf("%v resources saved to cache\n", len(resources))
+
+	return nil
+}
+
+func (c *gormCache) FindResources(filter *model.Filter) ([]model.Resource, error) {
+	var filteredResources []Resource
+
+	// resources without a type are only known as patterns granted by rules
+	tx := c.db.
+		Where("type <> ''").
+		Where(buildWhereExpr("arn", filter.Resources, filter.ExactMatch, resourceCandidates)).
+		Order("arn").
+		Find(&filteredResources)
+
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	resources := make([]model.Resource, 0, len(filteredResources))
+	for _, r := range filteredResources {
+		resources = append(resources, r.Map())
+	}
+
+	return resources, nil
+}
+
+func (c *gormCache) SaveRoles(roles []model.Role) error {
+	for _, r := range roles {
+		cr, err := NewRole(&r)
+		if err != nil {
+			return err
+		}
+
+		result := c.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "arn"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "create_date", "last_used", "trust", "policies", "updated_at"}),
+		}).Create(cr)
+		if result.Error != nil {
+			logrus.WithFields(logrus.Fields{
+				"role":  r.ARN,
+				"error": result.Error,
+			}).Error("failed to save role to cache")
+			return result.Error
+		}
+	}
+
+	fmt.Printf("%v roles saved to cache\n", len(roles))
+
+	return nil
+}
+
+// PruneRoles deletes the fetched roles matching any of the patterns that
+// weren't saved since before. The ones grant chains still refer to are only
+// reset to not fetched, their rules are pruned with the ACL.
+func (c *gormCache) PruneRoles(roles []string, before time.Time) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	var ids []uint
+	tx := c.db.Model(&Role{}).
+		Where("name <> ''").
+		Where("updated_at < ?", before).
+		Where(buildWhereExpr("arn", roles, false, nil)).
+		Pluck("id", &ids)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		referenced := tx.Unscoped().Model(&Grant{}).Select("role_id").Where("role_id IS NOT NULL")
+		err := tx.Unscoped().
+			Where("id IN ?", ids).
+			Where("id NOT IN (?)", referenced).
+			Delete(&Role{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Role{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{"name": "", "last_used": nil, "trust": "", "policies": ""}).Error
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"roles": len(ids),
+			"error": err,
+		}).Error("failed to prune roles from cache")
+		return err
+	}
+
+	fmt.Printf("%v stale roles pruned from cache\n", len(ids))
+	return nil
+}
+
+func (c *gormCache) FindRoles() ([]model.Role, error) {
+	var cachedRoles []Role
+
+	// roles only referenced by grant chains haven't been fetched yet
+	tx := c.db.Where("name <> ''").Order("arn").Find(&cachedRoles)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	roles := make([]model.Role, 0, len(cachedRoles))
+	for _, r := range cachedRoles {
+		mr, err := r.Map()
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, mr)
+	}
+
+	return roles, nil
+}
+
+func (c *gormCache) SavePolicies(policies []model.Policy) error {
+	for _, p := range policies {
+		result := c.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "arn"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "version", "document", "updated_at"}),
+		}).Create(NewPolicy(&p))
+		if result.Error != nil {
+			logrus.WithFields(logrus.Fields{
+				"policy": p.ARN,
+				"error":  result.Error,
+			}).Error("failed to save policy to cache")
+			return result.Error
+		}
+	}
+
+	fmt.Printf("%v policies saved to cache\n", len(policies))
+
+	return nil
+}
+
+func (c *gormCache) FindPolicies() ([]model.Policy, error) {
+	var cachedPolicies []Policy
+
+	// policies only referenced by grant chains haven't been fetched yet
+	tx := c.db.Where("name <> ''").Order("arn").Find(&cachedPolicies)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	policies := make([]model.Policy, 0, len(cachedPolicies))
+	for _, p := range cachedPolicies {
+		policies = append(policies, p.Map())
+	}
+
+	return policies, nil
+}
+
+// SaveUsage upserts the usage by identity, action and resource, only moving
+// LastUsed forward so logs can be ingested in any order.
+func (c *gormCache) SaveUsage(usage []model.Usage) error {
+	usage = model.MergeUsage(usage)
+	batch := make([]*Usage, 0, len(usage))
+	for i := range usage {
+		batch = append(batch, NewUsage(&usage[i]))
+	}
+
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(batch); start += saveBatchSize {
+			end := start + saveBatchSize
+			if end > len(batch) {
+				end = len(batch)
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "identity"}, {Name: "action"}, {Name: "resource"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"last_used":  gorm.Expr("CASE WHEN excluded.last_used > usages.last_used THEN excluded.last_used ELSE usages.last_used END"),
+					"updated_at": gorm.Expr("excluded.updated_at"),
+				}),
+			}).Create(batch[start:end]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"usage": len(usage),
+			"error": err,
+		}).Error("failed to save usage to cache")
+		return err
+	}
+
+	fmt.Printf("%v usage records saved to cache\n", len(usage))
+	return nil
+}
+
+func (c *gormCache) FindUsage(since time.Time) ([]model.Usage, error) {
+	var cachedUsage []Usage
+	tx := c.db.Where("last_used >= ?", since.UTC()).Order("identity, action, resource").Find(&cachedUsage)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	usage := make([]model.Usage, 0, len(cachedUsage))
+	for _, u := range cachedUsage {
+		usage = append(usage, u.Map())
+	}
+	return usage, nil
+}
+
+// whereRelated keeps the rows whose foreign key points to a row of the related
+// table with a column matching any of the filters.
+func (c *gormCache) whereRelated(tx *gorm.DB, foreignKey string, related interface{}, column string, filters []string, exact bool, candidates func(string) clause.Expression) *gorm.DB {
+	if len(filters) == 0 {
+		return tx
+	}
+	matching := c.db.Model(related).Select("id").Where(buildWhereExpr(column, filters, exact, candidates))
+	return tx.Where(foreignKey+" IN (?)", matching)
+}
+
+// whereVia keeps the rules with a grant chain going through the policies and
+// roles of via, and granted by a policy of one of its types.
+func (c *gormCache) whereVia(tx *gorm.DB, via *model.Via, exact bool) *gorm.DB {
+	grantsThrough := func(foreignKey string, related interface{}, filters []string) {
+		if len(filters) == 0 {
+			return
+		}
+		grants := c.whereRelated(c.db.Model(&Grant{}).Select("access_control_rule_id"), foreignKey, related, "arn", filters, exact, nil)
+		tx = tx.Where("access_control_rules.id IN (?)", grants)
+	}
+	grantsThrough("policy_id", &Policy{}, via.Policies)
+	grantsThrough("role_id", &Role{}, via.Roles)
+
+	if len(via.Types) > 0 {
+		policies := c.db.Model(&Policy{}).Select("id").Where("type IN ?", via.Types)
+		statements := c.db.Model(&Statement{}).Select("id").Where("policy_id IN (?)", policies)
+		tx = tx.Where("access_control_rules.statement_id IN (?)", statements)
+	}
+	return tx
+}
+
+func whereMatches(tx *gorm.DB, column string, filters []string, exact bool, candidates func(string) clause.Expression) *gorm.DB {
+	if len(filters) == 0 {
+		return tx
+	}
+	return tx.Where(buildWhereExpr(column, filters, exact, candidates))
+}
+
+// buildWhereExpr matches column against any of the filters. When candidates is
+// given, its expression for each filter is ANDed with the match so the
+// database can use an index to discard rows before calling match().
+func buildWhereExpr(column string, filters []string, exact bool, candidates func(string) clause.Expression) clause.Where {
+	operation := "match(%s, ?)"
+	if exact {
+		operation = "%s = ?"
+	}
+
+	exprs := make([]clause.Expression, 0, len(filters))
+	for _, v := range filters {
+		var expr clause.Expression = clause.Expr{
+			SQL:  fmt.Sprintf(operation, column),
+			Vars: []interface{}{v},
+		}
+		if !exact && candidates != nil {
+			if c := candidates(v); c != nil {
+				expr = clause.And(c, expr)
+			}
+		}
+		exprs = append(exprs, expr)
+	}
+
+	return clause.Where{
+		Exprs: []clause.Expression{
+			clause.OrConditions{
+				Exprs: exprs,
+			},
+		},
+	}
+}
+
+// stringRule is the rule as cached before it referred to other tables.
+type stringRule struct {
+	Principal string
+}
+
+func (stringRule) TableName() string {
+	return "access_control_rules"
+}
+
+// analyzedTables are the ones the query planners need statistics on to tell
+// the prefix indexes are more selective than deleted_at.
+var analyzedTables = []string{"access_control_rules", "principals", "resources"}
+
+// analyze updates the statistics of the tables. It's only worth it after the
+// rules changed in bulk, failing only leaves the planner with stale ones.
+func analyze(db *gorm.DB) {
+	for _, t := range analyzedTables {
+		if err := db.Exec("ANALYZE " + t).Error; err != nil {
+			logrus.WithFields(logrus.Fields{
+				"table": t,
+				"error": err,
+			}).Warn("failed to analyze table")
+		}
+	}
+}
+
+// ErrIncompatibleSchema is returned when the cached rules can't be migrated
+// and weren't allowed to be dropped.
+var ErrIncompatibleSchema = errors.New("cache schema is incompatible, its access control rules have to be dropped and refreshed")
+
+// migrate updates the schema, only dropping the rules it can't migrate when
+// dropIncompatible is set.
+func migrate(db *gorm.DB, dropIncompatible bool) error {
+	// rules used to keep principals, resources and grants as plain strings,
+	// they have to be refreshed into the new tables
+	if db.Migrator().HasColumn(&stringRule{}, "principal") {
+		if !dropIncompatible {
+			return ErrIncompatibleSchema
+		}
+		logrus.Warn("cache schema changed, run refresh to repopulate the access control rules")
+		if err := db.Migrator().DropTable("grants", "access_control_rules"); err != nil {
+			return err
+		}
+	}
+
+	err := db.AutoMigrate(
+		&Principal{},
+		&Resource{},
+		&Role{},
+		&Policy{},
+		&Statement{},
+		&AccessControlRule{},
+		&Grant{},
+		&Usage{},
+	)
+	if err != nil {
+		return err
+	}
+	if err := backfillRuleIDs(db); err != nil {
+		return err
+	}
+	if err := backfillPolicyTypes(db); err != nil {
+		return err
+	}
+	if err := backfillPrefixes(db); err != nil {
+		return err
+	}
+
+	analyze(db)
+	return nil
+}
@@ -1,29 +1,48 @@
 package cache
 
 import (
-	"strings"
+	"fmt"
 
 	"github.com/jeandreh/iam-snitch/internal/domain/model"
 	"gorm.io/gorm"
 )
 
+const (
+	roleGrant   = "Role"
+	policyGrant = "Policy"
+)
+
+// Grant is an entry of the grant chain of a rule. Type tells which of the
+// references is set.
 type Grant struct {
 	gorm.Model
-	AccessControlRuleID uint
-	Value               string
+	AccessControlRuleID uint `gorm:"index"`
+	Position            int
+	Type                string
+	RoleID              *uint `gorm:"index"`
+	Role                *Role
+	PolicyID            *uint `gorm:"index"`
+	Policy              *Policy
 }
 
-func NewGrantChain(dg []model.GrantIface) []Grant {
+func NewGrantChain(dg []model.GrantIface) ([]Grant, error) {
 	gc := make([]Grant, 0, len(dg))
-	for _, g := range dg {
-		gc = append(gc, Grant{Value: g.String()})
+	for i, g := range dg {
+		switch v := g.(type) {
+		case model.RoleGrant:
+			gc = append(gc, Grant{Position: i, Type: roleGrant, Role: &Role{ARN: v.ID}})
+		case model.PolicyGrant:
+			gc = append(gc, Grant{Position: i, Type: policyGrant, Policy: NewPolicy(&model.Policy{ARN: v.ID})})
+		default:
+			return nil, fmt.Errorf("unable to cache grant %v", g)
+		}
 	}
-	return gc
+	return gc, nil
 }
 
 func (g *Grant) Map() model.GrantIface {
-	if strings.Index(g.Value, "Role:") == 0 {
-		return model.NewRoleGrant(strings.Replace(g.Value, "Role:", "", 1))
+	if g.Type == roleGrant {
+		return model.NewRoleGrant(g.Role.ARN)
 	}
-	return model.NewPolicyGrant(strings.Replace(g.Value, "Policy:", "", 1))
+	return model.NewPolicyGrant(g.Policy.ARN)
 }
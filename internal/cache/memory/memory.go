@@ -0,0 +1,543 @@
+// Package memory is a pure Go implementation of ports.CacheIface. It keeps
+// the semantics of the SQLite cache without needing CGO or a database file,
+// which makes it suitable for embedding the service in other tools and for
+// tests.
+package memory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+type Cache struct {
+	mu sync.RWMutex
+
+	rules []model.AccessControlRule
+	ids   map[string]int
+	// saved is when each rule was last saved
+	saved []time.Time
+
+	// byService and byPrincipal index rule positions by the service prefix of
+	// the permission and by principal. Rules without a key, such as a "*"
+	// permission, can match any filter and are kept apart.
+	byService         map[string]map[int]bool
+	wildcardServices  map[int]bool
+	byPrincipal       map[string]map[int]bool
+	wildcardPrincipal map[int]bool
+
+	resources map[string]model.Resource
+	roles     map[string]model.Role
+	// rolesSaved is when each role was last saved
+	rolesSaved map[string]time.Time
+	policies   map[string]model.Policy
+	usage      map[usageKey]model.Usage
+}
+
+type usageKey struct {
+	identity, action, resource string
+}
+
+func New() *Cache {
+	return &Cache{
+		ids:               make(map[string]int),
+		byService:         make(map[string]map[int]bool),
+		wildcardServices:  make(map[int]bool),
+		byPrincipal:       make(map[string]map[int]bool),
+		wildcardPrincipal: make(map[int]bool),
+		resources:         make(map[string]model.Resource),
+		roles:             make(map[string]model.Role),
+		rolesSaved:        make(map[string]time.Time),
+		policies:          make(map[string]model.Policy),
+		usage:             make(map[usageKey]model.Usage),
+	}
+}
+
+// SaveACL inserts new rules and replaces the ones already cached.
+func (c *Cache) SaveACL(rules []model.AccessControlRule) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, r := range rules {
+		id := r.ID()
+		if i, ok := c.ids[id]; ok {
+			c.saved[i] = now
+			c.unindex(i)
+			cr := &c.rules[i]
+			cr.Principal = r.Principal
+			cr.Permission = r.Permission
+			cr.Resource = r.Resource
+			cr.StatementIndex = r.StatementIndex
+			cr.Effect = r.Effect
+			cr.Conditions = append([]model.Condition(nil), r.Conditions...)
+			cr.GrantChain = append([]model.GrantIface{}, r.GrantChain...)
+			c.index(i)
+			continue
+		}
+
+		r.GrantChain = append([]model.GrantIface{}, r.GrantChain...)
+		r.Conditions = append([]model.Condition(nil), r.Conditions...)
+		c.ids[id] = len(c.rules)
+		c.rules = append(c.rules, r)
+		c.saved = append(c.saved, now)
+		c.index(len(c.rules) - 1)
+	}
+	return nil
+}
+
+// PruneACL deletes the rules granted through via that weren't saved since
+// before, then indexes the remaining ones again.
+func (c *Cache) PruneACL(via *model.Via, before time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rules, saved := c.rules[:0], c.saved[:0]
+	for i, r := range c.rules {
+		if c.saved[i].Before(before) && matchesVia(r.GrantChain, via, false) {
+			continue
+		}
+		rules = append(rules, r)
+		saved = append(saved, c.saved[i])
+	}
+	c.rules, c.saved = rules, saved
+
+	c.ids = make(map[string]int, len(c.rules))
+	c.byService = make(map[string]map[int]bool)
+	c.wildcardServices = make(map[int]bool)
+	c.byPrincipal = make(map[string]map[int]bool)
+	c.wildcardPrincipal = make(map[int]bool)
+	for i := range c.rules {
+		c.ids[c.rules[i].ID()] = i
+		c.index(i)
+	}
+	return nil
+}
+
+func (c *Cache) Find(filter *model.Filter) ([]model.AccessControlRule, error) {
+	acl := make([]model.AccessControlRule, 0)
+	err := c.FindEach(filter, func(r model.AccessControlRule) error {
+		acl = append(acl, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// FindEach calls fn on a copy of the matching rules, taken before the first
+// call so fn can use the cache.
+func (c *Cache) FindEach(filter *model.Filter, fn func(model.AccessControlRule) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	for _, r := range c.page(filter) {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) page(filter *model.Filter) []model.AccessControlRule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	type keyed struct {
+		key  []string
+		rule model.AccessControlRule
+	}
+	var matching []keyed
+	for _, i := range c.candidates(filter) {
+		r := c.rules[i]
+		if (filter.IncludeDeny || !r.Denies()) &&
+			matchesAny(r.Resource.ID, filter.Resources, filter.ExactMatch) &&
+			matchesAny(r.Permission.ID, filter.Permissions, filter.ExactMatch) &&
+			matchesAny(r.Principal.ID, filter.Principals, filter.ExactMatch) &&
+			matchesVia(r.GrantChain, &filter.Via, filter.ExactMatch) {
+			r.GrantChain = append([]model.GrantIface{}, r.GrantChain...)
+			var key []string
+			if filter.Sort != "" {
+				key = model.SortKey(filter.Sort, &r)
+			}
+			matching = append(matching, keyed{key, r})
+		}
+	}
+
+	if filter.Sort != "" {
+		sort.Slice(matching, func(i, j int) bool {
+			return lessKey(matching[i].key, matching[j].key)
+		})
+	}
+
+	start := 0
+	if filter.After != nil {
+		start = sort.Search(len(matching), func(i int) bool {
+			return lessKey(filter.After, matching[i].key)
+		})
+	}
+	start += filter.Offset
+	if start > len(matching) {
+		start = len(matching)
+	}
+	end := len(matching)
+	if filter.Limit > 0 && start+filter.Limit < end {
+		end = start + filter.Limit
+	}
+
+	acl := make([]model.AccessControlRule, 0, end-start)
+	for _, m := range matching[start:end] {
+		acl = append(acl, m.rule)
+	}
+	return acl
+}
+
+func (c *Cache) Aggregate(filter *model.Filter, agg *model.Aggregation) ([]model.Group, error) {
+	if err := agg.Validate(); err != nil {
+		return nil, err
+	}
+
+	tally := model.NewTally(agg)
+	err := c.FindEach(&model.Filter{
+		Principals:  filter.Principals,
+		Permissions: filter.Permissions,
+		Resources:   filter.Resources,
+		Via:         filter.Via,
+		ExactMatch:  filter.ExactMatch,
+		IncludeDeny: filter.IncludeDeny,
+	}, func(r model.AccessControlRule) error {
+		tally.Add(aggregateValue(agg.GroupBy, &r), aggregateValue(agg.Count, &r), r.Permission.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tally.Groups(), nil
+}
+
+func aggregateValue(field string, r *model.AccessControlRule) string {
+	switch field {
+	case model.ByPrincipal:
+		return r.Principal.ID
+	case model.ByPermission:
+		return r.Permission.ID
+	case model.ByService:
+		return model.ServiceOf(r.Permission.ID)
+	case model.ByResource:
+		return r.Resource.ID
+	case model.ByPolicy:
+		for i := len(r.GrantChain) - 1; i >= 0; i-- {
+			if p, ok := r.GrantChain[i].(model.PolicyGrant); ok {
+				return p.ID
+			}
+		}
+	}
+	return ""
+}
+
+func lessKey(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func (c *Cache) SaveResources(resources []model.Resource) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, r := range resources {
+		c.resources[r.ID] = r
+	}
+	return nil
+}
+
+func (c *Cache) FindResources(filter *model.Filter) ([]model.Resource, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	resources := make([]model.Resource, 0)
+	for _, r := range c.resources {
+		if matchesAny(r.ID, filter.Resources, filter.ExactMatch) {
+			resources = append(resources, r)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ID < resources[j].ID
+	})
+	return resources, nil
+}
+
+func (c *Cache) SaveRoles(roles []model.Role) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, r := range roles {
+		if r.Trust != nil {
+			r.Trust = append([]model.TrustStatement{}, r.Trust...)
+		}
+		if r.Policies != nil {
+			r.Policies = append([]string{}, r.Policies...)
+		}
+		c.roles[r.ARN] = r
+		c.rolesSaved[r.ARN] = now
+	}
+	return nil
+}
+
+// PruneRoles deletes the roles matching any of the patterns that weren't
+// saved since before.
+func (c *Cache) PruneRoles(roles []string, before time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for arn := range c.roles {
+		if c.rolesSaved[arn].Before(before) && matchesAny(arn, roles, false) {
+			delete(c.roles, arn)
+			delete(c.rolesSaved, arn)
+		}
+	}
+	return nil
+}
+
+func (c *Cache) FindRoles() ([]model.Role, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	roles := make([]model.Role, 0, len(c.roles))
+	for _, r := range c.roles {
+		roles = append(roles, r)
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].ARN < roles[j].ARN
+	})
+	return roles, nil
+}
+
+func (c *Cache) SavePolicies(policies []model.Policy) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range policies {
+		c.policies[p.ARN] = p
+	}
+	return nil
+}
+
+func (c *Cache) FindPolicies() ([]model.Policy, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	policies := make([]model.Policy, 0, len(c.policies))
+	for _, p := range c.policies {
+		policies = append(policies, p)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ARN < policies[j].ARN
+	})
+	return policies, nil
+}
+
+// SaveUsage keeps the latest time of each identity, action and resource.
+func (c *Cache) SaveUsage(usage []model.Usage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, u := range usage {
+		k := usageKey{u.Identity, u.Action, u.Resource}
+		if prev, ok := c.usage[k]; ok && !u.LastUsed.After(prev.LastUsed) {
+			continue
+		}
+		c.usage[k] = u
+	}
+	return nil
+}
+
+func (c *Cache) FindUsage(since time.Time) ([]model.Usage, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	usage := make([]model.Usage, 0)
+	for _, u := range c.usage {
+		if !u.LastUsed.Before(since) {
+			usage = append(usage, u)
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		ui, uj := usage[i], usage[j]
+		if ui.Identity != uj.Identity {
+			return ui.Identity < uj.Identity
+		}
+		if ui.Action != uj.Action {
+			return ui.Action < uj.Action
+		}
+		return ui.Resource < uj.Resource
+	})
+	return usage, nil
+}
+
+// candidates narrows the rules to check down to the index buckets a filter
+// can match, in insertion order.
+func (c *Cache) candidates(filter *model.Filter) []int {
+	var set map[int]bool
+	switch {
+	case len(filter.Principals) > 0:
+		set = c.lookup(filter.Principals, filter.ExactMatch, principalKey, c.byPrincipal, c.wildcardPrincipal)
+	case len(filter.Permissions) > 0:
+		set = c.lookup(filter.Permissions, filter.ExactMatch, serviceKey, c.byService, c.wildcardServices)
+	}
+
+	if set == nil {
+		all := make([]int, len(c.rules))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	positions := make([]int, 0, len(set))
+	for i := range set {
+		positions = append(positions, i)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// lookup returns the rules that can match any of the values, or nil when a
+// value has no usable key and every rule has to be checked.
+func (c *Cache) lookup(values []string, exact bool, key func(string) (string, bool), index map[string]map[int]bool, wildcards map[int]bool) map[int]bool {
+	set := make(map[int]bool)
+	for _, v := range values {
+		k, ok := key(v)
+		if !ok {
+			if !exact {
+				return nil
+			}
+			// a value without key can only be equal to rules without key
+			for i := range wildcards {
+				set[i] = true
+			}
+			continue
+		}
+		for i := range index[k] {
+			set[i] = true
+		}
+		if !exact {
+			for i := range wildcards {
+				set[i] = true
+			}
+		}
+	}
+	return set
+}
+
+func (c *Cache) index(i int) {
+	r := c.rules[i]
+	addToIndex(i, r.Permission.ID, serviceKey, c.byService, c.wildcardServices)
+	addToIndex(i, r.Principal.ID, principalKey, c.byPrincipal, c.wildcardPrincipal)
+}
+
+func (c *Cache) unindex(i int) {
+	r := c.rules[i]
+	removeFromIndex(i, r.Permission.ID, serviceKey, c.byService, c.wildcardServices)
+	removeFromIndex(i, r.Principal.ID, principalKey, c.byPrincipal, c.wildcardPrincipal)
+}
+
+func addToIndex(i int, value string, key func(string) (string, bool), index map[string]map[int]bool, wildcards map[int]bool) {
+	k, ok := key(value)
+	if !ok {
+		wildcards[i] = true
+		return
+	}
+	if index[k] == nil {
+		index[k] = make(map[int]bool)
+	}
+	index[k][i] = true
+}
+
+func removeFromIndex(i int, value string, key func(string) (string, bool), index map[string]map[int]bool, wildcards map[int]bool) {
+	k, ok := key(value)
+	if !ok {
+		delete(wildcards, i)
+		return
+	}
+	delete(index[k], i)
+}
+
+// serviceKey is the service prefix of a permission, e.g. s3: for s3:Get*, and
+// principalKey the principal up to its closing bracket. Keys end with a
+// delimiter so values with different keys can never match each other; values
+// without a key are matched against every filter.
+func serviceKey(permission string) (string, bool) {
+	return keyUntil(permission, ':')
+}
+
+func principalKey(principal string) (string, bool) {
+	return keyUntil(principal, ']')
+}
+
+func keyUntil(value string, delim byte) (string, bool) {
+	i := strings.IndexAny(value, string(delim)+"*")
+	if i < 0 || value[i] == '*' {
+		return "", false
+	}
+	return value[:i+1], true
+}
+
+// matchesVia tells whether the grant chain goes through the policies and roles
+// of via, and its last policy is of one of its types.
+func matchesVia(chain []model.GrantIface, via *model.Via, exact bool) bool {
+	var policies, roles []string
+	for _, g := range chain {
+		switch v := g.(type) {
+		case model.PolicyGrant:
+			policies = append(policies, v.ID)
+		case model.RoleGrant:
+			roles = append(roles, v.ID)
+		}
+	}
+
+	if !anyMatches(policies, via.Policies, exact) || !anyMatches(roles, via.Roles, exact) {
+		return false
+	}
+	if len(via.Types) == 0 {
+		return true
+	}
+	if len(policies) == 0 {
+		return false
+	}
+	return matchesAny(model.PolicyType(policies[len(policies)-1]), via.Types, true)
+}
+
+func anyMatches(values []string, filters []string, exact bool) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if matchesAny(v, filters, exact) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(value string, filters []string, exact bool) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if exact && value == f || !exact && wildcard.Match(value, f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,414 @@
+package memory
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/cache/cachetest"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSaveACL(t *testing.T) {
+	c := New()
+
+	rule := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid")
+	rule.StatementIndex = 2
+	rule.Effect = "Deny"
+	require.Nil(t, c.SaveACL([]model.AccessControlRule{rule, rule}))
+
+	// a new version of the policy can change the conditions of the statement
+	updated := rule
+	updated.Conditions = []model.Condition{{Operator: "Bool", Key: "aws:SecureTransport", Values: []string{"false"}}}
+	require.Nil(t, c.SaveACL([]model.AccessControlRule{updated}))
+
+	got, err := c.Find(&model.Filter{IncludeDeny: true})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{updated}, got)
+
+	// Deny rules don't grant anything
+	got, err = c.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Empty(t, got)
+}
+
+func TestCacheSaveACLSameAccessTwoPolicies(t *testing.T) {
+	c := New()
+
+	rule := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "s3:GetObject", "*")
+	other := rule
+	other.GrantChain = []model.GrantIface{
+		rule.GrantChain[0],
+		model.NewPolicyGrant("arn:aws:iam::111122223333:policy/OtherPolicy"),
+	}
+	require.Nil(t, c.SaveACL([]model.AccessControlRule{rule}))
+	require.Nil(t, c.SaveACL([]model.AccessControlRule{other}))
+
+	got, err := c.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{rule, other}, got)
+}
+
+func TestCacheSaveACLAllowAndDeny(t *testing.T) {
+	c := New()
+
+	allow := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "s3:DeleteObject", "*")
+	allow.Effect = "Allow"
+	deny := allow
+	deny.StatementIndex = 1
+	deny.Effect = "Deny"
+	require.Nil(t, c.SaveACL([]model.AccessControlRule{allow, deny}))
+
+	got, err := c.Find(&model.Filter{IncludeDeny: true})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{allow, deny}, got)
+}
+
+func TestCachePruneACL(t *testing.T) {
+	c := New()
+
+	stale := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "s3:GetObject", "*")
+	kept := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "s3:PutObject", "*")
+	other := newRule("AWS[arn:aws:iam::444455556666:role/TestRole]", "s3:GetObject", "*")
+	other.GrantChain = []model.GrantIface{model.NewRoleGrant("arn:aws:iam::444455556666:role/SomeRole")}
+	require.Nil(t, c.SaveACL([]model.AccessControlRule{stale, other}))
+
+	before := time.Now()
+	require.Nil(t, c.SaveACL([]model.AccessControlRule{kept}))
+	require.Nil(t, c.PruneACL(&model.Via{Roles: []string{"arn:aws:iam::111122223333:role/*"}}, before))
+
+	got, err := c.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{other, kept}, got)
+
+	got, err = c.Find(&model.Filter{Permissions: []string{"s3:GetObject"}})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{other}, got)
+}
+
+func TestCacheFind(t *testing.T) {
+	admin := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "*", "*")
+	create := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid")
+	service := newRule("Service[ec2.amazonaws.com]", "s3:GetObject", "arn:aws:s3:::bucket/*")
+
+	tests := []struct {
+		name   string
+		filter model.Filter
+		want   []model.AccessControlRule
+	}{
+		{
+			"exact match",
+			model.Filter{
+				Permissions: []string{"ec2:CreateInstance"},
+				Resources:   []string{"arn:aws:ec2:*:*:instance/someinstanceid"},
+				ExactMatch:  true,
+			},
+			[]model.AccessControlRule{create},
+		},
+		{
+			"exact match */*",
+			model.Filter{
+				Permissions: []string{"*"},
+				Resources:   []string{"*"},
+				ExactMatch:  true,
+			},
+			[]model.AccessControlRule{admin},
+		},
+		{
+			"wildcard match */*",
+			model.Filter{
+				Permissions: []string{"*"},
+				Resources:   []string{"*"},
+			},
+			[]model.AccessControlRule{admin, create, service},
+		},
+		{
+			"wildcard match action*/*",
+			model.Filter{
+				Permissions: []string{"ec2:Create*"},
+				Resources:   []string{"*"},
+			},
+			[]model.AccessControlRule{admin, create},
+		},
+		{
+			"exact match action*/*",
+			model.Filter{
+				Permissions: []string{"ec2:Create*"},
+				Resources:   []string{"*"},
+				ExactMatch:  true,
+			},
+			[]model.AccessControlRule{},
+		},
+		{
+			"principal match",
+			model.Filter{
+				Principals: []string{"AWS[arn:aws:iam::*:role/TestRole]"},
+			},
+			[]model.AccessControlRule{admin, create},
+		},
+		{
+			"exact principal",
+			model.Filter{
+				Principals: []string{"Service[ec2.amazonaws.com]"},
+				ExactMatch: true,
+			},
+			[]model.AccessControlRule{service},
+		},
+		{
+			"principal mismatch",
+			model.Filter{
+				Principals:  []string{"AWS[arn:aws:iam::*:role/OtherRole]"},
+				Permissions: []string{"*"},
+			},
+			[]model.AccessControlRule{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			require.Nil(t, c.SaveACL([]model.AccessControlRule{admin, create, service}))
+
+			got, err := c.Find(&tt.filter)
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestCacheFindIndexes checks the indexed lookups return the same rules as a
+// scan of every rule.
+func TestCacheFindIndexes(t *testing.T) {
+	principals := []string{"AWS[arn:aws:iam::111122223333:role/A]", "AWS[arn:aws:iam::*:role/A]", "AWS[*]", "Service[ec2.amazonaws.com]", "AWS[arn:aws:iam::111122223333:role/A"}
+	permissions := []string{"*", "s3:*", "s3:GetObject", "s3:Get*", "ec2:RunInstances", "ec2:*", "s*:Get*", "s3", "iam:PassRole"}
+	resources := []string{"*", "arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/key", "arn:aws:ec2:*:*:instance/*"}
+
+	r := rand.New(rand.NewSource(1))
+	pick := func(values []string) []string {
+		var picked []string
+		for _, v := range values {
+			if r.Intn(4) == 0 {
+				picked = append(picked, v)
+			}
+		}
+		return picked
+	}
+
+	c := New()
+	var rules []model.AccessControlRule
+	for _, p := range principals {
+		for _, a := range permissions {
+			for _, res := range resources {
+				rules = append(rules, newRule(p, a, res))
+			}
+		}
+	}
+	require.Nil(t, c.SaveACL(rules))
+	all, err := c.Find(&model.Filter{})
+	require.Nil(t, err)
+
+	for n := 0; n < 500; n++ {
+		filter := model.Filter{
+			Principals:  pick(principals),
+			Permissions: pick(permissions),
+			Resources:   pick(resources),
+			ExactMatch:  r.Intn(2) == 0,
+		}
+
+		want := []model.AccessControlRule{}
+		for _, rule := range all {
+			if scanMatches(rule.Principal.ID, filter.Principals, filter.ExactMatch) &&
+				scanMatches(rule.Permission.ID, filter.Permissions, filter.ExactMatch) &&
+				scanMatches(rule.Resource.ID, filter.Resources, filter.ExactMatch) {
+				want = append(want, rule)
+			}
+		}
+
+		got, err := c.Find(&filter)
+		require.Nil(t, err)
+		require.Equal(t, want, got, "filter %+v", filter)
+	}
+}
+
+func TestCacheFindVia(t *testing.T) {
+	managed := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "s3:GetObject", "*")
+	admin := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "*", "*")
+	admin.GrantChain = []model.GrantIface{
+		model.NewRoleGrant("arn:aws:iam::111122223333:role/AdminRole"),
+		model.NewPolicyGrant("arn:aws:iam::aws:policy/AdministratorAccess"),
+	}
+	inline := newRule("AWS[arn:aws:iam::111122223333:role/TestRole]", "sqs:SendMessage", "*")
+	inline.GrantChain = []model.GrantIface{
+		model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+		model.NewPolicyGrant("arn:aws:iam::111122223333:role/SomeRole"),
+	}
+
+	tests := []struct {
+		name string
+		via  model.Via
+		want []model.AccessControlRule
+	}{
+		{"policy", model.Via{Policies: []string{"*/AdministratorAccess"}}, []model.AccessControlRule{admin}},
+		{"role", model.Via{Roles: []string{"arn:aws:iam::111122223333:role/SomeRole"}}, []model.AccessControlRule{managed, inline}},
+		{"type", model.Via{Types: []string{model.InlinePolicy}}, []model.AccessControlRule{inline}},
+		{"role and type", model.Via{Roles: []string{"*SomeRole"}, Types: []string{model.ManagedPolicy}}, []model.AccessControlRule{managed}},
+		{"scp", model.Via{Types: []string{model.SCP}}, []model.AccessControlRule{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			require.Nil(t, c.SaveACL([]model.AccessControlRule{managed, admin, inline}))
+
+			got, err := c.Find(&model.Filter{Via: tt.via})
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCacheFindPages(t *testing.T) {
+	a := newRule("AWS[arn:aws:iam::111122223333:role/A]", "s3:PutObject", "*")
+	b := newRule("AWS[arn:aws:iam::111122223333:role/B]", "s3:GetObject", "arn:aws:s3:::bucket/*")
+	c := newRule("AWS[arn:aws:iam::111122223333:role/C]", "ec2:RunInstances", "*")
+
+	tests := []struct {
+		name string
+		page model.Page
+		want []model.AccessControlRule
+	}{
+		{"saved order", model.Page{}, []model.AccessControlRule{b, c, a}},
+		{"by principal", model.Page{Sort: model.SortByPrincipal}, []model.AccessControlRule{a, b, c}},
+		{"by permission", model.Page{Sort: model.SortByPermission}, []model.AccessControlRule{c, b, a}},
+		{"by resource", model.Page{Sort: model.SortByResource, Limit: 2}, []model.AccessControlRule{c, a}},
+		{"after", model.Page{Sort: model.SortByPrincipal, After: model.SortKey(model.SortByPrincipal, &a)}, []model.AccessControlRule{b, c}},
+		{"offset", model.Page{Offset: 1, Limit: 1}, []model.AccessControlRule{c}},
+		{"past the end", model.Page{Offset: 5}, []model.AccessControlRule{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := New()
+			require.Nil(t, cache.SaveACL([]model.AccessControlRule{b, c, a}))
+
+			got, err := cache.Find(&model.Filter{Page: tt.page})
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := New().Find(&model.Filter{Page: model.Page{Sort: "effect"}})
+	require.EqualError(t, err, `unknown sort "effect"`)
+}
+
+func TestCacheAggregate(t *testing.T) {
+	cachetest.TestAggregate(t, func(t *testing.T) ports.CacheIface {
+		return New()
+	})
+}
+
+func TestCacheResources(t *testing.T) {
+	c := New()
+
+	require.Nil(t, c.SaveResources([]model.Resource{
+		{ID: "arn:aws:s3:::b", Type: "s3"},
+		{ID: "arn:aws:s3:::a", Type: "s3"},
+		{ID: "arn:aws:sqs:us-east-1:111122223333:queue", Type: "sqs"},
+	}))
+	require.Nil(t, c.SaveResources([]model.Resource{{ID: "arn:aws:s3:::a", Type: "AWS::S3::Bucket"}}))
+
+	got, err := c.FindResources(&model.Filter{Resources: []string{"arn:aws:s3:::*"}})
+	require.Nil(t, err)
+	require.Equal(t, []model.Resource{
+		{ID: "arn:aws:s3:::a", Type: "AWS::S3::Bucket"},
+		{ID: "arn:aws:s3:::b", Type: "s3"},
+	}, got)
+}
+
+func TestCacheRoles(t *testing.T) {
+	c := New()
+
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	roles := []model.Role{
+		{ARN: "arn:aws:iam::111122223333:role/B", Name: "B", CreateDate: created},
+		{ARN: "arn:aws:iam::111122223333:role/A", Name: "A", CreateDate: created, Trust: []model.TrustStatement{
+			{Principal: model.Principal{ID: "Service[ec2.amazonaws.com]"}},
+		}},
+	}
+	require.Nil(t, c.SaveRoles(roles))
+
+	got, err := c.FindRoles()
+	require.Nil(t, err)
+	require.Equal(t, []model.Role{roles[1], roles[0]}, got)
+}
+
+func TestCachePolicies(t *testing.T) {
+	c := New()
+
+	policies := []model.Policy{
+		{ARN: "arn:aws:iam::111122223333:policy/B", Name: "B", Version: "v1", Document: `{"Statement":[]}`},
+		{ARN: "arn:aws:iam::111122223333:policy/A", Name: "A", Version: "v1", Document: `{"Statement":[]}`},
+	}
+	require.Nil(t, c.SavePolicies(policies))
+
+	policies[1].Version = "v2"
+	require.Nil(t, c.SavePolicies(policies[1:]))
+
+	got, err := c.FindPolicies()
+	require.Nil(t, err)
+	require.Equal(t, []model.Policy{policies[1], policies[0]}, got)
+}
+
+func scanMatches(value string, filters []string, exact bool) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if exact && value == f || !exact && wildcard.Match(value, f) {
+			return true
+		}
+	}
+	return false
+}
+
+func newRule(principal string, permission string, resource string) model.AccessControlRule {
+	return model.AccessControlRule{
+		Principal:  model.Principal{ID: principal},
+		Permission: model.Permission{ID: permission},
+		Resource:   model.Resource{ID: resource},
+		GrantChain: []model.GrantIface{
+			model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+			model.NewPolicyGrant("arn:aws:iam::111122223333:policy/SomePolicy"),
+		},
+	}
+}
+
+func TestCacheUsage(t *testing.T) {
+	c := New()
+
+	day := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	role := "arn:aws:iam::111122223333:role/Dev"
+	require.Nil(t, c.SaveUsage([]model.Usage{
+		{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/a", LastUsed: day},
+		{Identity: role, Action: "s3:PutObject", LastUsed: day.Add(-48 * time.Hour)},
+	}))
+	// older logs loaded later don't move LastUsed back
+	require.Nil(t, c.SaveUsage([]model.Usage{
+		{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/a", LastUsed: day.Add(-time.Hour)},
+		{Identity: role, Action: "s3:PutObject", LastUsed: day.Add(-24 * time.Hour)},
+	}))
+
+	got, err := c.FindUsage(day.Add(-24 * time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, []model.Usage{
+		{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/a", LastUsed: day},
+		{Identity: role, Action: "s3:PutObject", LastUsed: day.Add(-24 * time.Hour)},
+	}, got)
+
+	got, err = c.FindUsage(day.Add(time.Second))
+	require.Nil(t, err)
+	require.Empty(t, got)
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"gorm.io/gorm"
+)
+
+type Policy struct {
+	gorm.Model
+	ARN string `gorm:"uniqueIndex"`
+	// Type is the grant type derived from the ARN
+	Type     string `gorm:"index"`
+	Name     string
+	Version  string
+	Document string
+}
+
+func NewPolicy(dp *model.Policy) *Policy {
+	return &Policy{
+		ARN:      dp.ARN,
+		Type:     model.PolicyType(dp.ARN),
+		Name:     dp.Name,
+		Version:  dp.Version,
+		Document: dp.Document,
+	}
+}
+
+func (p *Policy) Map() model.Policy {
+	return model.Policy{
+		ARN:      p.ARN,
+		Name:     p.Name,
+		Version:  p.Version,
+		Document: p.Document,
+	}
+}
+
+// backfillPolicyTypes derives the type of policies cached before it existed.
+func backfillPolicyTypes(db *gorm.DB) error {
+	var policies []Policy
+	return db.
+		Where("type IS NULL").
+		FindInBatches(&policies, saveBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, p := range policies {
+				if err := db.Model(&Policy{}).Where("id = ?", p.ID).Update("type", model.PolicyType(p.ARN)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
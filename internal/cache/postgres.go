@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// matchFunction is wildcard.Match in PL/pgSQL, so filters are evaluated by the
+// database the same way the sqlite hook does.
+const matchFunction = `
+CREATE OR REPLACE FUNCTION match(s1 text, s2 text) RETURNS boolean
+LANGUAGE plpgsql IMMUTABLE STRICT AS $$
+DECLARE
+	i1 int := 1;
+	i2 int := 1;
+	l1 int := length(s1);
+	l2 int := length(s2);
+	delim text;
+	adv int;
+	j int;
+BEGIN
+	WHILE i1 <= l1 AND i2 <= l2 LOOP
+		IF substr(s1, i1, 1) = '*' THEN
+			i1 := i1 + 1;
+			IF substr(s2, i2, 1) = '*' THEN
+				i2 := i2 + 1;
+				CONTINUE;
+			END IF;
+
+			delim := NULL;
+			FOR j IN i1..l1 LOOP
+				IF substr(s1, j, 1) <> '*' THEN
+					delim := substr(s1, j, 1);
+					i1 := j + 1;
+					EXIT;
+				END IF;
+			END LOOP;
+			IF delim IS NULL THEN
+				RETURN true;
+			END IF;
+
+			adv := 0;
+			FOR j IN i2..l2 LOOP
+				IF substr(s2, j, 1) = delim THEN
+					adv := j - i2 + 1;
+					EXIT;
+				END IF;
+				IF substr(s2, j, 1) = '*' THEN
+					adv := j - i2 + 2;
+					EXIT;
+				END IF;
+			END LOOP;
+			IF adv = 0 THEN
+				RETURN false;
+			END IF;
+			i2 := i2 + adv;
+
+			IF i1 > l1 AND i2 <= l2 THEN
+				RETURN false;
+			END IF;
+		ELSIF substr(s2, i2, 1) = '*' THEN
+			i2 := i2 + 1;
+
+			delim := NULL;
+			FOR j IN i2..l2 LOOP
+				IF substr(s2, j, 1) <> '*' THEN
+					delim := substr(s2, j, 1);
+					i2 := j + 1;
+					EXIT;
+				END IF;
+			END LOOP;
+			IF delim IS NULL THEN
+				RETURN true;
+			END IF;
+
+			adv := 0;
+			FOR j IN i1..l1 LOOP
+				IF substr(s1, j, 1) = delim THEN
+					adv := j - i1 + 1;
+					EXIT;
+				END IF;
+				IF substr(s1, j, 1) = '*' THEN
+					adv := j - i1 + 2;
+					EXIT;
+				END IF;
+			END LOOP;
+			IF adv = 0 THEN
+				RETURN false;
+			END IF;
+			i1 := i1 + adv;
+
+			IF i2 > l2 AND i1 <= l1 THEN
+				RETURN false;
+			END IF;
+		ELSE
+			IF substr(s1, i1, 1) <> substr(s2, i2, 1) THEN
+				RETURN false;
+			END IF;
+			i1 := i1 + 1;
+			i2 := i2 + 1;
+		END IF;
+	END LOOP;
+	RETURN true;
+END
+$$`
+
+// PostgresCache shares a single cache between every user and server pointing
+// at the same database.
+type PostgresCache struct {
+	gormCache
+}
+
+// NewPostgres connects to the database at dsn, either a postgres:// URL or a
+// key=value connection string, and creates the schema if needed. The rules of
+// a cache written by an incompatible version are only dropped with
+// dropIncompatible.
+func NewPostgres(dsn string, dropIncompatible bool) (*PostgresCache, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Exec(matchFunction).Error; err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db, dropIncompatible); err != nil {
+		return nil, err
+	}
+
+	if err := collatePrefixes(db); err != nil {
+		return nil, err
+	}
+
+	return &PostgresCache{gormCache{db: db}}, nil
+}
+
+// collatePrefixes makes the range scans on resource_prefix compare bytes like
+// wildcard.Match, which locale aware collations don't do.
+func collatePrefixes(db *gorm.DB) error {
+	var collation *string
+	err := db.Raw(`SELECT collation_name FROM information_schema.columns
+		WHERE table_name = 'resources' AND column_name = 'resource_prefix'`).
+		Scan(&collation).Error
+	if err != nil || (collation != nil && *collation == "C") {
+		return err
+	}
+	return db.Exec(`ALTER TABLE resources ALTER COLUMN resource_prefix TYPE text COLLATE "C"`).Error
+}
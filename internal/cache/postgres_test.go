@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/cache/cachetest"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+	"github.com/stretchr/testify/require"
+)
+
+// The Postgres tests run against the database in IAMSNITCH_TEST_POSTGRES_DSN,
+// e.g. one started with `docker run -e POSTGRES_PASSWORD=snitch -p 5432:5432 postgres`.
+func testPostgres(t *testing.T) *PostgresCache {
+	dsn := os.Getenv("IAMSNITCH_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("IAMSNITCH_TEST_POSTGRES_DSN not set")
+	}
+
+	c, err := NewPostgres(dsn, false)
+	require.Nil(t, err)
+	require.Nil(t, c.db.Exec("TRUNCATE access_control_rules, grants, principals, resources, roles, policies, statements").Error)
+	return c
+}
+
+func TestPostgresMatch(t *testing.T) {
+	c := testPostgres(t)
+
+	patterns := []string{
+		"*",
+		"s3:*",
+		"s3:Get*",
+		"s3:GetObject",
+		"s3:PutObject",
+		"*Object",
+		"arn:aws:s3:::bucket/*",
+		"arn:aws:s3:::*/key",
+		"arn:aws:s3:::bucket/key",
+		"arn:aws:s3:::other",
+		"arn:*:s3:*:*:*",
+		"",
+	}
+	for _, s1 := range patterns {
+		for _, s2 := range patterns {
+			var got bool
+			require.Nil(t, c.db.Raw("SELECT match(?, ?)", s1, s2).Scan(&got).Error)
+			require.Equal(t, wildcard.Match(s1, s2), got, "match(%q, %q)", s1, s2)
+		}
+	}
+}
+
+func TestPostgresCacheFind(t *testing.T) {
+	c := testPostgres(t)
+
+	rules := []model.AccessControlRule{
+		newRule("s3:GetObject", "arn:aws:s3:::bucket/*"),
+		newRule("ec2:RunInstances", "*"),
+	}
+	require.Nil(t, c.SaveACL(rules))
+
+	got, err := c.Find(&model.Filter{
+		Permissions: []string{"s3:Get*"},
+		Resources:   []string{"arn:aws:s3:::bucket/key"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, rules[:1], got)
+
+	got, err = c.Find(&model.Filter{
+		Permissions: []string{"s3:Get*"},
+		Resources:   []string{"*"},
+		ExactMatch:  true,
+	})
+	require.Nil(t, err)
+	require.Empty(t, got)
+}
+
+func TestPostgresCacheAggregate(t *testing.T) {
+	cachetest.TestAggregate(t, func(t *testing.T) ports.CacheIface {
+		return testPostgres(t)
+	})
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// wildcardColumn marks a precomputed column that couldn't be derived because
+// of a wildcard, so the rule remains a candidate for any filter.
+const wildcardColumn = "*"
+
+// maxRune sorts after every other character, closing the range of values that
+// start with a prefix.
+const maxRune = "\U0010FFFF"
+
+// literalPrefix is the part of a pattern before its first wildcard. Two
+// patterns can only match each other when one literal prefix starts with the
+// other.
+func literalPrefix(pattern string) string {
+	if i := strings.IndexByte(pattern, '*'); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// arnParts returns the partition and account of a resource ARN, as long as
+// they are spelled out before any wildcard.
+func arnParts(resource string) (partition string, account string) {
+	partition, account = wildcardColumn, wildcardColumn
+
+	// arn:partition:service:region:account:resource
+	parts := strings.SplitN(literalPrefix(resource), ":", 6)
+	if parts[0] != "arn" {
+		return
+	}
+	if len(parts) > 2 && !strings.Contains(parts[1], "?") {
+		partition = parts[1]
+	}
+	if len(parts) > 5 && !strings.Contains(parts[4], "?") {
+		account = parts[4]
+	}
+	return
+}
+
+func permissionCandidates(permission string) clause.Expression {
+	service := model.ServiceOf(permission)
+	if service == wildcardColumn {
+		return nil
+	}
+	return clause.Expr{
+		SQL:  "service IN ?",
+		Vars: []interface{}{[]string{service, wildcardColumn}},
+	}
+}
+
+// resourceCandidates selects the resources whose prefix is a prefix of the
+// one of the filter, through an IN lookup, or starts with it, through a range
+// scan. When the filter spells out its partition or account, resources of
+// another one are left out as well, which the prefix can't do past a wildcard
+// region.
+func resourceCandidates(resource string) clause.Expression {
+	var exprs []clause.Expression
+	if prefix := literalPrefix(resource); prefix != "" {
+		prefixes := make([]string, 0, len(prefix)+1)
+		for i := range prefix {
+			prefixes = append(prefixes, prefix[:i])
+		}
+		prefixes = append(prefixes, prefix)
+
+		exprs = append(exprs, clause.Expr{
+			SQL:  "(resource_prefix IN ? OR (resource_prefix >= ? AND resource_prefix < ?))",
+			Vars: []interface{}{prefixes, prefix, prefix + maxRune},
+		})
+	}
+
+	partition, account := arnParts(resource)
+	if partition != wildcardColumn {
+		exprs = append(exprs, clause.Expr{
+			SQL:  "partition IN ?",
+			Vars: []interface{}{[]string{partition, wildcardColumn}},
+		})
+	}
+	if account != wildcardColumn {
+		exprs = append(exprs, clause.Expr{
+			SQL:  "account IN ?",
+			Vars: []interface{}{[]string{account, wildcardColumn}},
+		})
+	}
+
+	if len(exprs) == 0 {
+		return nil
+	}
+	return clause.And(exprs...)
+}
+
+// backfillPrefixes computes the precomputed columns of resources cached before
+// they existed.
+func backfillPrefixes(db *gorm.DB) error {
+	var resources []Resource
+	return db.
+		Where("resource_prefix IS NULL").
+		FindInBatches(&resources, saveBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, r := range resources {
+				partition, account := arnParts(r.ARN)
+				err := db.Model(&Resource{}).Where("id = ?", r.ID).Updates(map[string]interface{}{
+					"resource_prefix": literalPrefix(r.ARN),
+					"partition":       partition,
+					"account":         account,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
@@ -0,0 +1,10 @@
+package cache
+
+import "gorm.io/gorm"
+
+// Principal is stored by the ID of model.Principal, such as
+// AWS[arn:aws:iam::111122223333:root].
+type Principal struct {
+	gorm.Model
+	Name string `gorm:"uniqueIndex"`
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"gorm.io/gorm"
+)
+
+// Resource is either an inventoried resource or a pattern granted by a rule,
+// which has no type.
+type Resource struct {
+	gorm.Model
+	ARN  string `gorm:"uniqueIndex"`
+	Type string
+	// Precomputed from ARN so wildcard queries can be narrowed down with
+	// index scans before match() is evaluated
+	ResourcePrefix string `gorm:"index"`
+	Partition      string `gorm:"index"`
+	Account        string `gorm:"index"`
+}
+
+func NewResource(dr *model.Resource) *Resource {
+	partition, account := arnParts(dr.ID)
+	return &Resource{
+		ARN:            dr.ID,
+		Type:           dr.Type,
+		ResourcePrefix: literalPrefix(dr.ID),
+		Partition:      partition,
+		Account:        account,
+	}
+}
+
+func (r *Resource) Map() model.Resource {
+	return model.Resource{
+		ID:   r.ARN,
+		Type: r.Type,
+	}
+}
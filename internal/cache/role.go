@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"gorm.io/gorm"
+)
+
+type Role struct {
+	gorm.Model
+	ARN        string `gorm:"uniqueIndex"`
+	Name       string
+	CreateDate time.Time
+	LastUsed   *time.Time
+	Trust      string
+	// Policies is the JSON list of the ARNs of the attached policies, empty
+	// for roles saved before they were recorded
+	Policies string
+}
+
+func NewRole(dr *model.Role) (*Role, error) {
+	trust, err := json.Marshal(dr.Trust)
+	if err != nil {
+		return nil, err
+	}
+	var policies []byte
+	if dr.Policies != nil {
+		if policies, err = json.Marshal(dr.Policies); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Role{
+		ARN:        dr.ARN,
+		Name:       dr.Name,
+		CreateDate: dr.CreateDate,
+		LastUsed:   dr.LastUsed,
+		Trust:      string(trust),
+		Policies:   string(policies),
+	}, nil
+}
+
+func (r *Role) Map() (model.Role, error) {
+	var trust []model.TrustStatement
+	if err := json.Unmarshal([]byte(r.Trust), &trust); err != nil {
+		return model.Role{}, err
+	}
+	var policies []string
+	if r.Policies != "" {
+		if err := json.Unmarshal([]byte(r.Policies), &policies); err != nil {
+			return model.Role{}, err
+		}
+	}
+
+	return model.Role{
+		ARN:        r.ARN,
+		Name:       r.Name,
+		CreateDate: r.CreateDate,
+		LastUsed:   r.LastUsed,
+		Trust:      trust,
+		Policies:   policies,
+	}, nil
+}
@@ -1,38 +1,91 @@
 package cache
 
 import (
+	"encoding/json"
+
 	"github.com/jeandreh/iam-snitch/internal/domain/model"
 	"gorm.io/gorm"
 )
 
 type AccessControlRule struct {
 	gorm.Model
-	RuleID     string
-	Principal  string
-	Permission string
-	Resource   string
-	GrantChain []Grant
+	RuleID string `gorm:"uniqueIndex"`
+	// RuleIDVersion is the version of model.AccessControlRule.ID that RuleID
+	// was computed with, rules saved by an older one are rehashed
+	RuleIDVersion *int
+	PrincipalID   uint `gorm:"index"`
+	Principal     Principal
+	Permission    string `gorm:"index"`
+	// Service is precomputed from Permission so wildcard queries can be
+	// narrowed down with an index scan before match() is evaluated
+	Service    string `gorm:"index"`
+	ResourceID uint   `gorm:"index"`
+	Resource   Resource
+	// Statement is the one granting the rule in the last policy of the grant
+	// chain
+	StatementID *uint `gorm:"index"`
+	Statement   *Statement
+	GrantChain  []Grant
 }
 
-func NewRule(da *model.AccessControlRule) *AccessControlRule {
-	return &AccessControlRule{
-		RuleID:     da.ID(),
-		Principal:  da.Principal.ID,
-		Permission: da.Permission.ID,
-		Resource:   da.Resource.ID,
-		GrantChain: NewGrantChain(da.GrantChain),
+// NewRule builds the rule with its related rows, which are only identified by
+// their natural keys until they're saved.
+func NewRule(da *model.AccessControlRule) (*AccessControlRule, error) {
+	gc, err := NewGrantChain(da.GrantChain)
+	if err != nil {
+		return nil, err
+	}
+
+	version := ruleIDVersion
+	rule := &AccessControlRule{
+		RuleID:        da.ID(),
+		RuleIDVersion: &version,
+		Principal:     Principal{Name: da.Principal.ID},
+		Permission:    da.Permission.ID,
+		Service:       model.ServiceOf(da.Permission.ID),
+		Resource:      *NewResource(&model.Resource{ID: da.Resource.ID}),
+		GrantChain:    gc,
+	}
+
+	conditions, err := json.Marshal(da.Conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(gc) - 1; i >= 0; i-- {
+		if gc[i].Policy != nil {
+			rule.Statement = &Statement{
+				Policy:         *gc[i].Policy,
+				StatementIndex: da.StatementIndex,
+				Effect:         da.Effect,
+				Conditions:     string(conditions),
+			}
+			break
+		}
 	}
+
+	return rule, nil
 }
 
-func (a *AccessControlRule) Map() model.AccessControlRule {
-	return model.AccessControlRule{
-		Principal: model.Principal{ID: a.Principal},
+func (a *AccessControlRule) Map() (model.AccessControlRule, error) {
+	rule := model.AccessControlRule{
+		Principal: model.Principal{ID: a.Principal.Name},
 		Permission: model.Permission{
 			ID: a.Permission,
 		},
-		Resource:   model.Resource{ID: a.Resource},
+		Resource:   model.Resource{ID: a.Resource.ARN},
 		GrantChain: a.mapGrantChain(),
 	}
+	if a.Statement != nil {
+		rule.StatementIndex = a.Statement.StatementIndex
+		rule.Effect = a.Statement.Effect
+		if a.Statement.Conditions != "" {
+			if err := json.Unmarshal([]byte(a.Statement.Conditions), &rule.Conditions); err != nil {
+				return model.AccessControlRule{}, err
+			}
+		}
+	}
+	return rule, nil
 }
 
 func (a *AccessControlRule) mapGrantChain() []model.GrantIface {
@@ -42,3 +95,55 @@ func (a *AccessControlRule) mapGrantChain() []model.GrantIface {
 	}
 	return mg
 }
+
+// ruleIDVersion is bumped whenever model.AccessControlRule.ID changes. The
+// first version left the permission out, the second the grant chain past its
+// entry point, the statement and the effect.
+const ruleIDVersion = 3
+
+// backfillRuleIDs rehashes the rules saved with an older version of their ID.
+// A rule whose new ID was saved since is a duplicate and is deleted.
+func backfillRuleIDs(db *gorm.DB) error {
+	var rules []AccessControlRule
+	return db.
+		Preload("Principal").
+		Preload("Resource").
+		Preload("GrantChain", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("GrantChain.Role").
+		Preload("GrantChain.Policy").
+		Preload("Statement").
+		Where("rule_id_version IS NULL OR rule_id_version < ?", ruleIDVersion).
+		FindInBatches(&rules, saveBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, r := range rules {
+				mr, err := r.Map()
+				if err != nil {
+					return err
+				}
+				var id string
+				if len(mr.GrantChain) > 0 {
+					id = mr.ID()
+				}
+
+				var duplicates int64
+				if err := db.Model(&AccessControlRule{}).Unscoped().Where("rule_id = ? AND id <> ?", id, r.ID).Count(&duplicates).Error; err != nil {
+					return err
+				}
+				if id == "" || duplicates > 0 {
+					if err := deleteRules(db, []uint{r.ID}); err != nil {
+						return err
+					}
+					continue
+				}
+				err = db.Model(&AccessControlRule{}).Unscoped().Where("id = ?", r.ID).Updates(map[string]interface{}{
+					"rule_id":         id,
+					"rule_id_version": ruleIDVersion,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
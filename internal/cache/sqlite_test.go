@@ -1,10 +1,19 @@
 package cache
 
 import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jeandreh/iam-snitch/internal/cache/cachetest"
 	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/domain/ports"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
 	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -43,10 +52,24 @@ func TestSQLiteCacheSaveACL(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"same access through two policies",
+			args{
+				[]model.AccessControlRule{
+					newRule("ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid"),
+					withPolicy(newRule("ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid"), "arn:aws:iam::111122223333:policy/OtherPolicy"),
+				},
+			},
+			[]model.AccessControlRule{
+				newRule("ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid"),
+				withPolicy(newRule("ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid"), "arn:aws:iam::111122223333:policy/OtherPolicy"),
+			},
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cache, err := new("file::memory:?cache=shared", &gorm.Config{})
+			cache, err := new("file::memory:", &gorm.Config{}, false)
 			require.Nil(t, err)
 
 			require.Equal(t, cache.SaveACL(tt.args.rules), tt.wantErr)
@@ -63,6 +86,37 @@ func TestSQLiteCacheSaveACL(t *testing.T) {
 	}
 }
 
+func TestSQLiteCacheSaveACLBatches(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	rules := manyRules(2*saveBatchSize + 10)
+	require.Nil(t, cache.SaveACL(rules))
+	require.Nil(t, cache.SaveACL(rules))
+
+	saved, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.ElementsMatch(t, rules, saved)
+
+	var grants int64
+	require.Nil(t, cache.db.Model(&Grant{}).Count(&grants).Error)
+	require.Equal(t, int64(2*len(rules)), grants)
+}
+
+func BenchmarkSQLiteCacheSaveACL(b *testing.B) {
+	for _, n := range []int{10000, 1000000} {
+		rules := manyRules(n)
+		b.Run(fmt.Sprintf("%d rules", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				cache, err := Open(filepath.Join(b.TempDir(), "bench.db"), false)
+				require.Nil(b, err)
+
+				require.Nil(b, cache.SaveACL(rules))
+			}
+		})
+	}
+}
+
 func TestSQLiteCacheFind(t *testing.T) {
 	type args struct {
 		rules  []model.AccessControlRule
@@ -148,6 +202,37 @@ func TestSQLiteCacheFind(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"principal match",
+			args{
+				[]model.AccessControlRule{
+					newRule("*", "*"),
+					newRule("ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid"),
+				},
+				model.Filter{
+					Principals: []string{"AWS[arn:aws:iam::*:role/TestRole]"},
+				},
+			},
+			[]model.AccessControlRule{
+				newRule("*", "*"),
+				newRule("ec2:CreateInstance", "arn:aws:ec2:*:*:instance/someinstanceid"),
+			},
+			nil,
+		},
+		{
+			"principal mismatch",
+			args{
+				[]model.AccessControlRule{
+					newRule("*", "*"),
+				},
+				model.Filter{
+					Principals:  []string{"AWS[arn:aws:iam::*:role/OtherRole]"},
+					Permissions: []string{"*"},
+				},
+			},
+			nil,
+			nil,
+		},
 		{
 			"exact match action*/*",
 			args{
@@ -167,7 +252,7 @@ func TestSQLiteCacheFind(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cache, err := new("file::memory:?cache=shared", &gorm.Config{})
+			cache, err := new("file::memory:?cache=shared", &gorm.Config{}, false)
 			require.Nil(t, err)
 
 			require.Equal(t, cache.SaveACL(tt.args.rules), tt.wantErr)
@@ -180,6 +265,541 @@ func TestSQLiteCacheFind(t *testing.T) {
 	}
 }
 
+func TestSQLiteCacheFindPrefixes(t *testing.T) {
+	rules := []model.AccessControlRule{
+		newRule("*", "*"),
+		newRule("s3:*", "arn:aws:s3:::bucket-*"),
+		newRule("s3:GetObject", "arn:aws:s3:::bucket-1/key"),
+		newRule("ec2:*", "arn:aws:ec2:*:*:instance/*"),
+		newRule("ec2:StartInstances", "arn:aws:ec2:eu-west-1:111122223333:instance/i-1"),
+	}
+	tests := []struct {
+		name   string
+		filter model.Filter
+		want   []model.AccessControlRule
+	}{
+		{
+			"rule prefix shorter than filter",
+			model.Filter{
+				Permissions: []string{"s3:PutObject"},
+				Resources:   []string{"arn:aws:s3:::bucket-2/key"},
+			},
+			[]model.AccessControlRule{rules[0], rules[1]},
+		},
+		{
+			"filter prefix shorter than rule",
+			model.Filter{
+				Permissions: []string{"s3:Get*"},
+				Resources:   []string{"arn:aws:s3:::*"},
+			},
+			[]model.AccessControlRule{rules[0], rules[1], rules[2]},
+		},
+		{
+			"service mismatch",
+			model.Filter{
+				Permissions: []string{"iam:PassRole"},
+				Resources:   []string{"*"},
+			},
+			[]model.AccessControlRule{rules[0]},
+		},
+		{
+			"resource mismatch",
+			model.Filter{
+				Resources: []string{"arn:aws:ec2:us-east-1:111122223333:instance/i-2"},
+			},
+			[]model.AccessControlRule{rules[0], rules[3]},
+		},
+		{
+			"account mismatch in any region",
+			model.Filter{
+				Resources: []string{"arn:aws:ec2:*:444455556666:instance/*"},
+			},
+			[]model.AccessControlRule{rules[0], rules[3]},
+		},
+		{
+			"wildcard service",
+			model.Filter{
+				Permissions: []string{"*Instances"},
+			},
+			[]model.AccessControlRule{rules[0], rules[1], rules[3], rules[4]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := new("file::memory:", &gorm.Config{}, false)
+			require.Nil(t, err)
+			require.Nil(t, cache.SaveACL(rules))
+
+			got, err := cache.Find(&tt.filter)
+
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestSQLiteCacheFindVia(t *testing.T) {
+	managed := newRule("s3:GetObject", "*")
+	admin := withPolicy(newRule("*", "*"), "arn:aws:iam::aws:policy/AdministratorAccess")
+	admin.GrantChain[0] = model.NewRoleGrant("arn:aws:iam::111122223333:role/AdminRole")
+	inline := withPolicy(newRule("sqs:SendMessage", "*"), "arn:aws:iam::111122223333:role/SomeRole")
+
+	tests := []struct {
+		name  string
+		via   model.Via
+		exact bool
+		want  []model.AccessControlRule
+	}{
+		{"policy", model.Via{Policies: []string{"*/AdministratorAccess"}}, false, []model.AccessControlRule{admin}},
+		{"exact policy", model.Via{Policies: []string{"*/AdministratorAccess"}}, true, nil},
+		{"role", model.Via{Roles: []string{"arn:aws:iam::111122223333:role/SomeRole"}}, false, []model.AccessControlRule{managed, inline}},
+		{"type", model.Via{Types: []string{model.InlinePolicy}}, false, []model.AccessControlRule{inline}},
+		{"role and type", model.Via{Roles: []string{"*SomeRole"}, Types: []string{model.ManagedPolicy}}, false, []model.AccessControlRule{managed}},
+		{"scp", model.Via{Types: []string{model.SCP}}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := new("file::memory:", &gorm.Config{}, false)
+			require.Nil(t, err)
+			require.Nil(t, cache.SaveACL([]model.AccessControlRule{managed, admin, inline}))
+
+			got, err := cache.Find(&model.Filter{Via: tt.via, ExactMatch: tt.exact})
+
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestSQLiteCacheFindMatchesScan(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	pattern := func(prefix string) string {
+		alphabet := []string{"a", "b", ":", "/", "*", "é"}
+		p := prefix
+		for n := rnd.Intn(6); n > 0; n-- {
+			p += alphabet[rnd.Intn(len(alphabet))]
+		}
+		return p
+	}
+
+	rules := make([]model.AccessControlRule, 0, 300)
+	for i := 0; i < cap(rules); i++ {
+		rules = append(rules, newRule(pattern(""), pattern("arn:")))
+	}
+
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+	require.Nil(t, cache.SaveACL(rules))
+
+	saved, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+
+	for i := 0; i < 200; i++ {
+		filter := model.Filter{
+			Permissions: []string{pattern("")},
+			Resources:   []string{pattern("arn:"), pattern("")},
+		}
+
+		var want []model.AccessControlRule
+		for _, r := range saved {
+			if wildcard.Match(filter.Permissions[0], r.Permission.ID) &&
+				(wildcard.Match(filter.Resources[0], r.Resource.ID) || wildcard.Match(filter.Resources[1], r.Resource.ID)) {
+				want = append(want, r)
+			}
+		}
+
+		got, err := cache.Find(&filter)
+		require.Nil(t, err)
+		require.ElementsMatch(t, want, got, "filter %+v", filter)
+	}
+}
+
+func TestSQLiteCacheBackfillPrefixes(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	rule := newRule("ec2:Start*", "arn:aws:ec2:*:111122223333:instance/*")
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{rule}))
+
+	// resources cached by older versions don't have the precomputed columns
+	require.Nil(t, cache.db.Exec("UPDATE resources SET resource_prefix = NULL, partition = NULL, account = NULL").Error)
+	require.Nil(t, migrate(cache.db, false))
+
+	var cached Resource
+	require.Nil(t, cache.db.First(&cached).Error)
+	require.Equal(t, "arn:aws:ec2:", cached.ResourcePrefix)
+	require.Equal(t, "aws", cached.Partition)
+	require.Equal(t, "*", cached.Account)
+
+	found, err := cache.Find(&model.Filter{Resources: []string{"arn:aws:ec2:eu-west-1:111122223333:instance/i-1"}})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{rule}, found)
+}
+
+func TestSQLiteCacheMigrateStringSchema(t *testing.T) {
+	db, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite3_extended", DSN: "file::memory:"}, &gorm.Config{})
+	require.Nil(t, err)
+
+	// the schema before principals, policies and statements had their tables
+	require.Nil(t, db.Exec("CREATE TABLE access_control_rules (id integer PRIMARY KEY, rule_id text, principal text, permission text, resource text, statement integer)").Error)
+	require.Nil(t, db.Exec("CREATE TABLE grants (id integer PRIMARY KEY, access_control_rule_id integer, value text)").Error)
+	require.Nil(t, db.Exec("INSERT INTO access_control_rules (rule_id, principal, permission, resource) VALUES ('id', 'AWS[*]', '*', '*')").Error)
+
+	// the rules are only dropped when asked to
+	require.Equal(t, ErrIncompatibleSchema, migrate(db, false))
+	var rules int64
+	require.Nil(t, db.Table("access_control_rules").Count(&rules).Error)
+	require.Equal(t, int64(1), rules)
+
+	require.Nil(t, migrate(db, true))
+
+	cache := &SQLiteCache{gormCache{db: db}}
+	rule := newRule("s3:GetObject", "*")
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{rule}))
+
+	found, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{rule}, found)
+}
+
+func TestSQLiteCacheMigrateRuleIDs(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	rehashed := newRule("s3:GetObject", "*")
+	duplicate := newRule("s3:PutObject", "*")
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{rehashed, duplicate}))
+
+	// IDs of the first version left the permission out, so a refresh saved the
+	// rule again next to the one cached by an older version
+	require.Nil(t, cache.db.Exec("UPDATE access_control_rules SET rule_id = 'old-' || id, rule_id_version = NULL").Error)
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{duplicate}))
+	require.Nil(t, migrate(cache.db, false))
+
+	var rules []AccessControlRule
+	require.Nil(t, cache.db.Unscoped().Order("id").Find(&rules).Error)
+	require.Len(t, rules, 2)
+	require.Equal(t, rehashed.ID(), rules[0].RuleID)
+	require.Equal(t, duplicate.ID(), rules[1].RuleID)
+
+	var grants int64
+	require.Nil(t, cache.db.Model(&Grant{}).Count(&grants).Error)
+	require.Equal(t, int64(4), grants)
+
+	found, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{rehashed, duplicate}, found)
+}
+
+func TestSQLiteCachePruneACL(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	stale := newRule("s3:GetObject", "*")
+	kept := newRule("s3:PutObject", "*")
+	other := newRule("s3:GetObject", "*")
+	other.GrantChain = []model.GrantIface{model.NewRoleGrant("arn:aws:iam::444455556666:role/SomeRole")}
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{stale, other}))
+
+	before := time.Now()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{kept}))
+	require.Nil(t, cache.PruneACL(&model.Via{Roles: []string{"arn:aws:iam::111122223333:role/*"}}, before))
+
+	found, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{other, kept}, found)
+
+	var grants int64
+	require.Nil(t, cache.db.Model(&Grant{}).Count(&grants).Error)
+	require.Equal(t, int64(3), grants)
+
+	// a pruned rule is saved again by a later refresh
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{stale}))
+	found, err = cache.Find(&model.Filter{Permissions: []string{"s3:GetObject"}})
+	require.Nil(t, err)
+	require.ElementsMatch(t, []model.AccessControlRule{other, stale}, found)
+}
+
+func TestSQLiteCachePruneRoles(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	// SomeRole is referenced by the grant chain of a rule
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{newRule("s3:GetObject", "*")}))
+	referenced := model.Role{ARN: "arn:aws:iam::111122223333:role/SomeRole", Name: "SomeRole", Trust: []model.TrustStatement{}}
+	stale := model.Role{ARN: "arn:aws:iam::111122223333:role/Old", Name: "Old", Trust: []model.TrustStatement{}}
+	other := model.Role{ARN: "arn:aws:iam::444455556666:role/Other", Name: "Other", Trust: []model.TrustStatement{}}
+	require.Nil(t, cache.SaveRoles([]model.Role{referenced, stale, other}))
+
+	before := time.Now()
+	kept := model.Role{ARN: "arn:aws:iam::111122223333:role/Kept", Name: "Kept", Trust: []model.TrustStatement{}}
+	require.Nil(t, cache.SaveRoles([]model.Role{kept}))
+	require.Nil(t, cache.PruneRoles([]string{"arn:aws:iam::111122223333:role/*"}, before))
+
+	roles, err := cache.FindRoles()
+	require.Nil(t, err)
+	require.Equal(t, []model.Role{kept, other}, roles)
+
+	// the referenced role is left for the grant chain, not fetched
+	var arns []string
+	require.Nil(t, cache.db.Model(&Role{}).Order("arn").Pluck("arn", &arns).Error)
+	require.Equal(t, []string{kept.ARN, referenced.ARN, other.ARN}, arns)
+	found, err := cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Len(t, found, 1)
+}
+
+func TestSQLiteCacheReferences(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	require.Nil(t, cache.SaveResources([]model.Resource{{ID: "arn:aws:s3:::bucket", Type: "AWS::S3::Bucket"}}))
+	rules := []model.AccessControlRule{
+		newRule("s3:GetObject", "arn:aws:s3:::bucket"),
+		withPolicy(newRule("s3:PutObject", "arn:aws:s3:::bucket"), "arn:aws:iam::111122223333:policy/OtherPolicy"),
+		withPolicy(newRule("s3:*", "arn:aws:s3:::*"), "arn:aws:iam::111122223333:policy/OtherPolicy"),
+	}
+	require.Nil(t, cache.SaveACL(rules))
+
+	count := func(table interface{}) int64 {
+		var n int64
+		require.Nil(t, cache.db.Model(table).Count(&n).Error)
+		return n
+	}
+	require.Equal(t, int64(1), count(&Principal{}))
+	require.Equal(t, int64(2), count(&Resource{}))
+	require.Equal(t, int64(1), count(&Role{}))
+	require.Equal(t, int64(2), count(&Policy{}))
+	require.Equal(t, int64(2), count(&Statement{}))
+
+	var grants []Grant
+	require.Nil(t, cache.db.Order("access_control_rule_id, position").Find(&grants).Error)
+	require.Len(t, grants, 6)
+	for i, g := range grants {
+		if i%2 == 0 {
+			require.Equal(t, roleGrant, g.Type)
+			require.NotNil(t, g.RoleID)
+			require.Nil(t, g.PolicyID)
+		} else {
+			require.Equal(t, policyGrant, g.Type)
+			require.NotNil(t, g.PolicyID)
+			require.Nil(t, g.RoleID)
+		}
+	}
+
+	// the inventory keeps the type, and patterns from rules aren't listed
+	resources, err := cache.FindResources(&model.Filter{Resources: []string{"*"}})
+	require.Nil(t, err)
+	require.Equal(t, []model.Resource{{ID: "arn:aws:s3:::bucket", Type: "AWS::S3::Bucket"}}, resources)
+
+	// roles and policies only known from grant chains haven't been fetched
+	roles, err := cache.FindRoles()
+	require.Nil(t, err)
+	require.Empty(t, roles)
+	policies, err := cache.FindPolicies()
+	require.Nil(t, err)
+	require.Empty(t, policies)
+}
+
+func TestSQLiteCacheFindPages(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	rules := manyRules(findBatchSize + 10)
+	for i := 0; i < len(rules); i += 3 {
+		rules[i].Principal.ID = fmt.Sprintf("AWS[arn:aws:iam::111122223333:role/Role%d]", i%7)
+	}
+	require.Nil(t, cache.SaveACL(rules))
+
+	// without a sort, the batches follow the order the rules were saved in
+	var streamed []model.AccessControlRule
+	require.Nil(t, cache.FindEach(&model.Filter{}, func(r model.AccessControlRule) error {
+		streamed = append(streamed, r)
+		return nil
+	}))
+	require.Equal(t, rules, streamed)
+
+	for _, s := range []string{model.SortByPrincipal, model.SortByPermission, model.SortByResource} {
+		t.Run(s, func(t *testing.T) {
+			sorted, err := cache.Find(&model.Filter{Page: model.Page{Sort: s}})
+			require.Nil(t, err)
+			require.Len(t, sorted, len(rules))
+			for i := 1; i < len(sorted); i++ {
+				prev, cur := model.SortKey(s, &sorted[i-1]), model.SortKey(s, &sorted[i])
+				require.True(t, strings.Join(prev, "\x00") < strings.Join(cur, "\x00"), "%v before %v", prev, cur)
+			}
+
+			var paged []model.AccessControlRule
+			var after []string
+			for {
+				page, err := cache.Find(&model.Filter{Page: model.Page{Sort: s, After: after, Limit: 300}})
+				require.Nil(t, err)
+				paged = append(paged, page...)
+				if len(page) < 300 {
+					break
+				}
+				after = model.SortKey(s, &page[len(page)-1])
+			}
+			require.Equal(t, sorted, paged)
+
+			page, err := cache.Find(&model.Filter{Page: model.Page{Sort: s, Offset: 990, Limit: 15}})
+			require.Nil(t, err)
+			require.Equal(t, sorted[990:1005], page)
+		})
+	}
+
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = cache.FindEach(&model.Filter{}, func(r model.AccessControlRule) error {
+		calls++
+		return stop
+	})
+	require.Equal(t, stop, err)
+	require.Equal(t, 1, calls)
+
+	_, err = cache.Find(&model.Filter{Page: model.Page{After: []string{"x"}}})
+	require.NotNil(t, err)
+}
+
+func TestSQLiteCacheAggregate(t *testing.T) {
+	cachetest.TestAggregate(t, func(t *testing.T) ports.CacheIface {
+		c, err := new("file::memory:", &gorm.Config{}, false)
+		require.Nil(t, err)
+		return c
+	})
+}
+
+func TestSQLiteCacheStatements(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	rule := newRule("s3:DeleteObject", "*")
+	rule.Effect = "Deny"
+	rule.Conditions = []model.Condition{
+		{Operator: "BoolIfExists", Key: "aws:MultiFactorAuthPresent", Values: []string{"false"}},
+	}
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{rule}))
+
+	found, err := cache.Find(&model.Filter{IncludeDeny: true})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{rule}, found)
+
+	// Deny rules don't grant anything
+	found, err = cache.Find(&model.Filter{Permissions: []string{"s3:*"}})
+	require.Nil(t, err)
+	require.Empty(t, found)
+	groups, err := cache.Aggregate(&model.Filter{}, &model.Aggregation{GroupBy: model.ByPrincipal, Count: model.ByPermission})
+	require.Nil(t, err)
+	require.Empty(t, groups)
+
+	// a new policy version can drop the conditions of the statement
+	rule.Conditions = nil
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{rule}))
+
+	found, err = cache.Find(&model.Filter{IncludeDeny: true})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{rule}, found)
+}
+
+func TestSQLiteCacheAllowAndDeny(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	allow := newRule("s3:DeleteObject", "*")
+	allow.Effect = "Allow"
+	deny := allow
+	deny.StatementIndex = 1
+	deny.Effect = "Deny"
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{allow, deny}))
+
+	found, err := cache.Find(&model.Filter{IncludeDeny: true})
+	require.Nil(t, err)
+	require.ElementsMatch(t, []model.AccessControlRule{allow, deny}, found)
+
+	found, err = cache.Find(&model.Filter{})
+	require.Nil(t, err)
+	require.Equal(t, []model.AccessControlRule{allow}, found)
+}
+
+func TestSQLiteCacheUsage(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	day := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	role := "arn:aws:iam::111122223333:role/Dev"
+	require.Nil(t, cache.SaveUsage([]model.Usage{
+		{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/a", LastUsed: day},
+		{Identity: role, Action: "s3:PutObject", LastUsed: day.Add(-48 * time.Hour)},
+		// duplicates within a save are merged
+		{Identity: role, Action: "s3:PutObject", LastUsed: day.Add(-72 * time.Hour)},
+	}))
+	// older logs loaded later don't move LastUsed back
+	require.Nil(t, cache.SaveUsage([]model.Usage{
+		{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/a", LastUsed: day.Add(-time.Hour)},
+		{Identity: role, Action: "s3:PutObject", LastUsed: day.Add(-24 * time.Hour)},
+	}))
+
+	got, err := cache.FindUsage(day.Add(-24 * time.Hour))
+	require.Nil(t, err)
+	require.Len(t, got, 2)
+	for i, want := range []model.Usage{
+		{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/a", LastUsed: day},
+		{Identity: role, Action: "s3:PutObject", LastUsed: day.Add(-24 * time.Hour)},
+	} {
+		require.True(t, want.LastUsed.Equal(got[i].LastUsed), "%v: %v", i, got[i].LastUsed)
+		got[i].LastUsed = want.LastUsed
+		require.Equal(t, want, got[i])
+	}
+
+	got, err = cache.FindUsage(day.Add(time.Second))
+	require.Nil(t, err)
+	require.Empty(t, got)
+}
+
+func TestSQLiteCachePolicies(t *testing.T) {
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	policy := model.Policy{
+		ARN:      "arn:aws:iam::111122223333:policy/TestPolicy",
+		Name:     "TestPolicy",
+		Version:  "v1",
+		Document: `{"Version":"2012-10-17","Statement":[]}`,
+	}
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{newRule("s3:GetObject", "*")}))
+	require.Nil(t, cache.SavePolicies([]model.Policy{policy}))
+
+	policy.Version = "v2"
+	require.Nil(t, cache.SavePolicies([]model.Policy{policy}))
+
+	policies, err := cache.FindPolicies()
+	require.Nil(t, err)
+	require.Equal(t, []model.Policy{policy}, policies)
+
+	var statement Statement
+	require.Nil(t, cache.db.Preload("Policy").First(&statement).Error)
+	require.Equal(t, policy.ARN, statement.Policy.ARN)
+}
+
+func BenchmarkSQLiteCacheFind(b *testing.B) {
+	for _, n := range []int{10000, 1000000} {
+		b.Run(fmt.Sprintf("%d rules", n), func(b *testing.B) {
+			cache, err := Open(filepath.Join(b.TempDir(), "bench.db"), false)
+			require.Nil(b, err)
+			require.Nil(b, cache.SaveACL(manyRules(n)))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := cache.Find(&model.Filter{
+					Permissions: []string{"s3:GetObject"},
+					Resources:   []string{"arn:aws:s3:::bucket-42/*"},
+				})
+				require.Nil(b, err)
+			}
+		})
+	}
+}
+
 func newRule(permisison string, resource string) model.AccessControlRule {
 	return model.AccessControlRule{
 		Principal: model.Principal{
@@ -208,111 +828,102 @@ func newRule(permisison string, resource string) model.AccessControlRule {
 	}
 }
 
-func TestMatch(t *testing.T) {
-	type args struct {
-		s1 string
-		s2 string
+func withPolicy(rule model.AccessControlRule, policy string) model.AccessControlRule {
+	rule.GrantChain = []model.GrantIface{rule.GrantChain[0], model.NewPolicyGrant(policy)}
+	rule.StatementIndex = 1
+	return rule
+}
+
+func manyRules(n int) []model.AccessControlRule {
+	rules := make([]model.AccessControlRule, 0, n)
+	for i := 0; i < n; i++ {
+		rules = append(rules, newRule("s3:GetObject", fmt.Sprintf("arn:aws:s3:::bucket-%d/*", i)))
 	}
+	return rules
+}
+
+func TestSQLiteCacheResources(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name   string
+		saved  []model.Resource
+		filter model.Filter
+		want   []model.Resource
 	}{
 		{
-			"wildcard in string 1 only",
-			args{
-				"aws:s3:ap-southeast-2:2893483479:mybucket:test/somedir/obj",
-				"aws:s3:*:2893483479:mybucket:*",
-			},
-			true,
-		},
-		{
-			"wildcard in string 2 only",
-			args{
-				"aws:s3:*:2893483479:mybucket:*",
-				"aws:s3:ap-southeast-2:2893483479:mybucket:test/somedir/obj",
-			},
-			true,
-		},
-		{
-			"wildcards in different components of both strings",
-			args{
-				"aws:*:ap-*:2893483479:*:test/somedir/obj",
-				"aws:s3:*:2893483479:mybucket:*",
-			},
-			true,
-		},
-		{
-			"multiple wildcards in sequence shouldn't affect match",
-			args{
-				"aws:*:ap-*:2893483479:*******:test/*****/obj",
-				"aws:s3:*:2893483479:mybucket:*",
-			},
-			true,
-		},
-		{
-			"string 1 with less components than string 2",
-			args{
-				"aws:*:ap-*",
-				"aws:s3:*:2893483479:mybucket:*",
-			},
-			true,
-		},
-		{
-			"string 2 with less components than string 1",
-			args{
-				"aws:s3:*:2893483479:mybucket:*",
-				"aws:*:ap-*",
+			"wildcard match",
+			[]model.Resource{
+				{ID: "arn:aws:s3:::prod-data", Type: "AWS::S3::Bucket"},
+				{ID: "arn:aws:s3:::dev-data", Type: "AWS::S3::Bucket"},
+				{ID: "arn:aws:sqs:ap-southeast-2:111122223333:queue", Type: "sqs"},
 			},
-			true,
-		},
-		{
-			"strings don't match",
-			args{
-				"aws:*:ap-*:2893483479:test:*",
-				"aws:s3:*:2893483479:mybucket:*",
+			model.Filter{
+				Resources: []string{"arn:aws:s3:::*"},
 			},
-			false,
-		},
-		{
-			"string 1 can be anything",
-			args{
-				"*",
-				"arn:aws:logs:*:*:log-group:*",
+			[]model.Resource{
+				{ID: "arn:aws:s3:::dev-data", Type: "AWS::S3::Bucket"},
+				{ID: "arn:aws:s3:::prod-data", Type: "AWS::S3::Bucket"},
 			},
-			true,
 		},
 		{
-			"string 2 can be anything",
-			args{
-				"arn:aws:logs:*:*:log-group:*",
-				"*",
+			"update type",
+			[]model.Resource{
+				{ID: "arn:aws:s3:::prod-data", Type: "s3"},
+				{ID: "arn:aws:s3:::prod-data", Type: "AWS::S3::Bucket"},
 			},
-			true,
-		},
-		{
-			"string 1 ends in a letter present in the middle of string 2",
-			args{
-				"*s",
-				"arn:aws:logs:*:*:log-group:*",
+			model.Filter{
+				Resources:  []string{"arn:aws:s3:::prod-data"},
+				ExactMatch: true,
 			},
-			false,
-		},
-		{
-			"string 1 has a letter in string 2 surrounded by *",
-			args{
-				"*s*",
-				"arn:aws:logs:*:*:log-group:*",
+			[]model.Resource{
+				{ID: "arn:aws:s3:::prod-data", Type: "AWS::S3::Bucket"},
 			},
-			true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := match(tt.args.s1, tt.args.s2)
-			if got != tt.want {
-				t.Errorf("match() = %v, want %v", got, tt.want)
-			}
+			cache, err := new("file::memory:", &gorm.Config{}, false)
+			require.Nil(t, err)
+
+			require.Nil(t, cache.SaveResources(tt.saved))
+
+			found, err := cache.FindResources(&tt.filter)
+
+			require.Nil(t, err)
+			require.Equal(t, tt.want, found)
 		})
 	}
 }
+
+func TestSQLiteCacheRoles(t *testing.T) {
+	used := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	role := model.Role{
+		ARN:        "arn:aws:iam::111122223333:role/TestRole",
+		Name:       "TestRole",
+		CreateDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Trust: []model.TrustStatement{
+			{
+				Principal: model.Principal{ID: "Service[lambda.amazonaws.com]"},
+				Conditions: []model.Condition{
+					{Operator: "StringEquals", Key: "aws:SourceAccount", Values: []string{"111122223333"}},
+				},
+			},
+		},
+	}
+	usedRole := role
+	usedRole.LastUsed = &used
+	usedRole.Policies = []string{"arn:aws:iam::111122223333:policy/TestPolicy"}
+
+	cache, err := new("file::memory:", &gorm.Config{}, false)
+	require.Nil(t, err)
+
+	require.Nil(t, cache.SaveRoles([]model.Role{role}))
+	require.Nil(t, cache.SaveRoles([]model.Role{usedRole}))
+
+	roles, err := cache.FindRoles()
+
+	require.Nil(t, err)
+	require.Len(t, roles, 1)
+	require.Equal(t, usedRole.Trust, roles[0].Trust)
+	require.True(t, used.Equal(*roles[0].LastUsed))
+	require.Equal(t, usedRole.Policies, roles[0].Policies)
+}
@@ -0,0 +1,14 @@
+package cache
+
+import "gorm.io/gorm"
+
+// Statement is identified by its position in the document of the policy.
+type Statement struct {
+	gorm.Model
+	PolicyID       uint `gorm:"uniqueIndex:idx_statements_policy_statement"`
+	Policy         Policy
+	StatementIndex int `gorm:"uniqueIndex:idx_statements_policy_statement"`
+	Effect         string
+	// Conditions is the JSON encoding of []model.Condition
+	Conditions string
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"gorm.io/gorm"
+)
+
+type Usage struct {
+	gorm.Model
+	Identity string    `gorm:"uniqueIndex:idx_usage"`
+	Action   string    `gorm:"uniqueIndex:idx_usage"`
+	Resource string    `gorm:"uniqueIndex:idx_usage"`
+	LastUsed time.Time `gorm:"index"`
+}
+
+func NewUsage(du *model.Usage) *Usage {
+	return &Usage{
+		Identity: du.Identity,
+		Action:   du.Action,
+		Resource: du.Resource,
+		// times are compared as strings by SQLite
+		LastUsed: du.LastUsed.UTC(),
+	}
+}
+
+func (u *Usage) Map() model.Usage {
+	return model.Usage{
+		Identity: u.Identity,
+		Action:   u.Action,
+		Resource: u.Resource,
+		LastUsed: u.LastUsed,
+	}
+}
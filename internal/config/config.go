@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultProfileName = "default"
+
+// Config is the content of config.yaml. Each profile describes one
+// environment iamsnitch runs against: where its cache lives and how to reach
+// its AWS accounts.
+type Config struct {
+	DefaultProfile string             `yaml:"default_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+type Profile struct {
+	Cache       CacheConfig `yaml:"cache"`
+	AWS         AWSConfig   `yaml:"aws"`
+	Accounts    []Account   `yaml:"accounts"`
+	Output      string      `yaml:"output"`
+	Concurrency int         `yaml:"concurrency"`
+	Audit       AuditConfig `yaml:"audit"`
+	// Queries are saved query expressions by name, run with
+	// `iamsnitch query --saved <name>`
+	Queries map[string]string `yaml:"queries"`
+}
+
+// CacheConfig locates the cache: a SQLite file at Path or, with the postgres
+// backend, the database at DSN.
+type CacheConfig struct {
+	Backend string `yaml:"backend"`
+	Path    string `yaml:"path"`
+	DSN     string `yaml:"dsn"`
+}
+
+// AWSConfig selects the credentials used to call AWS. RoleARN is assumed on
+// top of the shared config profile.
+type AWSConfig struct {
+	Profile    string `yaml:"profile"`
+	Region     string `yaml:"region"`
+	RoleARN    string `yaml:"role_arn"`
+	ExternalID string `yaml:"external_id"`
+}
+
+// Account is refreshed by assuming RoleARN with the profile credentials.
+type Account struct {
+	ID      string `yaml:"id"`
+	RoleARN string `yaml:"role_arn"`
+}
+
+type AuditConfig struct {
+	FailOn        string   `yaml:"fail_on"`
+	KnownAccounts []string `yaml:"known_accounts"`
+	UnusedDays    *int     `yaml:"unused_days"`
+}
+
+// DefaultPath is $XDG_CONFIG_HOME/iamsnitch/config.yaml, falling back to
+// ~/.config/iamsnitch/config.yaml.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "iamsnitch", "config.yaml"), nil
+}
+
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Profile returns the named profile with defaults filled in. An empty name
+// selects the default profile, which doesn't need to exist in the file.
+func (c *Config) Profile(name string) (*Profile, error) {
+	explicit := name != ""
+	if !explicit {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		name = DefaultProfileName
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok && (explicit || c.DefaultProfile != "") {
+		return nil, fmt.Errorf("profile %v not found", name)
+	}
+
+	p.setDefaults()
+	return &p, nil
+}
+
+// ApplyEnv overrides the profile with the IAMSNITCH_* environment variables.
+func (p *Profile) ApplyEnv(getenv func(string) string) error {
+	strs := map[string]*string{
+		"IAMSNITCH_CACHE_BACKEND": &p.Cache.Backend,
+		"IAMSNITCH_CACHE_PATH":    &p.Cache.Path,
+		"IAMSNITCH_CACHE_DSN":     &p.Cache.DSN,
+		"IAMSNITCH_AWS_PROFILE":   &p.AWS.Profile,
+		"IAMSNITCH_AWS_REGION":    &p.AWS.Region,
+		"IAMSNITCH_ROLE_ARN":      &p.AWS.RoleARN,
+		"IAMSNITCH_EXTERNAL_ID":   &p.AWS.ExternalID,
+		"IAMSNITCH_OUTPUT":        &p.Output,
+		"IAMSNITCH_FAIL_ON":       &p.Audit.FailOn,
+	}
+	for env, v := range strs {
+		if s := getenv(env); s != "" {
+			*v = s
+		}
+	}
+
+	if getenv("IAMSNITCH_CACHE_DSN") != "" && getenv("IAMSNITCH_CACHE_BACKEND") == "" {
+		p.Cache.Backend = "postgres"
+	}
+	if s := getenv("IAMSNITCH_KNOWN_ACCOUNTS"); s != "" {
+		p.Audit.KnownAccounts = strings.Split(s, ",")
+	}
+	if s := getenv("IAMSNITCH_CONCURRENCY"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("IAMSNITCH_CONCURRENCY must be a positive number")
+		}
+		p.Concurrency = n
+	}
+	if s := getenv("IAMSNITCH_UNUSED_DAYS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("IAMSNITCH_UNUSED_DAYS must be zero or a positive number")
+		}
+		p.Audit.UnusedDays = &n
+	}
+	return p.validate()
+}
+
+func (p *Profile) setDefaults() {
+	if p.Cache.Backend == "" {
+		p.Cache.Backend = "sqlite"
+		if p.Cache.DSN != "" {
+			p.Cache.Backend = "postgres"
+		}
+	}
+	if p.Cache.Path == "" {
+		p.Cache.Path = ".snitch.db"
+	}
+	if p.Output == "" {
+		p.Output = "text"
+	}
+	if p.Concurrency < 1 {
+		p.Concurrency = 1
+	}
+}
+
+func (p *Profile) validate() error {
+	switch p.Cache.Backend {
+	case "sqlite":
+	case "postgres":
+		if p.Cache.DSN == "" {
+			return fmt.Errorf("the postgres cache backend requires a dsn")
+		}
+	default:
+		return fmt.Errorf("unknown cache backend %v", p.Cache.Backend)
+	}
+	for _, a := range p.Accounts {
+		if a.RoleARN == "" {
+			return fmt.Errorf("account %v has no role_arn", a.ID)
+		}
+	}
+	return nil
+}
+
+// ExpandHome replaces a leading ~ with the home directory of the user.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+default_profile: prod
+profiles:
+  prod:
+    cache:
+      path: ~/.cache/iamsnitch/prod.db
+    aws:
+      profile: prod-admin
+      region: eu-west-1
+    accounts:
+      - id: "111122223333"
+        role_arn: arn:aws:iam::111122223333:role/iamsnitch
+    output: json
+    concurrency: 4
+    audit:
+      fail_on: high
+      known_accounts: ["444455556666"]
+      unused_days: 30
+    queries:
+      public-buckets: principal ~ "AWS[*]" and resource ~ "arn:aws:s3:::*"
+  shared:
+    cache:
+      dsn: postgres://snitch@db.internal/snitch
+  dev:
+    aws:
+      role_arn: arn:aws:iam::777788889999:role/iamsnitch
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(testConfig), 0644))
+
+	c, err := Load(path)
+	require.Nil(t, err)
+	require.Equal(t, "prod", c.DefaultProfile)
+	require.Len(t, c.Profiles, 3)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestProfile(t *testing.T) {
+	thirty := 30
+
+	tests := []struct {
+		name    string
+		config  string
+		profile string
+		want    *Profile
+		wantErr bool
+	}{
+		{
+			"default profile",
+			testConfig,
+			"",
+			&Profile{
+				Cache: CacheConfig{Backend: "sqlite", Path: "~/.cache/iamsnitch/prod.db"},
+				AWS:   AWSConfig{Profile: "prod-admin", Region: "eu-west-1"},
+				Accounts: []Account{
+					{ID: "111122223333", RoleARN: "arn:aws:iam::111122223333:role/iamsnitch"},
+				},
+				Output:      "json",
+				Concurrency: 4,
+				Audit: AuditConfig{
+					FailOn:        "high",
+					KnownAccounts: []string{"444455556666"},
+					UnusedDays:    &thirty,
+				},
+				Queries: map[string]string{
+					"public-buckets": `principal ~ "AWS[*]" and resource ~ "arn:aws:s3:::*"`,
+				},
+			},
+			false,
+		},
+		{
+			"named profile with defaults",
+			testConfig,
+			"dev",
+			&Profile{
+				Cache:       CacheConfig{Backend: "sqlite", Path: ".snitch.db"},
+				AWS:         AWSConfig{RoleARN: "arn:aws:iam::777788889999:role/iamsnitch"},
+				Output:      "text",
+				Concurrency: 1,
+			},
+			false,
+		},
+		{
+			"dsn selects postgres",
+			testConfig,
+			"shared",
+			&Profile{
+				Cache:       CacheConfig{Backend: "postgres", Path: ".snitch.db", DSN: "postgres://snitch@db.internal/snitch"},
+				Output:      "text",
+				Concurrency: 1,
+			},
+			false,
+		},
+		{
+			"no config file",
+			"",
+			"",
+			&Profile{
+				Cache:       CacheConfig{Backend: "sqlite", Path: ".snitch.db"},
+				Output:      "text",
+				Concurrency: 1,
+			},
+			false,
+		},
+		{
+			"unknown profile",
+			testConfig,
+			"staging",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			if tt.config != "" {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				require.Nil(t, ioutil.WriteFile(path, []byte(tt.config), 0644))
+				lc, err := Load(path)
+				require.Nil(t, err)
+				c = *lc
+			}
+
+			p, err := c.Profile(tt.profile)
+
+			require.Equal(t, tt.wantErr, err != nil)
+			require.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(p *Profile)
+		wantErr bool
+	}{
+		{
+			"overrides",
+			map[string]string{
+				"IAMSNITCH_CACHE_PATH":     "/tmp/snitch.db",
+				"IAMSNITCH_AWS_PROFILE":    "other",
+				"IAMSNITCH_CONCURRENCY":    "8",
+				"IAMSNITCH_KNOWN_ACCOUNTS": "111122223333,444455556666",
+				"IAMSNITCH_UNUSED_DAYS":    "0",
+			},
+			func(p *Profile) {
+				zero := 0
+				p.Cache.Path = "/tmp/snitch.db"
+				p.AWS.Profile = "other"
+				p.Concurrency = 8
+				p.Audit.KnownAccounts = []string{"111122223333", "444455556666"}
+				p.Audit.UnusedDays = &zero
+			},
+			false,
+		},
+		{
+			"postgres dsn",
+			map[string]string{"IAMSNITCH_CACHE_DSN": "postgres://snitch@db/snitch"},
+			func(p *Profile) {
+				p.Cache.Backend = "postgres"
+				p.Cache.DSN = "postgres://snitch@db/snitch"
+			},
+			false,
+		},
+		{
+			"postgres without dsn",
+			map[string]string{"IAMSNITCH_CACHE_BACKEND": "postgres"},
+			nil,
+			true,
+		},
+		{
+			"invalid concurrency",
+			map[string]string{"IAMSNITCH_CONCURRENCY": "many"},
+			nil,
+			true,
+		},
+		{
+			"unknown backend",
+			map[string]string{"IAMSNITCH_CACHE_BACKEND": "oracle"},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := (&Config{}).Profile("")
+			require.Nil(t, err)
+
+			err = p.ApplyEnv(func(k string) string { return tt.env[k] })
+
+			require.Equal(t, tt.wantErr, err != nil)
+			if tt.want != nil {
+				want, _ := (&Config{}).Profile("")
+				tt.want(want)
+				require.Equal(t, want, p)
+			}
+		})
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	require.Nil(t, err)
+
+	p, err := ExpandHome("~/.cache/snitch.db")
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(home, ".cache/snitch.db"), p)
+
+	p, err = ExpandHome("snitch.db")
+	require.Nil(t, err)
+	require.Equal(t, "snitch.db", p)
+}
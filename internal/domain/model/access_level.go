@@ -0,0 +1,94 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+type AccessLevel string
+
+const (
+	List                  AccessLevel = "List"
+	Read                  AccessLevel = "Read"
+	Write                 AccessLevel = "Write"
+	PermissionsManagement AccessLevel = "Permissions management"
+	Tagging               AccessLevel = "Tagging"
+)
+
+var AccessLevels = []AccessLevel{List, Read, Write, PermissionsManagement, Tagging}
+
+// accessLevelVerbs classifies actions by the verb their name starts with. The
+// first matching level wins, actions matching none are considered Write.
+var accessLevelVerbs = []struct {
+	level AccessLevel
+	verbs []string
+}{
+	{Tagging, []string{"Tag*", "Untag*", "CreateTags", "DeleteTags", "AddTags*", "RemoveTags*"}},
+	{PermissionsManagement, []string{
+		"Attach*Policy", "Detach*Policy", "Put*Policy", "Delete*Policy", "Create*Policy",
+		"CreatePolicyVersion", "DeletePolicyVersion", "SetDefaultPolicyVersion",
+		"Update*Policy", "Put*Acl", "AddPermission*", "RemovePermission*",
+		"CreateGrant", "RevokeGrant", "RetireGrant", "AddUserToGroup",
+		"RemoveUserFromGroup", "CreateAccessKey", "CreateLoginProfile",
+		"UpdateLoginProfile",
+	}},
+	{List, []string{"List*"}},
+	{Read, []string{"Get*", "Describe*", "BatchGet*", "Query", "Scan", "Select*", "Head*", "Lookup*", "Search*", "Download*", "View*"}},
+}
+
+// AccessLevelsOf returns every access level the permission may grant. A
+// wildcard action such as s3:* spans several levels.
+func AccessLevelsOf(permission string) []AccessLevel {
+	name := permission
+	if i := strings.Index(permission, ":"); i >= 0 {
+		name = permission[i+1:]
+	}
+
+	if !strings.Contains(name, "*") {
+		for _, lv := range accessLevelVerbs {
+			for _, v := range lv.verbs {
+				if wildcard.Covers(v, name) {
+					return []AccessLevel{lv.level}
+				}
+			}
+		}
+		return []AccessLevel{Write}
+	}
+
+	var levels []AccessLevel
+	readOnly := false
+	prefix := name[:strings.Index(name, "*")]
+	for _, lv := range accessLevelVerbs {
+		for _, v := range lv.verbs {
+			if wildcard.Match(name, v) {
+				levels = appendLevel(levels, lv.level)
+				if prefix != "" && strings.HasPrefix(prefix, strings.TrimSuffix(v, "*")) && lv.level != PermissionsManagement {
+					readOnly = true
+				}
+			}
+		}
+	}
+	if !readOnly {
+		levels = appendLevel(levels, Write)
+	}
+	return levels
+}
+
+func HasAccessLevel(permission string, level AccessLevel) bool {
+	for _, l := range AccessLevelsOf(permission) {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+func appendLevel(levels []AccessLevel, level AccessLevel) []AccessLevel {
+	for _, l := range levels {
+		if l == level {
+			return levels
+		}
+	}
+	return append(levels, level)
+}
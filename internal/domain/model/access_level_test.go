@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLevelsOf(t *testing.T) {
+	tests := []struct {
+		permission string
+		want       []AccessLevel
+	}{
+		{"s3:GetObject", []AccessLevel{Read}},
+		{"s3:ListBucket", []AccessLevel{List}},
+		{"s3:PutObject", []AccessLevel{Write}},
+		{"s3:PutBucketPolicy", []AccessLevel{PermissionsManagement}},
+		{"iam:AttachRolePolicy", []AccessLevel{PermissionsManagement}},
+		{"iam:DetachUserPolicy", []AccessLevel{PermissionsManagement}},
+		{"iot:AttachPolicy", []AccessLevel{PermissionsManagement}},
+		{"ec2:AttachVolume", []AccessLevel{Write}},
+		{"ec2:DetachNetworkInterface", []AccessLevel{Write}},
+		{"ec2:CreateTags", []AccessLevel{Tagging}},
+		{"ec2:DeleteTags", []AccessLevel{Tagging}},
+		{"ec2:TagResource", []AccessLevel{Tagging}},
+		{"s3:Get*", []AccessLevel{Read}},
+		{"ec2:Describe*", []AccessLevel{Read}},
+		{"iam:De*", []AccessLevel{Tagging, PermissionsManagement, Read, Write}},
+		{"s3:*", []AccessLevel{Tagging, PermissionsManagement, List, Read, Write}},
+		{"*", []AccessLevel{Tagging, PermissionsManagement, List, Read, Write}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			require.Equal(t, tt.want, AccessLevelsOf(tt.permission))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+// Fields rules can be grouped and counted by.
+const (
+	ByPrincipal  = "principal"
+	ByPermission = "permission"
+	ByService    = "service"
+	ByResource   = "resource"
+	// ByPolicy is the policy granting the rule, the last one of its grant
+	// chain
+	ByPolicy = "policy"
+)
+
+// Aggregation counts the distinct values of Count for each value of GroupBy
+// among the rules, only taking the rules with a permission at one of Levels
+// into account when given. Groups are ranked by count and only the first
+// Limit are kept, all of them when 0.
+type Aggregation struct {
+	GroupBy string
+	Count   string
+	Levels  []AccessLevel
+	Limit   int
+}
+
+// Group is a value of the GroupBy field with the values of the Count field
+// found with it. When counting permissions or services, a wildcard value
+// counts for each value of the other groups it covers, so s3:* isn't ranked
+// below two s3 actions.
+type Group struct {
+	Key    string
+	Count  int
+	Values []string
+}
+
+func (a *Aggregation) Validate() error {
+	for _, f := range []string{a.GroupBy, a.Count} {
+		switch f {
+		case ByPrincipal, ByPermission, ByService, ByResource, ByPolicy:
+		default:
+			return fmt.Errorf("unknown aggregation field %q", f)
+		}
+	}
+	if a.Limit < 0 {
+		return fmt.Errorf("limit can't be negative")
+	}
+	return nil
+}
+
+// ServiceOf returns the service prefix of a permission, e.g. s3 for s3:Get*,
+// or * when it isn't spelled out.
+func ServiceOf(permission string) string {
+	literal := permission
+	if i := strings.IndexByte(permission, '*'); i >= 0 {
+		literal = permission[:i]
+	}
+	i := strings.IndexByte(literal, ':')
+	if i < 0 {
+		return "*"
+	}
+	return permission[:i]
+}
+
+// Tally accumulates the values of an aggregation into groups.
+type Tally struct {
+	agg    *Aggregation
+	groups map[string]map[string]bool
+}
+
+func NewTally(agg *Aggregation) *Tally {
+	return &Tally{
+		agg:    agg,
+		groups: make(map[string]map[string]bool),
+	}
+}
+
+// Add counts value in group when permission is at one of the aggregation
+// levels. Empty groups and values, such as the policy of a rule granted by a
+// trust policy alone, are left out.
+func (t *Tally) Add(group string, value string, permission string) {
+	if group == "" || value == "" || !t.hasLevel(permission) {
+		return
+	}
+	values, ok := t.groups[group]
+	if !ok {
+		values = make(map[string]bool)
+		t.groups[group] = values
+	}
+	values[value] = true
+}
+
+func (t *Tally) hasLevel(permission string) bool {
+	if len(t.agg.Levels) == 0 {
+		return true
+	}
+	for _, l := range t.agg.Levels {
+		if HasAccessLevel(permission, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// Groups ranks the groups by count, then by key.
+func (t *Tally) Groups() []Group {
+	var literals []string
+	if t.agg.Count == ByPermission || t.agg.Count == ByService {
+		seen := make(map[string]bool)
+		for _, values := range t.groups {
+			for v := range values {
+				if !strings.Contains(v, "*") && !seen[v] {
+					seen[v] = true
+					literals = append(literals, v)
+				}
+			}
+		}
+	}
+
+	groups := make([]Group, 0, len(t.groups))
+	for key, values := range t.groups {
+		g := Group{Key: key, Count: expandedCount(values, literals), Values: make([]string, 0, len(values))}
+		for v := range values {
+			g.Values = append(g.Values, v)
+		}
+		sort.Strings(g.Values)
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	if t.agg.Limit > 0 && len(groups) > t.agg.Limit {
+		groups = groups[:t.agg.Limit]
+	}
+	return groups
+}
+
+// expandedCount counts the values, replacing each wildcard by the literals it
+// covers. A wildcard covering none of them, nor covered by another wildcard,
+// counts as one.
+func expandedCount(values map[string]bool, literals []string) int {
+	if literals == nil {
+		return len(values)
+	}
+	covers := func(pattern, value string) bool {
+		return wildcard.Covers(strings.ToLower(pattern), strings.ToLower(value))
+	}
+
+	var wildcards []string
+	covered := make(map[string]bool)
+	for v := range values {
+		if !strings.Contains(v, "*") {
+			covered[v] = true
+			continue
+		}
+		wildcards = append(wildcards, v)
+		for _, l := range literals {
+			if covers(v, l) {
+				covered[l] = true
+			}
+		}
+	}
+
+	count := len(covered)
+	for i, w := range wildcards {
+		counted := false
+		for _, l := range literals {
+			counted = counted || covers(w, l)
+		}
+		for j, other := range wildcards {
+			// of two wildcards covering each other, the first one counts
+			counted = counted || i != j && covers(other, w) && (!covers(w, other) || other < w)
+		}
+		if !counted {
+			count++
+		}
+	}
+	return count
+}
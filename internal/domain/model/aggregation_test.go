@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceOf(t *testing.T) {
+	tests := map[string]string{
+		"s3:GetObject": "s3",
+		"s3:*":         "s3",
+		"s*:Get*":      "*",
+		"*":            "*",
+		"s3":           "*",
+	}
+	for permission, want := range tests {
+		require.Equal(t, want, ServiceOf(permission), permission)
+	}
+}
+
+func TestTally(t *testing.T) {
+	tally := NewTally(&Aggregation{
+		GroupBy: ByPrincipal,
+		Count:   ByPermission,
+		Levels:  []AccessLevel{Write, PermissionsManagement},
+		Limit:   2,
+	})
+	tally.Add("AWS[b]", "s3:PutObject", "s3:PutObject")
+	tally.Add("AWS[b]", "s3:GetObject", "s3:GetObject")
+	tally.Add("AWS[a]", "s3:PutObject", "s3:PutObject")
+	tally.Add("AWS[c]", "iam:AttachRolePolicy", "iam:AttachRolePolicy")
+	tally.Add("AWS[c]", "s3:*", "s3:*")
+	tally.Add("AWS[c]", "s3:*", "s3:*")
+	tally.Add("", "s3:PutObject", "s3:PutObject")
+
+	require.Equal(t, []Group{
+		{Key: "AWS[c]", Count: 2, Values: []string{"iam:AttachRolePolicy", "s3:*"}},
+		{Key: "AWS[a]", Count: 1, Values: []string{"s3:PutObject"}},
+	}, tally.Groups())
+}
+
+func TestTallyWildcards(t *testing.T) {
+	tally := NewTally(&Aggregation{GroupBy: ByPrincipal, Count: ByPermission})
+	tally.Add("AWS[a]", "s3:GetObject", "s3:GetObject")
+	tally.Add("AWS[a]", "s3:PutObject", "s3:PutObject")
+	tally.Add("AWS[a]", "iam:PassRole", "iam:PassRole")
+	tally.Add("AWS[b]", "s3:*", "s3:*")
+	tally.Add("AWS[b]", "S3:GetObject", "S3:GetObject")
+	tally.Add("AWS[c]", "*", "*")
+	tally.Add("AWS[c]", "s3:*", "s3:*")
+	tally.Add("AWS[d]", "sqs:*", "sqs:*")
+	tally.Add("AWS[d]", "sqs:Send*", "sqs:Send*")
+
+	require.Equal(t, []Group{
+		{Key: "AWS[c]", Count: 4, Values: []string{"*", "s3:*"}},
+		{Key: "AWS[a]", Count: 3, Values: []string{"iam:PassRole", "s3:GetObject", "s3:PutObject"}},
+		{Key: "AWS[b]", Count: 3, Values: []string{"S3:GetObject", "s3:*"}},
+		{Key: "AWS[d]", Count: 1, Values: []string{"sqs:*", "sqs:Send*"}},
+	}, tally.Groups())
+}
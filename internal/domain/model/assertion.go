@@ -0,0 +1,27 @@
+package model
+
+// Assertion describes an expectation about who holds which permissions.
+// Permission assertions select rules by Permissions and Resources and then
+// restrict the principals holding them with Only, Accounts or Nobody.
+// Principal assertions select rules by Principals and forbid the access
+// levels in DenyAccessLevels.
+type Assertion struct {
+	Name             string        `yaml:"name"`
+	Permissions      []string      `yaml:"permissions"`
+	Resources        []string      `yaml:"resources"`
+	Principals       []string      `yaml:"principals"`
+	Only             []string      `yaml:"only"`
+	Accounts         []string      `yaml:"accounts"`
+	Nobody           bool          `yaml:"nobody"`
+	DenyAccessLevels []AccessLevel `yaml:"deny_access_levels"`
+}
+
+type AssertionResult struct {
+	Assertion  Assertion
+	Violations []AccessControlRule
+	Err        error
+}
+
+func (r *AssertionResult) Passed() bool {
+	return r.Err == nil && len(r.Violations) == 0
+}
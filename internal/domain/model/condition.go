@@ -0,0 +1,28 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Condition struct {
+	Operator string
+	Key      string
+	Values   []string
+}
+
+// String lays the condition out as its operator then key=values, the values
+// separated by commas.
+func (c Condition) String() string {
+	return fmt.Sprintf("%v %v=%v", c.Operator, c.Key, strings.Join(c.Values, ","))
+}
+
+// FormatConditions lays conditions out on a single line, empty when there
+// are none. Equal conditions in the same order format the same.
+func FormatConditions(conditions []Condition) string {
+	formatted := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		formatted = append(formatted, c.String())
+	}
+	return strings.Join(formatted, " and ")
+}
@@ -0,0 +1,13 @@
+package model
+
+type EscalationTechnique struct {
+	ID          string
+	Description string
+	Permissions []string
+}
+
+type EscalationPath struct {
+	Principal  Principal
+	Technique  EscalationTechnique
+	GrantChain []GrantIface
+}
@@ -1,7 +1,107 @@
 package model
 
+import "fmt"
+
 type Filter struct {
+	Principals  []string
 	Permissions []string
 	Resources   []string
+	Via         Via
 	ExactMatch  bool
+	// IncludeDeny keeps the rules of Deny statements, which take access away
+	// rather than grant it and are left out otherwise
+	IncludeDeny bool
+	Page
+}
+
+// Via narrows rules down by their grant chain: through any of the policies,
+// through any of the roles, and granted by a policy of any of the types.
+// Policies and roles are matched like the other filters, types exactly.
+type Via struct {
+	Policies []string
+	Roles    []string
+	Types    []string
+}
+
+// Validate checks the types are known and of policies rules are cached for.
+// Only managed policies are fetched so far, asking for the other types would
+// always find nothing.
+func (v *Via) Validate() error {
+	for _, t := range v.Types {
+		switch t {
+		case ManagedPolicy:
+		case InlinePolicy, ResourcePolicy, SCP:
+			return fmt.Errorf("%v policies aren't fetched, no rule is granted by one", t)
+		default:
+			return fmt.Errorf("unknown grant type %q", t)
+		}
+	}
+	return nil
+}
+
+// Rules can be sorted by one of these fields, then by the other two and the
+// rule ID.
+const (
+	SortByPrincipal  = "principal"
+	SortByPermission = "permission"
+	SortByResource   = "resource"
+)
+
+// Page selects part of the matching rules. Without Sort they come in the order
+// they were saved. After is the SortKey of the last rule of the previous page,
+// which unlike Offset doesn't require going through the rules before it, so it
+// needs a Sort. Limit 0 means no limit.
+type Page struct {
+	Sort   string
+	After  []string
+	Offset int
+	Limit  int
+}
+
+// SortFields lists the fields rules are sorted by, except the rule ID that
+// comes last.
+func SortFields(sort string) ([]string, error) {
+	switch sort {
+	case "":
+		return nil, nil
+	case SortByPrincipal:
+		return []string{SortByPrincipal, SortByPermission, SortByResource}, nil
+	case SortByPermission:
+		return []string{SortByPermission, SortByResource, SortByPrincipal}, nil
+	case SortByResource:
+		return []string{SortByResource, SortByPermission, SortByPrincipal}, nil
+	}
+	return nil, fmt.Errorf("unknown sort %q", sort)
+}
+
+// Validate checks the sort is known and a cursor has the shape of its keys.
+func (p *Page) Validate() error {
+	fields, err := SortFields(p.Sort)
+	if err != nil {
+		return err
+	}
+	if p.After != nil && (p.Sort == "" || len(p.After) != len(fields)+1) {
+		return fmt.Errorf("cursor doesn't match sort %q", p.Sort)
+	}
+	if p.Offset < 0 || p.Limit < 0 {
+		return fmt.Errorf("offset and limit can't be negative")
+	}
+	return nil
+}
+
+// SortKey is the cursor locating the rule in the sort order.
+func SortKey(sort string, r *AccessControlRule) []string {
+	fields, _ := SortFields(sort)
+	key := make([]string, 0, len(fields)+1)
+	for _, f := range fields {
+		switch f {
+		case SortByPrincipal:
+			key = append(key, r.Principal.ID)
+		case SortByPermission:
+			key = append(key, r.Permission.ID)
+		case SortByResource:
+			key = append(key, r.Resource.ID)
+		}
+	}
+	return append(key, r.ID())
 }
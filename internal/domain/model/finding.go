@@ -0,0 +1,77 @@
+package model
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Low
+	Medium
+	High
+	Critical
+)
+
+var severityNames = []string{"info", "low", "medium", "high", "critical"}
+
+func ParseSeverity(s string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, s) {
+			return Severity(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %v", s)
+}
+
+func (s Severity) String() string {
+	if s < Info || s > Critical {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) (err error) {
+	*s, err = ParseSeverity(string(text))
+	return err
+}
+
+// Location points at the policy document, and optionally the statement within
+// it, responsible for a finding.
+type Location struct {
+	ARN            string
+	StatementIndex *int
+}
+
+// CheckInfo describes an audit check in reports.
+type CheckInfo struct {
+	ID          string
+	Description string
+	Severity    Severity
+}
+
+type Finding struct {
+	CheckID   string
+	Severity  Severity
+	Principal Principal
+	Location  Location
+	Message   string
+}
+
+// Fingerprint identifies a finding across runs so it can be suppressed or
+// tracked in a baseline.
+func (f *Finding) Fingerprint() string {
+	statement := ""
+	if f.Location.StatementIndex != nil {
+		statement = fmt.Sprint(*f.Location.StatementIndex)
+	}
+	id := fmt.Sprintf("%v:%v:%v:%v", f.CheckID, f.Principal.ID, f.Location.ARN, statement)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(id)))
+}
@@ -1,6 +1,9 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type GrantIface interface {
 	String() string
@@ -40,3 +43,45 @@ func NewPolicyGrant(id string) PolicyGrant {
 func (rg Grant) String() string {
 	return fmt.Sprintf("%v:%v", rg.Type, rg.ID)
 }
+
+type PermissionGrant struct {
+	Grant
+}
+
+func NewPermissionGrant(permission string, resource string) PermissionGrant {
+	return PermissionGrant{
+		Grant{
+			Type: "Permission",
+			ID:   fmt.Sprintf("%v on %v", permission, resource),
+		},
+	}
+}
+
+// Grant types tell how the policy granting a rule is attached.
+const (
+	ManagedPolicy  = "managed"
+	InlinePolicy   = "inline"
+	ResourcePolicy = "resource"
+	SCP            = "scp"
+)
+
+// PolicyType tells the grant type of a policy from its ARN. Inline policies are
+// identified by the ARN of the identity embedding them, and resource policies
+// by the ARN of the resource.
+func PolicyType(arn string) string {
+	// arn:partition:service:region:account:resource
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return InlinePolicy
+	}
+	switch {
+	case parts[2] == "organizations":
+		return SCP
+	case parts[2] == "iam" && strings.HasPrefix(parts[5], "policy/"):
+		return ManagedPolicy
+	case parts[2] == "iam":
+		return InlinePolicy
+	default:
+		return ResourcePolicy
+	}
+}
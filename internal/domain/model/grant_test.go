@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyType(t *testing.T) {
+	tests := []struct {
+		arn  string
+		want string
+	}{
+		{"arn:aws:iam::aws:policy/AdministratorAccess", ManagedPolicy},
+		{"arn:aws:iam::111122223333:policy/path/TestPolicy", ManagedPolicy},
+		{"arn:aws:iam::111122223333:role/TestRole", InlinePolicy},
+		{"TestInlinePolicy", InlinePolicy},
+		{"arn:aws:organizations::111122223333:policy/o-exampleorgid/service_control_policy/p-examplepolicyid", SCP},
+		{"arn:aws:s3:::bucket", ResourcePolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			require.Equal(t, tt.want, PolicyType(tt.arn))
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package model
+
+// Policy is a managed policy as of its default version.
+type Policy struct {
+	ARN      string
+	Name     string
+	Version  string
+	Document string
+}
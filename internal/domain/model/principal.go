@@ -1,5 +1,39 @@
 package model
 
+import (
+	"regexp"
+	"strings"
+)
+
+var accountID = regexp.MustCompile(`^\d{12}$`)
+
 type Principal struct {
 	ID string
 }
+
+// Split breaks a principal such as AWS[arn:aws:iam::111122223333:root] into
+// its type and identifier.
+func (p Principal) Split() (string, string) {
+	i := strings.Index(p.ID, "[")
+	if i < 0 || !strings.HasSuffix(p.ID, "]") {
+		return "", p.ID
+	}
+	return p.ID[:i], p.ID[i+1 : len(p.ID)-1]
+}
+
+func (p Principal) Account() string {
+	_, id := p.Split()
+	if accountID.MatchString(id) {
+		return id
+	}
+	return ARNAccount(id)
+}
+
+func ARNAccount(arn string) string {
+	// arn:partition:service:region:account:resource
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
@@ -1,5 +1,6 @@
 package model
 
 type Resource struct {
-	ID string
+	ID   string
+	Type string
 }
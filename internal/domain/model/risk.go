@@ -0,0 +1,71 @@
+package model
+
+// MaxRiskScore caps the sum of the risk factor points of a principal.
+const MaxRiskScore = 100
+
+// RiskFactor is a trait of the access of a principal that adds Points to its
+// risk score.
+type RiskFactor struct {
+	ID          string
+	Description string
+	Points      int
+}
+
+// Risk factors a principal is scored on.
+var (
+	RiskWildcardAction = RiskFactor{
+		ID:          "wildcard-action",
+		Description: "allowed actions given with a wildcard",
+		Points:      10,
+	}
+	RiskWildcardResource = RiskFactor{
+		ID:          "wildcard-resource",
+		Description: "allowed actions on every resource",
+		Points:      5,
+	}
+	RiskWriteAccess = RiskFactor{
+		ID:          "write-access",
+		Description: "allowed write actions",
+		Points:      5,
+	}
+	RiskPermissionsManagement = RiskFactor{
+		ID:          "permissions-management",
+		Description: "allowed permissions management actions",
+		Points:      15,
+	}
+	RiskEscalation = RiskFactor{
+		ID:          "privilege-escalation",
+		Description: "can obtain broader access than it holds",
+		Points:      25,
+	}
+	RiskCrossAccount = RiskFactor{
+		ID:          "cross-account",
+		Description: "reaches roles of another account",
+		Points:      15,
+	}
+	RiskPublic = RiskFactor{
+		ID:          "public",
+		Description: "any principal of its type is allowed",
+		Points:      30,
+	}
+	RiskNoMFA = RiskFactor{
+		ID:          "no-mfa",
+		Description: "allowed write or permissions management actions without an MFA condition",
+		Points:      10,
+	}
+)
+
+// RiskContribution is a risk factor found for a principal, with the number of
+// rules, or escalation paths, it was found in.
+type RiskContribution struct {
+	Factor RiskFactor
+	Count  int
+}
+
+// RiskScore is the sum of the points of the factors found for a principal,
+// capped at MaxRiskScore.
+type RiskScore struct {
+	Principal Principal
+	Score     int
+	Factors   []RiskContribution
+}
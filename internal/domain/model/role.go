@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+type Role struct {
+	ARN        string
+	Name       string
+	CreateDate time.Time
+	LastUsed   *time.Time
+	Trust      []TrustStatement
+	// Policies are the ARNs of the managed policies attached to the role, nil
+	// when the role was cached before they were recorded
+	Policies []string
+}
+
+type TrustStatement struct {
+	Principal      Principal
+	Conditions     []Condition
+	StatementIndex int
+}
+
+func (r *Role) Account() string {
+	return ARNAccount(r.ARN)
+}
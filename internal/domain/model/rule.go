@@ -3,6 +3,7 @@ package model
 import (
 	"crypto/sha1"
 	"fmt"
+	"strings"
 )
 
 type AccessControlRule struct {
@@ -10,9 +11,23 @@ type AccessControlRule struct {
 	Permission Permission
 	Resource   Resource
 	GrantChain []GrantIface
+	// StatementIndex locates the statement granting the rule in the last
+	// policy of the grant chain
+	StatementIndex int
+	// Effect and Conditions are the ones of that statement
+	Effect     string
+	Conditions []Condition
 }
 
+// Denies tells whether the rule comes from a Deny statement.
+func (a *AccessControlRule) Denies() bool {
+	return strings.EqualFold(a.Effect, "Deny")
+}
+
+// ID identifies a rule by who is allowed or denied what on which resource
+// through which grant chain and statement, so the same access granted by two
+// policies, or allowed and denied, makes two rules.
 func (a *AccessControlRule) ID() string {
-	id := fmt.Sprintf("%v:%v:%v", a.Principal, a.Resource, a.GrantChain[0])
+	id := fmt.Sprintf("%v:%v:%v:%v:%v:%v", a.Principal, a.Permission, a.Resource, a.GrantChain, a.StatementIndex, a.Effect)
 	return fmt.Sprintf("%x", sha1.Sum([]byte(id)))
 }
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// Access is an action allowed on a resource. Condition is the formatted
+// conditions it is allowed under, empty when it is allowed unconditionally.
+type Access struct {
+	Action    string
+	Resource  string
+	Condition string
+}
+
+// SuggestedStatement allows each of its actions on each of its resources
+// when all of its conditions hold.
+type SuggestedStatement struct {
+	Actions    []string
+	Resources  []string
+	Conditions []Condition
+}
+
+// Change operations of a policy diff.
+const (
+	AccessKept    = " "
+	AccessRemoved = "-"
+	AccessAdded   = "+"
+)
+
+// AccessChange is a line of the diff between the current permissions of a
+// principal and a suggested policy. Policy is the current policy granting
+// the access, empty for added access.
+type AccessChange struct {
+	Op     string
+	Access Access
+	Policy string
+}
+
+// PolicySuggestion is the least privilege policy covering the usage of a
+// principal recorded since a given time.
+type PolicySuggestion struct {
+	Principal  string
+	Since      time.Time
+	Statements []SuggestedStatement
+	Diff       []AccessChange
+}
@@ -0,0 +1,14 @@
+package model
+
+// Summary gathers the aggregates reported by `iamsnitch report summary`.
+type Summary struct {
+	// ActionsPerPrincipal counts the distinct actions granted to each principal
+	ActionsPerPrincipal []Group
+	// WritersPerPrincipal counts the distinct write and permissions
+	// management actions granted to each principal
+	WritersPerPrincipal []Group
+	// PrincipalsPerPolicy counts the principals each policy grants rules to
+	PrincipalsPerPolicy []Group
+	// ServicesPerPrincipal lists the services each principal can act on
+	ServicesPerPrincipal []Group
+}
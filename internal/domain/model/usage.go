@@ -0,0 +1,77 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+// Usage records the last time an identity performed an action on a resource,
+// as logged by CloudTrail. Identity is the ARN of the user or role acting, or
+// the host name of an AWS service. Resource is empty when the event doesn't
+// name the resources it acted on.
+type Usage struct {
+	Identity string
+	Action   string
+	Resource string
+	LastUsed time.Time
+}
+
+// MergeUsage keeps the latest usage of each identity, action and resource.
+func MergeUsage(usage []Usage) []Usage {
+	type key struct{ identity, action, resource string }
+	latest := make(map[key]int, len(usage))
+	merged := make([]Usage, 0, len(usage))
+	for _, u := range usage {
+		k := key{u.Identity, u.Action, u.Resource}
+		if i, ok := latest[k]; ok {
+			if u.LastUsed.After(merged[i].LastUsed) {
+				merged[i].LastUsed = u.LastUsed
+			}
+			continue
+		}
+		latest[k] = len(merged)
+		merged = append(merged, u)
+	}
+	return merged
+}
+
+// Identity is the user or role a rule lets act: the last role of its grant
+// chain, or the principal itself when no role is assumed.
+func (a *AccessControlRule) Identity() string {
+	for i := len(a.GrantChain) - 1; i >= 0; i-- {
+		if rg, ok := a.GrantChain[i].(RoleGrant); ok {
+			return rg.ID
+		}
+	}
+	_, id := a.Principal.Split()
+	return id
+}
+
+// ServiceLevel tells whether the usage only names the service acted on, as
+// Access Advisor reports the services whose actions it doesn't track.
+func (u *Usage) ServiceLevel() bool {
+	return strings.HasSuffix(u.Action, ":*") && !strings.Contains(strings.TrimSuffix(u.Action, ":*"), "*")
+}
+
+// Exercises reports whether the usage is one the rule allows, i.e. the rule
+// covers its action and resource. Actions are compared regardless of case like
+// IAM does, and a usage without resource is taken to exercise the rule
+// whatever its resource, so a rule is never reported unused for lack of detail
+// in the logs. For the same reason usage of a whole service, as Access Advisor
+// reports it, exercises every rule of the service.
+func (u *Usage) Exercises(r *AccessControlRule) bool {
+	if u.Identity != r.Identity() {
+		return false
+	}
+	if u.ServiceLevel() {
+		service := strings.ToLower(strings.TrimSuffix(u.Action, ":*"))
+		if !wildcard.Covers(strings.ToLower(ServiceOf(r.Permission.ID)), service) {
+			return false
+		}
+	} else if !wildcard.Covers(strings.ToLower(r.Permission.ID), strings.ToLower(u.Action)) {
+		return false
+	}
+	return u.Resource == "" || wildcard.Covers(r.Resource.ID, u.Resource)
+}
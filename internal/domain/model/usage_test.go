@@ -0,0 +1,76 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageExercises(t *testing.T) {
+	role := "arn:aws:iam::111122223333:role/Dev"
+	rule := &AccessControlRule{
+		Principal:  Principal{ID: "AWS[arn:aws:iam::111122223333:root]"},
+		Permission: Permission{ID: "s3:Get*"},
+		Resource:   Resource{ID: "arn:aws:s3:::bucket/*"},
+		GrantChain: []GrantIface{
+			NewRoleGrant(role),
+			NewPolicyGrant("arn:aws:iam::111122223333:policy/Read"),
+		},
+	}
+
+	tests := []struct {
+		name  string
+		usage Usage
+		want  bool
+	}{
+		{"same action and resource", Usage{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key"}, true},
+		{"action of another case", Usage{Identity: role, Action: "S3:getobject", Resource: "arn:aws:s3:::bucket/key"}, true},
+		{"unknown resource", Usage{Identity: role, Action: "s3:GetObject"}, true},
+		{"another action", Usage{Identity: role, Action: "s3:PutObject", Resource: "arn:aws:s3:::bucket/key"}, false},
+		{"another resource", Usage{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::other/key"}, false},
+		{"whole service", Usage{Identity: role, Action: "s3:*"}, true},
+		{"whole service of another case", Usage{Identity: role, Action: "S3:*"}, true},
+		{"whole other service", Usage{Identity: role, Action: "ec2:*"}, false},
+		{"broader resource", Usage{Identity: role, Action: "s3:GetObject", Resource: "arn:aws:s3:::*"}, false},
+		{"overlapping action", Usage{Identity: role, Action: "s3:*Object", Resource: "arn:aws:s3:::bucket/key"}, false},
+		{"another identity", Usage{Identity: "arn:aws:iam::111122223333:role/Ops", Action: "s3:GetObject"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.usage.Exercises(rule))
+		})
+	}
+}
+
+func TestUsageServiceLevel(t *testing.T) {
+	require.True(t, (&Usage{Action: "s3:*"}).ServiceLevel())
+	require.False(t, (&Usage{Action: "s3:GetObject"}).ServiceLevel())
+	require.False(t, (&Usage{Action: "s3:Get*"}).ServiceLevel())
+	require.False(t, (&Usage{Action: "*"}).ServiceLevel())
+}
+
+func TestRuleIdentity(t *testing.T) {
+	rule := AccessControlRule{Principal: Principal{ID: "AWS[arn:aws:iam::111122223333:user/alice]"}}
+	require.Equal(t, "arn:aws:iam::111122223333:user/alice", rule.Identity())
+
+	rule.GrantChain = []GrantIface{
+		NewRoleGrant("arn:aws:iam::111122223333:role/Hop"),
+		NewRoleGrant("arn:aws:iam::111122223333:role/Dev"),
+		NewPolicyGrant("arn:aws:iam::111122223333:policy/Read"),
+	}
+	require.Equal(t, "arn:aws:iam::111122223333:role/Dev", rule.Identity())
+}
+
+func TestMergeUsage(t *testing.T) {
+	day := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, []Usage{
+		{Identity: "a", Action: "s3:GetObject", LastUsed: day},
+		{Identity: "a", Action: "s3:GetObject", Resource: "r", LastUsed: day.Add(-time.Hour)},
+	}, MergeUsage([]Usage{
+		{Identity: "a", Action: "s3:GetObject", LastUsed: day.Add(-time.Hour)},
+		{Identity: "a", Action: "s3:GetObject", Resource: "r", LastUsed: day.Add(-time.Hour)},
+		{Identity: "a", Action: "s3:GetObject", LastUsed: day},
+		{Identity: "a", Action: "s3:GetObject", LastUsed: day.Add(-2 * time.Hour)},
+	}))
+}
@@ -0,0 +1,10 @@
+package model
+
+// RuleChange is a rule a proposed change to the policies of a role grants,
+// AccessAdded, or takes away, AccessRemoved. Policy is the policy granting
+// the rule.
+type RuleChange struct {
+	Op     string
+	Rule   AccessControlRule
+	Policy string
+}
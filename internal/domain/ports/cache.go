@@ -1,9 +1,35 @@
 package ports
 
-import "github.com/jeandreh/iam-snitch/internal/domain/model"
+import (
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
 
 //go:generate mockgen -destination=../../mocks/mock_cache.go -package=mocks -mock_names CacheIface=CacheMock . CacheIface
 type CacheIface interface {
 	SaveACL(rules []model.AccessControlRule) error
+	// PruneACL deletes the rules granted through via, whatever their effect,
+	// that weren't saved since before
+	PruneACL(via *model.Via, before time.Time) error
 	Find(filter *model.Filter) ([]model.AccessControlRule, error)
+	// FindEach calls fn on each rule Find would return, stopping at the first
+	// error, without holding them all in memory.
+	FindEach(filter *model.Filter, fn func(model.AccessControlRule) error) error
+	// Aggregate groups the rules matching the filter, ignoring its page
+	Aggregate(filter *model.Filter, agg *model.Aggregation) ([]model.Group, error)
+	SaveResources(resources []model.Resource) error
+	FindResources(filter *model.Filter) ([]model.Resource, error)
+	SaveRoles(roles []model.Role) error
+	// PruneRoles deletes the roles matching any of the ARN patterns that
+	// weren't saved since before
+	PruneRoles(roles []string, before time.Time) error
+	FindRoles() ([]model.Role, error)
+	SavePolicies(policies []model.Policy) error
+	FindPolicies() ([]model.Policy, error)
+	// SaveUsage records usage, keeping the latest time of each identity,
+	// action and resource
+	SaveUsage(usage []model.Usage) error
+	// FindUsage returns the usage recorded at or after since
+	FindUsage(since time.Time) ([]model.Usage, error)
 }
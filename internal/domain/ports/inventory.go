@@ -0,0 +1,8 @@
+package ports
+
+import "github.com/jeandreh/iam-snitch/internal/domain/model"
+
+//go:generate mockgen -destination=../../mocks/mock_inventory.go -package=mocks -mock_names InventoryProviderIface=InventoryProviderMock . InventoryProviderIface
+type InventoryProviderIface interface {
+	FetchResources(page PageIface) ([]model.Resource, PageIface, error)
+}
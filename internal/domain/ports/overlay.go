@@ -0,0 +1,10 @@
+package ports
+
+import "github.com/jeandreh/iam-snitch/internal/domain/model"
+
+//go:generate mockgen -destination=../../mocks/mock_overlay.go -package=mocks -mock_names OverlayIface=OverlayMock . OverlayIface
+type OverlayIface interface {
+	// Rebuild returns the rules of the role once the change is applied, given
+	// its cached rules and the cached managed policies.
+	Rebuild(role *model.Role, current []model.AccessControlRule, policies []model.Policy) ([]model.AccessControlRule, error)
+}
@@ -5,6 +5,8 @@ import "github.com/jeandreh/iam-snitch/internal/domain/model"
 //go:generate mockgen -destination=../../mocks/mock_provider.go -package=mocks -mock_names IAMProviderIface=IAMProviderMock . IAMProviderIface
 type IAMProviderIface interface {
 	FetchACL(page PageIface) ([]model.AccessControlRule, PageIface, error)
+	FetchRoles(page PageIface) ([]model.Role, PageIface, error)
+	FetchPolicies(page PageIface) ([]model.Policy, PageIface, error)
 }
 
 //go:generate mockgen -destination=../../mocks/mock_page.go -package=mocks -mock_names PageIface=PageMock . PageIface
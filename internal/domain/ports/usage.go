@@ -0,0 +1,8 @@
+package ports
+
+import "github.com/jeandreh/iam-snitch/internal/domain/model"
+
+//go:generate mockgen -destination=../../mocks/mock_usage.go -package=mocks -mock_names UsageProviderIface=UsageProviderMock . UsageProviderIface
+type UsageProviderIface interface {
+	FetchUsage(page PageIface) ([]model.Usage, PageIface, error)
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const PermissionNode NodeType = "permission"
+
+var cypherLabels = map[NodeType]string{
+	PrincipalNode:  "Principal",
+	RoleNode:       "Role",
+	PolicyNode:     "Policy",
+	PermissionNode: "Permission",
+	ResourceNode:   "Resource",
+}
+
+// cypherNode and cypherRel are the graph as loaded into a graph database.
+// Actions become Permission nodes and every grants edge is split into one
+// GRANTS relationship per action, plus an ALLOWS relationship from the policy
+// to the permission.
+type cypherNode struct {
+	ID    string
+	Label string
+	Name  string
+}
+
+type cypherRel struct {
+	From   string
+	To     string
+	Type   string
+	Action string
+}
+
+// StableID identifies a node across exports, so re-importing updates the
+// existing nodes instead of duplicating them.
+func StableID(t NodeType, label string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%v:%v", t, label))))
+}
+
+func WriteCypher(w io.Writer, g *Graph) error {
+	nodes, rels := cypherGraph(g)
+
+	var b strings.Builder
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "MERGE (n:%v {id: %v}) SET n.name = %v;\n", n.Label, cypherQuote(n.ID), cypherQuote(n.Name))
+	}
+	for _, r := range rels {
+		props := ""
+		if r.Action != "" {
+			props = fmt.Sprintf(" {action: %v}", cypherQuote(r.Action))
+		}
+		fmt.Fprintf(&b, "MATCH (a {id: %v}), (b {id: %v}) MERGE (a)-[:%v%v]->(b);\n", cypherQuote(r.From), cypherQuote(r.To), r.Type, props)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteNeo4jCSV writes the node and relationship files expected by
+// `neo4j-admin database import`.
+func WriteNeo4jCSV(nodesW io.Writer, relsW io.Writer, g *Graph) error {
+	nodes, rels := cypherGraph(g)
+
+	nw := csv.NewWriter(nodesW)
+	nw.Write([]string{"id:ID", "name", ":LABEL"})
+	for _, n := range nodes {
+		nw.Write([]string{n.ID, n.Name, n.Label})
+	}
+	nw.Flush()
+	if err := nw.Error(); err != nil {
+		return err
+	}
+
+	rw := csv.NewWriter(relsW)
+	rw.Write([]string{":START_ID", ":END_ID", ":TYPE", "action"})
+	for _, r := range rels {
+		rw.Write([]string{r.From, r.To, r.Type, r.Action})
+	}
+	rw.Flush()
+	return rw.Error()
+}
+
+func cypherGraph(g *Graph) ([]cypherNode, []cypherRel) {
+	ids := make(map[string]string, len(g.Nodes))
+	nodes := make([]cypherNode, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids[n.ID] = StableID(n.Type, n.Label)
+		nodes = append(nodes, cypherNode{
+			ID:    ids[n.ID],
+			Label: cypherLabels[n.Type],
+			Name:  n.Label,
+		})
+	}
+
+	seen := make(map[string]bool)
+	var rels []cypherRel
+	for _, e := range g.Edges {
+		from, to := ids[e.From], ids[e.To]
+		if e.Label != GrantsEdge {
+			rels = append(rels, cypherRel{From: from, To: to, Type: strings.ToUpper(e.Label)})
+			continue
+		}
+		for _, a := range e.Actions {
+			pid := StableID(PermissionNode, a)
+			if !seen[pid] {
+				seen[pid] = true
+				nodes = append(nodes, cypherNode{ID: pid, Label: cypherLabels[PermissionNode], Name: a})
+			}
+			if !seen[from+pid] {
+				seen[from+pid] = true
+				rels = append(rels, cypherRel{From: from, To: pid, Type: "ALLOWS"})
+			}
+			rels = append(rels, cypherRel{From: from, To: to, Type: "GRANTS", Action: a})
+		}
+	}
+	return nodes, rels
+}
+
+func cypherQuote(s string) string {
+	return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + `'`
+}
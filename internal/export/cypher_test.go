@@ -0,0 +1,49 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCypher(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteCypher(&buf, NewGraph(testACL())))
+
+	alice := StableID(PrincipalNode, "AWS[arn:aws:iam::111122223333:user/alice]")
+	policy := StableID(PolicyNode, "arn:aws:iam::111122223333:policy/S3")
+	bucket := StableID(ResourceNode, "arn:aws:s3:::bucket")
+	get := StableID(PermissionNode, "s3:GetObject")
+
+	require.Contains(t, buf.String(), "MERGE (n:Principal {id: '"+alice+"'}) SET n.name = 'AWS[arn:aws:iam::111122223333:user/alice]';\n")
+	require.Contains(t, buf.String(), "MERGE (n:Permission {id: '"+get+"'}) SET n.name = 's3:GetObject';\n")
+	require.Contains(t, buf.String(), "MATCH (a {id: '"+policy+"'}), (b {id: '"+get+"'}) MERGE (a)-[:ALLOWS]->(b);\n")
+	require.Contains(t, buf.String(), "MATCH (a {id: '"+policy+"'}), (b {id: '"+bucket+"'}) MERGE (a)-[:GRANTS {action: 's3:GetObject'}]->(b);\n")
+
+	var again bytes.Buffer
+	require.Nil(t, WriteCypher(&again, NewGraph(testACL()[1:])))
+	require.Contains(t, again.String(), "MERGE (n:Resource {id: '"+bucket+"'})")
+}
+
+func TestWriteNeo4jCSV(t *testing.T) {
+	var nodes, rels bytes.Buffer
+	require.Nil(t, WriteNeo4jCSV(&nodes, &rels, NewGraph(testACL())))
+
+	nr, err := csv.NewReader(&nodes).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, []string{"id:ID", "name", ":LABEL"}, nr[0])
+	// 5 graph nodes plus 2 permissions
+	require.Len(t, nr, 8)
+
+	rr, err := csv.NewReader(&rels).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, []string{":START_ID", ":END_ID", ":TYPE", "action"}, rr[0])
+	// assumes x2, attached, allows x2, grants x2
+	require.Len(t, rr, 8)
+}
+
+func TestCypherQuote(t *testing.T) {
+	require.Equal(t, `'it\'s a \\ test'`, cypherQuote(`it's a \ test`))
+}
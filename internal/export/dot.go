@@ -0,0 +1,35 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+var dotShapes = map[NodeType]string{
+	PrincipalNode: "ellipse",
+	RoleNode:      "box",
+	PolicyNode:    "note",
+	ResourceNode:  "cylinder",
+}
+
+func WriteDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+
+	b.WriteString("digraph iamsnitch {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %v [label=%v, shape=%v, type=%v];\n", n.ID, dotQuote(n.Label), dotShapes[n.Type], n.Type)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %v -> %v [label=%v];\n", e.From, e.To, dotQuote(e.Text()))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,134 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+type NodeType string
+
+const (
+	PrincipalNode NodeType = "principal"
+	RoleNode      NodeType = "role"
+	PolicyNode    NodeType = "policy"
+	ResourceNode  NodeType = "resource"
+)
+
+const (
+	AssumesEdge  = "assumes"
+	AttachedEdge = "attached"
+	GrantsEdge   = "grants"
+)
+
+type Node struct {
+	ID    string
+	Type  NodeType
+	Label string
+}
+
+// Edge links two nodes. Grants edges carry the actions allowed by the policy
+// on the resource.
+type Edge struct {
+	From    string
+	To      string
+	Label   string
+	Actions []string
+}
+
+// Graph is the principal -> role -> policy -> resource view of a list of
+// rules. Nodes and edges keep the order in which they were first seen.
+type Graph struct {
+	Nodes []Node
+	Edges []Edge
+	nodes map[string]int
+	edges map[string]int
+}
+
+func NewGraph(acl []model.AccessControlRule) *Graph {
+	g := &Graph{
+		nodes: make(map[string]int),
+		edges: make(map[string]int),
+	}
+	for _, r := range acl {
+		g.addRule(&r)
+	}
+	for i := range g.Edges {
+		sort.Strings(g.Edges[i].Actions)
+	}
+	return g
+}
+
+func (g *Graph) addRule(r *model.AccessControlRule) {
+	prev := g.addNode(PrincipalNode, r.Principal.ID)
+	for _, gr := range r.GrantChain {
+		switch v := gr.(type) {
+		case model.RoleGrant:
+			next := g.addNode(RoleNode, v.ID)
+			g.addEdge(prev, next, AssumesEdge, "")
+			prev = next
+		case model.PolicyGrant:
+			next := g.addNode(PolicyNode, v.ID)
+			g.addEdge(prev, next, AttachedEdge, "")
+			prev = next
+		}
+	}
+	g.addEdge(prev, g.addNode(ResourceNode, r.Resource.ID), GrantsEdge, r.Permission.ID)
+}
+
+func (g *Graph) addNode(t NodeType, label string) string {
+	key := fmt.Sprintf("%v:%v", t, label)
+	if i, ok := g.nodes[key]; ok {
+		return g.Nodes[i].ID
+	}
+	id := fmt.Sprintf("n%d", len(g.Nodes))
+	g.nodes[key] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, Node{ID: id, Type: t, Label: label})
+	return id
+}
+
+func (g *Graph) addEdge(from string, to string, label string, action string) {
+	key := fmt.Sprintf("%v:%v:%v", from, to, label)
+	i, ok := g.edges[key]
+	if !ok {
+		i = len(g.Edges)
+		g.edges[key] = i
+		g.Edges = append(g.Edges, Edge{From: from, To: to, Label: label})
+	}
+	if action == "" {
+		return
+	}
+	for _, a := range g.Edges[i].Actions {
+		if a == action {
+			return
+		}
+	}
+	g.Edges[i].Actions = append(g.Edges[i].Actions, action)
+}
+
+// Text renders the edge label including the granted actions, if any.
+func (e *Edge) Text() string {
+	if len(e.Actions) == 0 {
+		return e.Label
+	}
+	return fmt.Sprintf("%v %v", e.Label, strings.Join(e.Actions, ", "))
+}
+
+// Write renders the graph in one of the supported formats: dot, mermaid,
+// graphml or cypher.
+func Write(w io.Writer, format string, g *Graph) error {
+	switch format {
+	case "dot":
+		return WriteDOT(w, g)
+	case "mermaid":
+		return WriteMermaid(w, g)
+	case "graphml":
+		return WriteGraphML(w, g)
+	case "cypher":
+		return WriteCypher(w, g)
+	}
+	return fmt.Errorf("unknown graph format %v", format)
+}
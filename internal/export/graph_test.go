@@ -0,0 +1,100 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGraph(t *testing.T) {
+	g := NewGraph(testACL())
+
+	require.Equal(t, []Node{
+		{ID: "n0", Type: PrincipalNode, Label: "AWS[arn:aws:iam::111122223333:user/alice]"},
+		{ID: "n1", Type: RoleNode, Label: "arn:aws:iam::111122223333:role/Dev"},
+		{ID: "n2", Type: PolicyNode, Label: "arn:aws:iam::111122223333:policy/S3"},
+		{ID: "n3", Type: ResourceNode, Label: "arn:aws:s3:::bucket"},
+		{ID: "n4", Type: PrincipalNode, Label: "Service[ec2.amazonaws.com]"},
+	}, g.Nodes)
+	require.Equal(t, []Edge{
+		{From: "n0", To: "n1", Label: AssumesEdge},
+		{From: "n1", To: "n2", Label: AttachedEdge},
+		{From: "n2", To: "n3", Label: GrantsEdge, Actions: []string{"s3:GetObject", "s3:PutObject"}},
+		{From: "n4", To: "n1", Label: AssumesEdge},
+	}, g.Edges)
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			"dot",
+			[]string{
+				`n0 [label="AWS[arn:aws:iam::111122223333:user/alice]", shape=ellipse, type=principal];`,
+				`n2 -> n3 [label="grants s3:GetObject, s3:PutObject"];`,
+			},
+		},
+		{
+			"mermaid",
+			[]string{
+				"flowchart LR",
+				`n3[("arn:aws:s3:::bucket")]`,
+				`n0 -->|"assumes"| n1`,
+				"class n0,n4 principal",
+			},
+		},
+		{
+			"graphml",
+			[]string{
+				`<edge source="n2" target="n3">`,
+				`<data key="actions">s3:GetObject, s3:PutObject</data>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.Nil(t, Write(&buf, tt.format, NewGraph(testACL())))
+			for _, w := range tt.want {
+				require.Contains(t, buf.String(), w)
+			}
+		})
+	}
+
+	require.Error(t, Write(&bytes.Buffer{}, "png", NewGraph(nil)))
+}
+
+func TestWriteGraphMLIsValid(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteGraphML(&buf, NewGraph(testACL())))
+
+	var doc graphML
+	require.Nil(t, xml.Unmarshal(buf.Bytes(), &doc))
+	require.Len(t, doc.Graph.Nodes, 5)
+	require.Len(t, doc.Graph.Edges, 4)
+}
+
+func testACL() []model.AccessControlRule {
+	chain := []model.GrantIface{
+		model.NewRoleGrant("arn:aws:iam::111122223333:role/Dev"),
+		model.NewPolicyGrant("arn:aws:iam::111122223333:policy/S3"),
+	}
+	rule := func(principal string, permission string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: principal},
+			Permission: model.Permission{ID: permission},
+			Resource:   model.Resource{ID: "arn:aws:s3:::bucket"},
+			GrantChain: chain,
+		}
+	}
+	return []model.AccessControlRule{
+		rule("AWS[arn:aws:iam::111122223333:user/alice]", "s3:PutObject"),
+		rule("AWS[arn:aws:iam::111122223333:user/alice]", "s3:GetObject"),
+		rule("Service[ec2.amazonaws.com]", "s3:GetObject"),
+	}
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+var mermaidShapes = map[NodeType][2]string{
+	PrincipalNode: {"([", "])"},
+	RoleNode:      {"[", "]"},
+	PolicyNode:    {"[/", "/]"},
+	ResourceNode:  {"[(", ")]"},
+}
+
+func WriteMermaid(w io.Writer, g *Graph) error {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		shape := mermaidShapes[n.Type]
+		fmt.Fprintf(&b, "  %v%v%v%v\n", n.ID, shape[0], mermaidQuote(n.Label), shape[1])
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %v -->|%v| %v\n", e.From, mermaidQuote(e.Text()), e.To)
+	}
+	for _, t := range []NodeType{PrincipalNode, RoleNode, PolicyNode, ResourceNode} {
+		var ids []string
+		for _, n := range g.Nodes {
+			if n.Type == t {
+				ids = append(ids, n.ID)
+			}
+		}
+		if len(ids) > 0 {
+			fmt.Fprintf(&b, "  class %v %v\n", strings.Join(ids, ","), t)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
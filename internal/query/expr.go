@@ -0,0 +1,149 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/wildcard"
+)
+
+// Expr is a node of the expression tree.
+type Expr interface {
+	Match(r *model.AccessControlRule) bool
+	String() string
+}
+
+type And struct {
+	Left, Right Expr
+}
+
+type Or struct {
+	Left, Right Expr
+}
+
+type Not struct {
+	Expr Expr
+}
+
+// Compare holds when any value of the field compares to Value, or for !=, when
+// none is equal to it.
+type Compare struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// Presence holds when the field has a value, or when it hasn't and Present is
+// false.
+type Presence struct {
+	Field   string
+	Present bool
+}
+
+func (e *And) Match(r *model.AccessControlRule) bool {
+	return e.Left.Match(r) && e.Right.Match(r)
+}
+
+func (e *And) String() string {
+	return fmt.Sprintf("(%v and %v)", e.Left, e.Right)
+}
+
+func (e *Or) Match(r *model.AccessControlRule) bool {
+	return e.Left.Match(r) || e.Right.Match(r)
+}
+
+func (e *Or) String() string {
+	return fmt.Sprintf("(%v or %v)", e.Left, e.Right)
+}
+
+func (e *Not) Match(r *model.AccessControlRule) bool {
+	return !e.Expr.Match(r)
+}
+
+func (e *Not) String() string {
+	return fmt.Sprintf("not %v", e.Expr)
+}
+
+func (e *Compare) Match(r *model.AccessControlRule) bool {
+	values := fieldValues(e.Field, r)
+	if e.Op == OpNotEqual {
+		return !contains(values, e.Value)
+	}
+	if e.Op == OpEqual {
+		return contains(values, e.Value)
+	}
+	for _, v := range values {
+		if wildcard.Match(v, e.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Compare) String() string {
+	return fmt.Sprintf("%v %v %v", e.Field, e.Op, strconv.Quote(e.Value))
+}
+
+func (e *Presence) Match(r *model.AccessControlRule) bool {
+	return (len(fieldValues(e.Field, r)) > 0) == e.Present
+}
+
+func (e *Presence) String() string {
+	if e.Present {
+		return fmt.Sprintf("%v present", e.Field)
+	}
+	return fmt.Sprintf("%v missing", e.Field)
+}
+
+// fieldValues lists the values of a rule field. Policies and roles are the
+// ones in the grant chain, the type is the one of its last policy and
+// conditions are identified by their keys.
+func fieldValues(field string, r *model.AccessControlRule) []string {
+	switch field {
+	case FieldAction:
+		return []string{r.Permission.ID}
+	case FieldResource:
+		return []string{r.Resource.ID}
+	case FieldPrincipal:
+		return []string{r.Principal.ID}
+	case FieldPolicy, FieldRole, FieldType:
+		var policies, roles []string
+		for _, g := range r.GrantChain {
+			switch v := g.(type) {
+			case model.PolicyGrant:
+				policies = append(policies, v.ID)
+			case model.RoleGrant:
+				roles = append(roles, v.ID)
+			}
+		}
+		switch {
+		case field == FieldPolicy:
+			return policies
+		case field == FieldRole:
+			return roles
+		case len(policies) > 0:
+			return []string{model.PolicyType(policies[len(policies)-1])}
+		}
+	case FieldEffect:
+		if r.Effect != "" {
+			return []string{r.Effect}
+		}
+	case FieldCondition:
+		keys := make([]string, 0, len(r.Conditions))
+		for _, c := range r.Conditions {
+			keys = append(keys, c.Key)
+		}
+		return keys
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	// pos is the 1-based column the token starts at
+	pos int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+// keyword tells whether the token is the bare word kw, ignoring case. Quoted
+// strings are never keywords.
+func (t token) keyword(kw string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.value, kw)
+}
+
+// lex splits the query into words, quoted strings, operators and parentheses.
+// Words run until a space, a parenthesis, a quote or an operator.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i + 1})
+			i++
+		case c == '~' || c == '=':
+			tokens = append(tokens, token{tokenOp, string(c), i + 1})
+			i++
+		case c == '!':
+			if i+1 >= len(s) || s[i+1] != '=' {
+				return nil, &Error{Pos: i + 1, Msg: "expected !="}
+			}
+			tokens = append(tokens, token{tokenOp, "!=", i + 1})
+			i += 2
+		case c == '"':
+			value, n, err := lexString(s[i:])
+			if err != nil {
+				return nil, &Error{Pos: i + 1, Msg: err.Error()}
+			}
+			tokens = append(tokens, token{tokenString, value, i + 1})
+			i += n
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r()~=!\"", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, s[start:i], start + 1})
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(s) + 1}), nil
+}
+
+// lexString reads the quoted string s starts with, returning its value and the
+// number of bytes read. Only \" and \\ are escapes, so ARNs and wildcards
+// don't need any.
+func lexString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,231 @@
+// Package query implements the expression language of `iamsnitch query`:
+//
+//	action ~ "s3:*" and resource ~ "arn:aws:s3:::prod-*"
+//		and not principal ~ "Service[*]" and effect = Allow and condition missing
+//
+// Comparisons are combined with and, or, not and parentheses, and is binding
+// tighter than or. Values are bare words or double quoted strings.
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+// Fields a comparison can be made on. permission is a synonym of action.
+const (
+	FieldAction    = "action"
+	FieldResource  = "resource"
+	FieldPrincipal = "principal"
+	FieldPolicy    = "policy"
+	FieldRole      = "role"
+	FieldType      = "type"
+	FieldEffect    = "effect"
+	FieldCondition = "condition"
+)
+
+// Comparison operators: ~ matches * as a wildcard, = and != compare exactly.
+const (
+	OpMatch    = "~"
+	OpEqual    = "="
+	OpNotEqual = "!="
+)
+
+var fieldAliases = map[string]string{
+	FieldAction:    FieldAction,
+	"permission":   FieldAction,
+	FieldResource:  FieldResource,
+	FieldPrincipal: FieldPrincipal,
+	FieldPolicy:    FieldPolicy,
+	FieldRole:      FieldRole,
+	FieldType:      FieldType,
+	FieldEffect:    FieldEffect,
+	FieldCondition: FieldCondition,
+}
+
+// Error is a syntax error at the 1-based column Pos of the query.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v at position %d", e.Msg, e.Pos)
+}
+
+// Query is a parsed expression.
+type Query struct {
+	Expr Expr
+}
+
+// Parse parses the expression s.
+func Parse(s string) (*Query, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %v", t)}
+	}
+	return &Query{Expr: expr}, nil
+}
+
+// Match tells whether the rule satisfies the query.
+func (q *Query) Match(r *model.AccessControlRule) bool {
+	return q.Expr.Match(r)
+}
+
+// Filter returns a cache filter selecting every rule the query could match, so
+// that Match only needs to run over those. Only the comparisons every match
+// must satisfy are pushed down, which is the ones joined by and at the top of
+// the expression.
+func (q *Query) Filter() *model.Filter {
+	filter := &model.Filter{}
+	for _, e := range conjuncts(q.Expr) {
+		c, ok := e.(*Compare)
+		if !ok || c.Op == OpNotEqual {
+			continue
+		}
+		// = is pushed down as a wildcard match too, which only widens the
+		// candidates when the value has a *
+		switch c.Field {
+		case FieldAction:
+			filter.Permissions = append(filter.Permissions, c.Value)
+		case FieldResource:
+			filter.Resources = append(filter.Resources, c.Value)
+		case FieldPrincipal:
+			filter.Principals = append(filter.Principals, c.Value)
+		case FieldPolicy:
+			filter.Via.Policies = append(filter.Via.Policies, c.Value)
+		case FieldRole:
+			filter.Via.Roles = append(filter.Via.Roles, c.Value)
+		case FieldType:
+			if c.Op == OpEqual {
+				filter.Via.Types = append(filter.Via.Types, c.Value)
+			}
+		}
+	}
+	return filter
+}
+
+func (q *Query) String() string {
+	return q.Expr.String()
+}
+
+func conjuncts(e Expr) []Expr {
+	if a, ok := e.(*And); ok {
+		return append(conjuncts(a.Left), conjuncts(a.Right)...)
+	}
+	return []Expr{e}
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// parseOr parses `and ("or" and)*`.
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("or") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses `unary ("and" unary)*`.
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("and") {
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses `"not" unary | "(" or ")" | comparison`.
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.keyword("not"):
+		p.advance()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: e}, nil
+	case t.kind == tokenLParen:
+		p.advance()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.advance(); t.kind != tokenRParen {
+			return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected ) but found %v", t)}
+		}
+		return e, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses `field op value | field ("missing" | "present")`.
+func (p *parser) parseComparison() (Expr, error) {
+	t := p.advance()
+	if t.kind != tokenWord {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected a field but found %v", t)}
+	}
+	field, ok := fieldAliases[strings.ToLower(t.value)]
+	if !ok {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unknown field %v", t)}
+	}
+
+	t = p.advance()
+	switch {
+	case t.keyword("missing"), t.keyword("present"):
+		return &Presence{Field: field, Present: t.keyword("present")}, nil
+	case t.kind != tokenOp:
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected ~, =, !=, missing or present after %v but found %v", field, t)}
+	}
+	op := t.value
+
+	t = p.advance()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected a value after %v but found %v", op, t)}
+	}
+	return &Compare{Field: field, Op: op, Value: t.value}, nil
+}
@@ -0,0 +1,129 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{
+			"precedence",
+			`action ~ "s3:*" and resource ~ arn:aws:s3:::prod-* or not principal ~ "Service[*]"`,
+			`((action ~ "s3:*" and resource ~ "arn:aws:s3:::prod-*") or not principal ~ "Service[*]")`,
+			"",
+		},
+		{
+			"parentheses",
+			`effect = Allow AND (condition missing OR permission != "s3:GetObject")`,
+			`(effect = "Allow" and (condition missing or action != "s3:GetObject"))`,
+			"",
+		},
+		{
+			"escaped quotes",
+			`principal = "AWS[\"x\"]" and type = inline and role present`,
+			`((principal = "AWS[\"x\"]" and type = "inline") and role present)`,
+			"",
+		},
+		{"unknown field", `actions ~ "s3:*"`, "", `unknown field "actions" at position 1`},
+		{"missing value", `action ~`, "", `expected a value after ~ but found end of query at position 9`},
+		{"missing operator", `action "s3:*"`, "", `expected ~, =, !=, missing or present after action but found "s3:*" at position 8`},
+		{"unbalanced", `(action ~ "s3:*"`, "", `expected ) but found end of query at position 17`},
+		{"trailing", `action ~ "s3:*" resource ~ "*"`, "", `unexpected "resource" at position 17`},
+		{"unterminated", `action ~ "s3:*`, "", `unterminated string at position 10`},
+		{"bang", `action ! "s3:*"`, "", `expected != at position 8`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, q.String())
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rule := model.AccessControlRule{
+		Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Dev]"},
+		Permission: model.Permission{ID: "s3:GetObject"},
+		Resource:   model.Resource{ID: "arn:aws:s3:::prod-data/*"},
+		GrantChain: []model.GrantIface{
+			model.NewRoleGrant("arn:aws:iam::111122223333:role/Dev"),
+			model.NewPolicyGrant("arn:aws:iam::111122223333:policy/ReadData"),
+		},
+		Effect: "Allow",
+		Conditions: []model.Condition{
+			{Operator: "Bool", Key: "aws:SecureTransport", Values: []string{"true"}},
+		},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`action ~ "s3:*" and resource ~ "arn:aws:s3:::prod-*" and not principal ~ "Service[*]"`, true},
+		{`action = "s3:*"`, false},
+		{`action != "s3:PutObject"`, true},
+		{`effect = Allow and condition missing`, false},
+		{`condition ~ "aws:Secure*" and condition present`, true},
+		{`policy ~ "*/ReadData" and type = managed`, true},
+		{`type = inline or role = "arn:aws:iam::111122223333:role/Admin"`, false},
+		{`not (effect = Deny or principal ~ "AWS[*:root]")`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			require.Nil(t, err)
+
+			require.Equal(t, tt.want, q.Match(&rule))
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  *model.Filter
+	}{
+		{
+			"conjunction",
+			`action ~ "s3:*" and resource = "*" and not principal ~ "Service[*]" and type = scp and role ~ "*Admin"`,
+			&model.Filter{
+				Permissions: []string{"s3:*"},
+				Resources:   []string{"*"},
+				Via:         model.Via{Roles: []string{"*Admin"}, Types: []string{model.SCP}},
+			},
+		},
+		{
+			"disjunction isn't pushed down",
+			`action ~ "s3:*" or policy ~ "*/AdministratorAccess"`,
+			&model.Filter{},
+		},
+		{
+			"inequality isn't pushed down",
+			`principal != "AWS[*]" and (effect = Deny)`,
+			&model.Filter{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			require.Nil(t, err)
+
+			require.Equal(t, tt.want, q.Filter())
+		})
+	}
+}
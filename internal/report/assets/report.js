@@ -0,0 +1,22 @@
+// Hides the principals not matching the filter, and opens the principal a
+// link points at.
+(function () {
+	var filter = document.getElementById("principal-filter");
+	var principals = document.querySelectorAll("details.principal");
+
+	filter.addEventListener("input", function () {
+		var text = filter.value.toLowerCase();
+		principals.forEach(function (p) {
+			p.hidden = p.querySelector("summary").textContent.toLowerCase().indexOf(text) < 0;
+		});
+	});
+
+	function openTarget() {
+		var target = document.getElementById(location.hash.slice(1));
+		if (target && target.tagName === "DETAILS") {
+			target.open = true;
+		}
+	}
+	window.addEventListener("hashchange", openTarget);
+	openTarget();
+})();
@@ -0,0 +1,58 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+type jsonFinding struct {
+	RuleID      string         `json:"ruleId"`
+	Fingerprint string         `json:"fingerprint"`
+	Severity    model.Severity `json:"severity"`
+	Principal   string         `json:"principal,omitempty"`
+	Message     string         `json:"message"`
+	Location    jsonLocation   `json:"location"`
+}
+
+type jsonLocation struct {
+	ARN            string `json:"arn"`
+	StatementIndex *int   `json:"statementIndex,omitempty"`
+}
+
+func WriteJSON(w io.Writer, findings []model.Finding) error {
+	jf := make([]jsonFinding, 0, len(findings))
+	for _, f := range findings {
+		jf = append(jf, jsonFinding{
+			RuleID:      f.CheckID,
+			Fingerprint: f.Fingerprint(),
+			Severity:    f.Severity,
+			Principal:   f.Principal.ID,
+			Message:     f.Message,
+			Location: jsonLocation{
+				ARN:            f.Location.ARN,
+				StatementIndex: f.Location.StatementIndex,
+			},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jf)
+}
+
+// ReadBaseline loads the fingerprints of a report previously written by
+// WriteJSON.
+func ReadBaseline(r io.Reader) (map[string]bool, error) {
+	var jf []jsonFinding
+	if err := json.NewDecoder(r).Decode(&jf); err != nil {
+		return nil, err
+	}
+
+	baseline := make(map[string]bool, len(jf))
+	for _, f := range jf {
+		baseline[f.Fingerprint] = true
+	}
+	return baseline, nil
+}
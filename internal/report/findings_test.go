@@ -0,0 +1,54 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+var testCheck = model.CheckInfo{ID: "test-check", Description: "test check", Severity: model.High}
+
+func testFindings() []model.Finding {
+	statement := 2
+	return []model.Finding{
+		{
+			CheckID:   "test-check",
+			Severity:  model.High,
+			Principal: model.Principal{ID: "AWS[*]"},
+			Location: model.Location{
+				ARN:            "arn:aws:iam::111122223333:role/TestRole",
+				StatementIndex: &statement,
+			},
+			Message: "role TestRole can be assumed by any AWS principal",
+		},
+		{
+			CheckID:  "test-check",
+			Severity: model.Low,
+			Location: model.Location{
+				ARN: "arn:aws:iam::111122223333:role/OtherRole",
+			},
+			Message: "role OtherRole has never been used",
+		},
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	findings := testFindings()
+
+	var buf bytes.Buffer
+	require.Nil(t, WriteJSON(&buf, findings))
+
+	require.Contains(t, buf.String(), `"ruleId": "test-check"`)
+	require.Contains(t, buf.String(), `"severity": "high"`)
+	require.Contains(t, buf.String(), `"statementIndex": 2`)
+
+	baseline, err := ReadBaseline(&buf)
+
+	require.Nil(t, err)
+	require.Equal(t, map[string]bool{
+		findings[0].Fingerprint(): true,
+		findings[1].Fingerprint(): true,
+	}, baseline)
+}
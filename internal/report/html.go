@@ -0,0 +1,166 @@
+package report
+
+import (
+	"crypto/sha1"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+//go:embed assets
+var assets embed.FS
+
+var htmlTemplate = template.Must(template.New("report.html.tmpl").Funcs(template.FuncMap{
+	"anchor": anchor,
+	"deref":  func(i *int) int { return *i },
+	"last":   func(chain []model.GrantIface) model.GrantIface { return chain[len(chain)-1] },
+}).ParseFS(assets, "assets/report.html.tmpl"))
+
+// HTMLReport is the content of the report handed to people who won't run
+// iamsnitch themselves.
+type HTMLReport struct {
+	GeneratedAt time.Time
+	Summary     *model.Summary
+	// Risks are ranked by score, the first ones are shown on the dashboard
+	Risks    []model.RiskScore
+	Findings []model.Finding
+	Rules    []model.AccessControlRule
+	// Previous is the snapshot of an earlier report, nil when there's none
+	Previous *Snapshot
+}
+
+// topRisks is how many of the riskiest principals the dashboard lists.
+const topRisks = 10
+
+type htmlPrincipal struct {
+	ID    string
+	Score int
+	Rules []model.AccessControlRule
+}
+
+type htmlRanking struct {
+	Title  string
+	Key    string
+	Count  string
+	Groups []model.Group
+}
+
+type htmlSeverity struct {
+	Severity model.Severity
+	Count    int
+}
+
+type htmlPage struct {
+	*HTMLReport
+	Style        template.CSS
+	Script       template.JS
+	MaxRiskScore int
+	RuleCount    int
+	Principals   []htmlPrincipal
+	TopRisks     []model.RiskScore
+	Rankings     []htmlRanking
+	Severities   []htmlSeverity
+	Diff         *SnapshotDiff
+	Snapshot     *Snapshot
+}
+
+// WriteHTML renders the report as a single page with its style and script
+// inlined. The rules are embedded as a snapshot a later report can be diffed
+// against, see ReadSnapshot.
+func WriteHTML(w io.Writer, r *HTMLReport) error {
+	style, err := assets.ReadFile("assets/style.css")
+	if err != nil {
+		return err
+	}
+	script, err := assets.ReadFile("assets/report.js")
+	if err != nil {
+		return err
+	}
+
+	page := &htmlPage{
+		HTMLReport:   r,
+		Style:        template.CSS(style),
+		Script:       template.JS(script),
+		MaxRiskScore: model.MaxRiskScore,
+		RuleCount:    len(r.Rules),
+		Principals:   groupByPrincipal(r.Rules, r.Risks),
+		TopRisks:     r.Risks,
+		Severities:   countSeverities(r.Findings),
+		Snapshot:     NewSnapshot(r.GeneratedAt, r.Rules),
+	}
+	if len(page.TopRisks) > topRisks {
+		page.TopRisks = page.TopRisks[:topRisks]
+	}
+	if r.Summary != nil {
+		page.Rankings = []htmlRanking{
+			{"Actions per principal", "Principal", "Actions", r.Summary.ActionsPerPrincipal},
+			{"Write and permissions management actions per principal", "Principal", "Actions", r.Summary.WritersPerPrincipal},
+			{"Principals per policy", "Policy", "Principals", r.Summary.PrincipalsPerPolicy},
+			{"Services per principal", "Principal", "Services", r.Summary.ServicesPerPrincipal},
+		}
+	}
+	if r.Previous != nil {
+		page.Diff = page.Snapshot.Diff(r.Previous)
+	}
+
+	return htmlTemplate.Execute(w, page)
+}
+
+// groupByPrincipal sorts the rules by principal, permission and resource, and
+// groups them under their principal along with its risk score.
+func groupByPrincipal(rules []model.AccessControlRule, risks []model.RiskScore) []htmlPrincipal {
+	scores := make(map[string]int, len(risks))
+	for _, s := range risks {
+		scores[s.Principal.ID] = s.Score
+	}
+
+	sorted := append([]model.AccessControlRule{}, rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := sorted[i], sorted[j]
+		if ri.Principal.ID != rj.Principal.ID {
+			return ri.Principal.ID < rj.Principal.ID
+		}
+		if ri.Permission.ID != rj.Permission.ID {
+			return ri.Permission.ID < rj.Permission.ID
+		}
+		return ri.Resource.ID < rj.Resource.ID
+	})
+
+	var principals []htmlPrincipal
+	for _, r := range sorted {
+		if n := len(principals); n == 0 || principals[n-1].ID != r.Principal.ID {
+			principals = append(principals, htmlPrincipal{ID: r.Principal.ID, Score: scores[r.Principal.ID]})
+		}
+		p := &principals[len(principals)-1]
+		p.Rules = append(p.Rules, r)
+	}
+	return principals
+}
+
+// countSeverities counts the findings of each severity found, most severe
+// first.
+func countSeverities(findings []model.Finding) []htmlSeverity {
+	counts := make(map[model.Severity]int)
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+
+	var severities []htmlSeverity
+	for s := model.Critical; s >= model.Info; s-- {
+		if counts[s] > 0 {
+			severities = append(severities, htmlSeverity{Severity: s, Count: counts[s]})
+		}
+	}
+	return severities
+}
+
+// anchor derives the id of a principal's section. Principal IDs hold
+// characters that don't belong in a fragment, so they're hashed instead.
+func anchor(principal string) string {
+	return fmt.Sprintf("principal-%x", sha1.Sum([]byte(principal)))[:22]
+}
@@ -0,0 +1,122 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func testHTMLRules() []model.AccessControlRule {
+	return []model.AccessControlRule{
+		{
+			Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/Admin]"},
+			Permission: model.Permission{ID: "iam:*"},
+			Resource:   model.Resource{ID: "*"},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant("arn:aws:iam::111122223333:role/Admin"),
+				model.NewPolicyGrant("arn:aws:iam::aws:policy/IAMFullAccess"),
+			},
+			Effect: "Allow",
+		},
+		{
+			Principal:  model.Principal{ID: "AWS[arn:aws:iam::111122223333:role/<Dev>]"},
+			Permission: model.Permission{ID: "s3:GetObject"},
+			Resource:   model.Resource{ID: "arn:aws:s3:::bucket/*"},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant("arn:aws:iam::111122223333:role/<Dev>"),
+				model.NewPolicyGrant("arn:aws:iam::111122223333:policy/Read"),
+			},
+			Effect: "Allow",
+			Conditions: []model.Condition{
+				{Operator: "Bool", Key: "aws:MultiFactorAuthPresent", Values: []string{"true"}},
+			},
+		},
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	rules := testHTMLRules()
+	generated := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	previous := NewSnapshot(generated.Add(-24*time.Hour), rules[1:])
+	previous.Rules = append(previous.Rules, SnapshotRule{
+		ID:         "gone",
+		Principal:  "AWS[arn:aws:iam::111122223333:role/Old]",
+		Permission: "s3:PutObject",
+		Resource:   "*",
+		GrantChain: []string{"Role:arn:aws:iam::111122223333:role/Old"},
+	})
+
+	var buf bytes.Buffer
+	err := WriteHTML(&buf, &HTMLReport{
+		GeneratedAt: generated,
+		Summary:     testSummary(),
+		Risks: []model.RiskScore{
+			{
+				Principal: rules[0].Principal,
+				Score:     40,
+				Factors:   []model.RiskContribution{{Factor: model.RiskPermissionsManagement, Count: 1}},
+			},
+		},
+		Findings: []model.Finding{
+			{CheckID: "admin-access", Severity: model.High, Principal: rules[0].Principal, Message: "administrator access"},
+		},
+		Rules:    rules,
+		Previous: previous,
+	})
+	require.Nil(t, err)
+
+	page := buf.String()
+	require.Contains(t, page, "<style>")
+	require.Contains(t, page, "permissions-management +15")
+	require.Contains(t, page, "administrator access")
+	require.Contains(t, page, "arn:aws:iam::aws:policy/IAMFullAccess")
+	require.Contains(t, page, "Bool aws:MultiFactorAuthPresent [true]")
+	require.Contains(t, page, "1 rules added, 1 rules removed")
+	require.Contains(t, page, "AWS[arn:aws:iam::111122223333:role/&lt;Dev&gt;]")
+	require.NotContains(t, page, "role/<Dev>")
+
+	s, err := ReadSnapshot(&buf)
+	require.Nil(t, err)
+	require.Equal(t, NewSnapshot(generated, rules), s)
+}
+
+func TestReadSnapshotMissing(t *testing.T) {
+	_, err := ReadSnapshot(bytes.NewBufferString("<html></html>"))
+	require.EqualError(t, err, "no snapshot found in report")
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	rules := testHTMLRules()
+	before := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	previous := NewSnapshot(before, rules[:1])
+	current := NewSnapshot(before.Add(time.Hour), rules[1:])
+
+	d := current.Diff(previous)
+
+	require.Equal(t, &SnapshotDiff{
+		Since:   before,
+		Added:   current.Rules,
+		Removed: previous.Rules,
+	}, d)
+	require.Equal(t, &SnapshotDiff{Since: before, Added: []SnapshotRule{}, Removed: []SnapshotRule{}}, previous.Diff(previous))
+}
+
+func TestSnapshotDiffDeny(t *testing.T) {
+	allow := testHTMLRules()[0]
+	deny := allow
+	deny.Effect = "Deny"
+	before := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	previous := NewSnapshot(before, []model.AccessControlRule{allow})
+	current := NewSnapshot(before.Add(time.Hour), []model.AccessControlRule{allow, deny})
+
+	d := current.Diff(previous)
+
+	require.Equal(t, &SnapshotDiff{
+		Since:   before,
+		Added:   current.Rules[1:],
+		Removed: []SnapshotRule{},
+	}, d)
+}
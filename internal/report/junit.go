@@ -0,0 +1,102 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit renders one test suite per check. Every finding is reported as a
+// failed test case and checks without findings as a single passing one.
+func WriteJUnit(w io.Writer, checks []model.CheckInfo, findings []model.Finding) error {
+	byCheck := make(map[string][]model.Finding)
+	for _, f := range findings {
+		byCheck[f.CheckID] = append(byCheck[f.CheckID], f)
+	}
+
+	report := junitTestSuites{Name: "iamsnitch audit"}
+	for _, c := range checks {
+		suite := junitTestSuite{Name: c.ID}
+
+		for _, f := range byCheck[c.ID] {
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      junitName(&f),
+				ClassName: c.ID,
+				Failure: &junitFailure{
+					Message: f.Message,
+					Type:    f.Severity.String(),
+					Text:    junitLocation(&f.Location),
+				},
+			})
+		}
+		if len(suite.TestCases) == 0 {
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      c.Description,
+				ClassName: c.ID,
+			})
+		}
+
+		suite.Tests = len(suite.TestCases)
+		suite.Failures = len(byCheck[c.ID])
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitName names a failed test case after the check, the principal and the
+// location, the parts of its fingerprint, so no two findings share a name.
+// Findings about a policy or role of their own are named after the location.
+func junitName(f *model.Finding) string {
+	if f.Principal.ID == "" {
+		return fmt.Sprintf("%v: %v", f.CheckID, junitLocation(&f.Location))
+	}
+	return fmt.Sprintf("%v: %v at %v", f.CheckID, f.Principal.ID, junitLocation(&f.Location))
+}
+
+func junitLocation(l *model.Location) string {
+	if l.StatementIndex == nil {
+		return l.ARN
+	}
+	return fmt.Sprintf("%v statement %v", l.ARN, *l.StatementIndex)
+}
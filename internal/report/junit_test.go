@@ -0,0 +1,65 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	tests := []struct {
+		name         string
+		findingCount int
+		wantTests    int
+		wantFailures int
+	}{
+		{"with findings", 2, 2, 2},
+		{"without findings", 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.Nil(t, WriteJUnit(&buf, []model.CheckInfo{testCheck}, testFindings()[:tt.findingCount]))
+
+			var suites junitTestSuites
+			require.Nil(t, xml.Unmarshal(buf.Bytes(), &suites))
+
+			require.Equal(t, tt.wantTests, suites.Tests)
+			require.Equal(t, tt.wantFailures, suites.Failures)
+			require.Len(t, suites.Suites, 1)
+			require.Equal(t, "test-check", suites.Suites[0].Name)
+		})
+	}
+}
+
+func TestWriteJUnitNames(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteJUnit(&buf, []model.CheckInfo{testCheck}, testFindings()))
+
+	var suites junitTestSuites
+	require.Nil(t, xml.Unmarshal(buf.Bytes(), &suites))
+
+	cases := suites.Suites[0].TestCases
+	require.Equal(t, "test-check: AWS[*] at arn:aws:iam::111122223333:role/TestRole statement 2", cases[0].Name)
+	// findings without principal are named after their location
+	require.Equal(t, "test-check: arn:aws:iam::111122223333:role/OtherRole", cases[1].Name)
+
+	// the same principal in another statement is another test case
+	findings := testFindings()
+	other := findings[0]
+	statement := 3
+	other.Location.StatementIndex = &statement
+	buf.Reset()
+	require.Nil(t, WriteJUnit(&buf, []model.CheckInfo{testCheck}, append(findings, other)))
+	var again junitTestSuites
+	require.Nil(t, xml.Unmarshal(buf.Bytes(), &again))
+	names := make(map[string]bool)
+	for _, c := range again.Suites[0].TestCases {
+		require.False(t, names[c.Name], c.Name)
+		names[c.Name] = true
+	}
+	require.Len(t, names, 3)
+}
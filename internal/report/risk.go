@@ -0,0 +1,75 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+type jsonRiskFactor struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Points      int    `json:"points"`
+	Count       int    `json:"count"`
+}
+
+type jsonRiskScore struct {
+	Principal string           `json:"principal"`
+	Score     int              `json:"score"`
+	Factors   []jsonRiskFactor `json:"factors"`
+}
+
+// WriteRiskJSON writes the risk scores, in their order, with the factors each
+// one is made of.
+func WriteRiskJSON(w io.Writer, scores []model.RiskScore) error {
+	js := make([]jsonRiskScore, 0, len(scores))
+	for _, s := range scores {
+		factors := make([]jsonRiskFactor, 0, len(s.Factors))
+		for _, c := range s.Factors {
+			factors = append(factors, jsonRiskFactor{
+				ID:          c.Factor.ID,
+				Description: c.Factor.Description,
+				Points:      c.Factor.Points,
+				Count:       c.Count,
+			})
+		}
+		js = append(js, jsonRiskScore{Principal: s.Principal.ID, Score: s.Score, Factors: factors})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(js)
+}
+
+// WriteRiskTable lists the principals with their score and the points of each
+// factor.
+func WriteRiskTable(w io.Writer, scores []model.RiskScore) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PRINCIPAL\tSCORE\tFACTORS")
+	for _, s := range scores {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", s.Principal.ID, s.Score, formatFactors(s.Factors))
+	}
+	return tw.Flush()
+}
+
+// WriteRiskBreakdown describes how the score of a principal adds up.
+func WriteRiskBreakdown(w io.Writer, s *model.RiskScore) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "risk score of %v: %v/%v\n", s.Principal.ID, s.Score, model.MaxRiskScore)
+	for _, c := range s.Factors {
+		fmt.Fprintf(tw, " +%v\t%v\t%v (%v)\n", c.Factor.Points, c.Factor.ID, c.Factor.Description, c.Count)
+	}
+	return tw.Flush()
+}
+
+func formatFactors(factors []model.RiskContribution) string {
+	parts := make([]string, 0, len(factors))
+	for _, c := range factors {
+		parts = append(parts, fmt.Sprintf("%v +%v", c.Factor.ID, c.Factor.Points))
+	}
+	return strings.Join(parts, ", ")
+}
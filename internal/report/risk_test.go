@@ -0,0 +1,60 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func testRiskScores() []model.RiskScore {
+	return []model.RiskScore{
+		{
+			Principal: model.Principal{ID: "AWS[arn:aws:iam::444455556666:root]"},
+			Score:     40,
+			Factors: []model.RiskContribution{
+				{Factor: model.RiskEscalation, Count: 2},
+				{Factor: model.RiskCrossAccount, Count: 3},
+			},
+		},
+		{Principal: model.Principal{ID: "AWS[b]"}},
+	}
+}
+
+func TestWriteRiskTable(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteRiskTable(&buf, testRiskScores()))
+
+	require.Equal(t, `PRINCIPAL                            SCORE  FACTORS
+AWS[arn:aws:iam::444455556666:root]  40     privilege-escalation +25, cross-account +15
+AWS[b]                               0      
+`, buf.String())
+}
+
+func TestWriteRiskBreakdown(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteRiskBreakdown(&buf, &testRiskScores()[0]))
+
+	require.Equal(t, `risk score of AWS[arn:aws:iam::444455556666:root]: 40/100
+ +25  privilege-escalation  can obtain broader access than it holds (2)
+ +15  cross-account         reaches roles of another account (3)
+`, buf.String())
+}
+
+func TestWriteRiskJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteRiskJSON(&buf, testRiskScores()))
+
+	require.JSONEq(t, `[
+		{
+			"principal": "AWS[arn:aws:iam::444455556666:root]",
+			"score": 40,
+			"factors": [
+				{"id": "privilege-escalation", "description": "can obtain broader access than it holds", "points": 25, "count": 2},
+				{"id": "cross-account", "description": "reaches roles of another account", "points": 15, "count": 3}
+			]
+		},
+		{"principal": "AWS[b]", "score": 0, "factors": []}
+	]`, buf.String())
+}
@@ -0,0 +1,163 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           map[string]string  `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           *int              `json:"ruleIndex,omitempty"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifRegion uses the 1-based statement index as line number since policy
+// documents have no meaningful lines of their own.
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+func WriteSARIF(w io.Writer, checks []model.CheckInfo, findings []model.Finding) error {
+	rules := make([]sarifRule, 0, len(checks))
+	ruleIndex := make(map[string]int, len(checks))
+	for i, c := range checks {
+		ruleIndex[c.ID] = i
+		rules = append(rules, sarifRule{
+			ID:               c.ID,
+			ShortDescription: sarifMessage{Text: c.Description},
+			DefaultConfiguration: sarifConfiguration{
+				Level: sarifLevel(c.Severity),
+			},
+			Properties: map[string]string{
+				"severity": c.Severity.String(),
+			},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		loc := sarifLocation{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.Location.ARN},
+			},
+			LogicalLocations: []sarifLogicalLocation{
+				{
+					FullyQualifiedName: f.Location.ARN,
+					Kind:               "resource",
+				},
+			},
+		}
+		if f.Location.StatementIndex != nil {
+			loc.PhysicalLocation.Region = &sarifRegion{StartLine: *f.Location.StatementIndex + 1}
+		}
+
+		result := sarifResult{
+			RuleID:    f.CheckID,
+			Level:     sarifLevel(f.Severity),
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{loc},
+			PartialFingerprints: map[string]string{
+				"iamsnitchFinding/v1": f.Fingerprint(),
+			},
+		}
+		// findings of checks that aren't described point at no rule
+		if i, ok := ruleIndex[f.CheckID]; ok {
+			result.RuleIndex = &i
+		}
+		results = append(results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "iamsnitch",
+						InformationURI: "https://github.com/jeandreh/iamsnitch",
+						Rules:          rules,
+					},
+				},
+				Results: results,
+			},
+		},
+	})
+}
+
+func sarifLevel(s model.Severity) string {
+	switch {
+	case s >= model.High:
+		return "error"
+	case s == model.Medium:
+		return "warning"
+	}
+	return "note"
+}
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	findings := testFindings()
+
+	var buf bytes.Buffer
+	require.Nil(t, WriteSARIF(&buf, []model.CheckInfo{testCheck}, findings))
+
+	var log sarifLog
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+
+	require.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	require.Equal(t, "test-check", log.Runs[0].Tool.Driver.Rules[0].ID)
+	require.Equal(t, "error", log.Runs[0].Tool.Driver.Rules[0].DefaultConfiguration.Level)
+	require.Len(t, log.Runs[0].Results, 2)
+
+	first := log.Runs[0].Results[0]
+	require.Equal(t, "test-check", first.RuleID)
+	require.Equal(t, 0, *first.RuleIndex)
+	require.Equal(t, "error", first.Level)
+	require.Equal(t, "arn:aws:iam::111122223333:role/TestRole", first.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	require.Equal(t, &sarifRegion{StartLine: 3}, first.Locations[0].PhysicalLocation.Region)
+	require.Equal(t, findings[0].Fingerprint(), first.PartialFingerprints["iamsnitchFinding/v1"])
+
+	second := log.Runs[0].Results[1]
+	require.Equal(t, "note", second.Level)
+	require.Nil(t, second.Locations[0].PhysicalLocation.Region)
+}
+
+func TestWriteSARIFUnknownCheck(t *testing.T) {
+	findings := testFindings()[:1]
+	findings[0].CheckID = "custom-check"
+
+	var buf bytes.Buffer
+	require.Nil(t, WriteSARIF(&buf, []model.CheckInfo{testCheck}, findings))
+	require.NotContains(t, buf.String(), "ruleIndex")
+
+	var log sarifLog
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+	require.Equal(t, "custom-check", log.Runs[0].Results[0].RuleID)
+	require.Nil(t, log.Runs[0].Results[0].RuleIndex)
+}
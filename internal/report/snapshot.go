@@ -0,0 +1,118 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+// snapshotTag opens the script element the HTML report embeds its snapshot
+// in, so a later report can be diffed against it.
+const snapshotTag = `<script type="application/json" id="snapshot">`
+
+// Snapshot is the list of rules a report was generated from.
+type Snapshot struct {
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Rules       []SnapshotRule `json:"rules"`
+}
+
+type SnapshotRule struct {
+	ID         string   `json:"id"`
+	Principal  string   `json:"principal"`
+	Permission string   `json:"permission"`
+	Resource   string   `json:"resource"`
+	GrantChain []string `json:"grantChain"`
+}
+
+// SnapshotDiff holds the rules found in only one of two snapshots.
+type SnapshotDiff struct {
+	Since   time.Time
+	Added   []SnapshotRule
+	Removed []SnapshotRule
+}
+
+func NewSnapshot(generatedAt time.Time, rules []model.AccessControlRule) *Snapshot {
+	s := &Snapshot{GeneratedAt: generatedAt, Rules: make([]SnapshotRule, 0, len(rules))}
+	for _, r := range rules {
+		chain := make([]string, 0, len(r.GrantChain))
+		for _, g := range r.GrantChain {
+			chain = append(chain, g.String())
+		}
+		s.Rules = append(s.Rules, SnapshotRule{
+			ID:         r.ID(),
+			Principal:  r.Principal.ID,
+			Permission: r.Permission.ID,
+			Resource:   r.Resource.ID,
+			GrantChain: chain,
+		})
+	}
+	return s
+}
+
+// ReadSnapshot extracts the snapshot embedded in a report written by
+// WriteHTML.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	page, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	start := bytes.Index(page, []byte(snapshotTag))
+	if start < 0 {
+		return nil, fmt.Errorf("no snapshot found in report")
+	}
+	data := page[start+len(snapshotTag):]
+	end := bytes.Index(data, []byte("</script>"))
+	if end < 0 {
+		return nil, fmt.Errorf("no snapshot found in report")
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data[:end], &s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	return &s, nil
+}
+
+// Diff compares the snapshot to a previous one. Rules are told apart by their
+// ID, so the same access granted through another grant chain or statement is
+// reported as added and removed.
+func (s *Snapshot) Diff(previous *Snapshot) *SnapshotDiff {
+	d := &SnapshotDiff{Since: previous.GeneratedAt}
+	d.Added = missingRules(s.Rules, previous.Rules)
+	d.Removed = missingRules(previous.Rules, s.Rules)
+	return d
+}
+
+// missingRules returns the rules of a not in b, ordered by principal,
+// permission and resource.
+func missingRules(a, b []SnapshotRule) []SnapshotRule {
+	ids := make(map[string]bool, len(b))
+	for _, r := range b {
+		ids[r.ID] = true
+	}
+
+	missing := []SnapshotRule{}
+	for _, r := range a {
+		if !ids[r.ID] {
+			missing = append(missing, r)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		ri, rj := missing[i], missing[j]
+		if ri.Principal != rj.Principal {
+			return ri.Principal < rj.Principal
+		}
+		if ri.Permission != rj.Permission {
+			return ri.Permission < rj.Permission
+		}
+		return ri.Resource < rj.Resource
+	})
+	return missing
+}
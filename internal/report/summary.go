@@ -0,0 +1,76 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+type jsonGroup struct {
+	Key    string   `json:"key"`
+	Count  int      `json:"count"`
+	Values []string `json:"values"`
+}
+
+type jsonSummary struct {
+	ActionsPerPrincipal  []jsonGroup `json:"actionsPerPrincipal"`
+	WritersPerPrincipal  []jsonGroup `json:"writeActionsPerPrincipal"`
+	PrincipalsPerPolicy  []jsonGroup `json:"principalsPerPolicy"`
+	ServicesPerPrincipal []jsonGroup `json:"servicesPerPrincipal"`
+}
+
+func WriteSummaryJSON(w io.Writer, s *model.Summary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonSummary{
+		ActionsPerPrincipal:  newJSONGroups(s.ActionsPerPrincipal),
+		WritersPerPrincipal:  newJSONGroups(s.WritersPerPrincipal),
+		PrincipalsPerPolicy:  newJSONGroups(s.PrincipalsPerPolicy),
+		ServicesPerPrincipal: newJSONGroups(s.ServicesPerPrincipal),
+	})
+}
+
+func newJSONGroups(groups []model.Group) []jsonGroup {
+	jg := make([]jsonGroup, 0, len(groups))
+	for _, g := range groups {
+		jg = append(jg, jsonGroup{Key: g.Key, Count: g.Count, Values: g.Values})
+	}
+	return jg
+}
+
+// WriteSummaryTable renders a table per aggregate. Only the services are
+// listed along with their count, the other values being too many to read.
+func WriteSummaryTable(w io.Writer, s *model.Summary) error {
+	tables := []struct {
+		title      string
+		header     []string
+		groups     []model.Group
+		withValues bool
+	}{
+		{"Actions per principal", []string{"PRINCIPAL", "ACTIONS"}, s.ActionsPerPrincipal, false},
+		{"Write and permissions management actions per principal", []string{"PRINCIPAL", "ACTIONS"}, s.WritersPerPrincipal, false},
+		{"Principals per policy", []string{"POLICY", "PRINCIPALS"}, s.PrincipalsPerPolicy, false},
+		{"Services per principal", []string{"PRINCIPAL", "COUNT", "SERVICES"}, s.ServicesPerPrincipal, true},
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%v\n\n", t.title)
+		fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+		for _, g := range t.groups {
+			if t.withValues {
+				fmt.Fprintf(tw, "%v\t%v\t%v\n", g.Key, g.Count, strings.Join(g.Values, ", "))
+			} else {
+				fmt.Fprintf(tw, "%v\t%v\n", g.Key, g.Count)
+			}
+		}
+	}
+	return tw.Flush()
+}
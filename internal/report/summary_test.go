@@ -0,0 +1,70 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func testSummary() *model.Summary {
+	return &model.Summary{
+		ActionsPerPrincipal: []model.Group{
+			{Key: "AWS[arn:aws:iam::111122223333:role/Admin]", Count: 12, Values: []string{"s3:GetObject"}},
+			{Key: "AWS[b]", Count: 1, Values: []string{"s3:GetObject"}},
+		},
+		WritersPerPrincipal: []model.Group{},
+		PrincipalsPerPolicy: []model.Group{
+			{Key: "arn:aws:iam::aws:policy/ReadOnlyAccess", Count: 2, Values: []string{"AWS[a]", "AWS[b]"}},
+		},
+		ServicesPerPrincipal: []model.Group{
+			{Key: "AWS[b]", Count: 2, Values: []string{"s3", "sqs"}},
+		},
+	}
+}
+
+func TestWriteSummaryTable(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteSummaryTable(&buf, testSummary()))
+
+	require.Equal(t, `Actions per principal
+
+PRINCIPAL                                  ACTIONS
+AWS[arn:aws:iam::111122223333:role/Admin]  12
+AWS[b]                                     1
+
+Write and permissions management actions per principal
+
+PRINCIPAL  ACTIONS
+
+Principals per policy
+
+POLICY                                  PRINCIPALS
+arn:aws:iam::aws:policy/ReadOnlyAccess  2
+
+Services per principal
+
+PRINCIPAL  COUNT  SERVICES
+AWS[b]     2      s3, sqs
+`, buf.String())
+}
+
+func TestWriteSummaryJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, WriteSummaryJSON(&buf, testSummary()))
+
+	require.JSONEq(t, `{
+		"actionsPerPrincipal": [
+			{"key": "AWS[arn:aws:iam::111122223333:role/Admin]", "count": 12, "values": ["s3:GetObject"]},
+			{"key": "AWS[b]", "count": 1, "values": ["s3:GetObject"]}
+		],
+		"writeActionsPerPrincipal": [],
+		"principalsPerPolicy": [
+			{"key": "arn:aws:iam::aws:policy/ReadOnlyAccess", "count": 2, "values": ["AWS[a]", "AWS[b]"]}
+		],
+		"servicesPerPrincipal": [
+			{"key": "AWS[b]", "count": 2, "values": ["s3", "sqs"]}
+		]
+	}`, buf.String())
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	shutdownTimeout = 30 * time.Second
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+type RefreshState string
+
+const (
+	Idle      RefreshState = "idle"
+	Running   RefreshState = "running"
+	Succeeded RefreshState = "succeeded"
+	Failed    RefreshState = "failed"
+)
+
+type RefreshStatus struct {
+	State      RefreshState `json:"state"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+type Server struct {
+	service *iamsnitch.AccessControlService
+	// refresh refreshes the cache the service reads from
+	refresh func() error
+	mux     *http.ServeMux
+	mu      sync.Mutex
+	status  RefreshStatus
+	wg      sync.WaitGroup
+}
+
+// New serves the service, refreshing its cache with refresh on request.
+func New(service *iamsnitch.AccessControlService, refresh func() error) *Server {
+	s := &Server{
+		service: service,
+		refresh: refresh,
+		mux:     http.NewServeMux(),
+		status:  RefreshStatus{State: Idle},
+	}
+	s.mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("/v1/whocan", s.handleWhoCan)
+	s.mux.HandleFunc("/v1/whatcan", s.handleWhatCan)
+	s.mux.HandleFunc("/v1/refresh", s.handleRefresh)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API until ctx is cancelled, then stops accepting
+// requests and waits for in-flight requests and refreshes to finish.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	logrus.WithField("addr", addr).Info("serving iamsnitch API")
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	s.wg.Wait()
+
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+func (s *Server) handleWhoCan(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	q := r.URL.Query()
+	permissions, resources := q["permission"], q["resource"]
+	if len(permissions) == 0 || len(resources) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one permission and one resource are required")
+		return
+	}
+
+	exact, page, err := parseQueryOptions(q.Get("exact"), q.Get("page_size"), q.Get("page_token"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := readPage(page, func(mp model.Page, fn func(model.AccessControlRule) error) error {
+		return s.service.WhoCanEach(permissions, resources, model.Via{}, exact, mp, fn)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleWhatCan(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	q := r.URL.Query()
+	principals := q["principal"]
+	if len(principals) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one principal is required")
+		return
+	}
+
+	exact, page, err := parseQueryOptions(q.Get("exact"), q.Get("page_size"), q.Get("page_token"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := readPage(page, func(mp model.Page, fn func(model.AccessControlRule) error) error {
+		return s.service.WhatCanEach(principals, exact, mp, fn)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.refreshStatus())
+	case http.MethodPost:
+		status, started := s.startRefresh()
+		if !started {
+			writeJSON(w, http.StatusConflict, status)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, status)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) refreshStatus() RefreshStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *Server) startRefresh() (RefreshStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status.State == Running {
+		return s.status, false
+	}
+
+	now := time.Now()
+	s.status = RefreshStatus{
+		State:     Running,
+		StartedAt: &now,
+	}
+
+	s.wg.Add(1)
+	go s.runRefresh()
+
+	return s.status, true
+}
+
+func (s *Server) runRefresh() {
+	defer s.wg.Done()
+
+	err := s.refresh()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.status.FinishedAt = &now
+	s.status.State = Succeeded
+	if err != nil {
+		logrus.WithField("error", err).Error("refresh failed")
+		s.status.State = Failed
+		s.status.Error = err.Error()
+	}
+}
+
+// pageSort is the order rules are paged through, the page token being the
+// sort key of the last rule of the previous page.
+const pageSort = model.SortByPrincipal
+
+type page struct {
+	after []string
+	size  int
+}
+
+func parseQueryOptions(exactParam string, sizeParam string, tokenParam string) (exact bool, p page, err error) {
+	if exactParam != "" {
+		if exact, err = strconv.ParseBool(exactParam); err != nil {
+			return false, p, fmt.Errorf("invalid exact %q", exactParam)
+		}
+	}
+
+	p.size = defaultPageSize
+	if sizeParam != "" {
+		p.size, err = strconv.Atoi(sizeParam)
+		if err != nil || p.size < 1 || p.size > maxPageSize {
+			return false, p, fmt.Errorf("page_size must be between 1 and %v", maxPageSize)
+		}
+	}
+
+	if tokenParam != "" {
+		p.after, err = decodePageToken(tokenParam)
+		if err != nil {
+			return false, p, fmt.Errorf("invalid page_token")
+		}
+	}
+	return exact, p, nil
+}
+
+func encodePageToken(key []string) string {
+	b, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(token string) ([]string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var key []string
+	if err := json.Unmarshal(b, &key); err != nil {
+		return nil, err
+	}
+	mp := model.Page{Sort: pageSort, After: key}
+	if err := mp.Validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+type grantResponse struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type ruleResponse struct {
+	Principal      string          `json:"principal"`
+	Permission     string          `json:"permission"`
+	Resource       string          `json:"resource"`
+	GrantChain     []grantResponse `json:"grant_chain"`
+	StatementIndex int             `json:"statement_index"`
+}
+
+type rulesResponse struct {
+	Rules         []ruleResponse `json:"rules"`
+	NextPageToken string         `json:"next_page_token,omitempty"`
+}
+
+// readPage reads one rule past the page to tell whether there's a next one.
+func readPage(p page, each func(model.Page, func(model.AccessControlRule) error) error) (rulesResponse, error) {
+	resp := rulesResponse{Rules: []ruleResponse{}}
+	var last []string
+	err := each(model.Page{Sort: pageSort, After: p.after, Limit: p.size + 1}, func(r model.AccessControlRule) error {
+		if len(resp.Rules) == p.size {
+			resp.NextPageToken = encodePageToken(last)
+			return nil
+		}
+		resp.Rules = append(resp.Rules, newRuleResponse(&r))
+		last = model.SortKey(pageSort, &r)
+		return nil
+	})
+	return resp, err
+}
+
+func newRuleResponse(r *model.AccessControlRule) ruleResponse {
+	chain := make([]grantResponse, 0, len(r.GrantChain))
+	for _, g := range r.GrantChain {
+		// grants render as Type:ID
+		parts := strings.SplitN(g.String(), ":", 2)
+		chain = append(chain, grantResponse{Type: parts[0], ID: parts[len(parts)-1]})
+	}
+
+	return ruleResponse{
+		Principal:      r.Principal.ID,
+		Permission:     r.Permission.ID,
+		Resource:       r.Resource.ID,
+		GrantChain:     chain,
+		StatementIndex: r.StatementIndex,
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithField("error", err).Error("failed to write response")
+	}
+}
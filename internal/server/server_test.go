@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/cache/memory"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhoCan(t *testing.T) {
+	rules := []model.AccessControlRule{
+		newRule("AWS[b]", "s3:PutObject"),
+		newRule("AWS[a]", "s3:PutObject"),
+		newRule("AWS[c]", "s3:PutObject"),
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantRules []string
+		wantNext  bool
+	}{
+		{
+			"first page",
+			"?permission=s3:Put*&resource=*&page_size=2",
+			http.StatusOK,
+			[]string{"AWS[a]", "AWS[b]"},
+			true,
+		},
+		{
+			"last page",
+			"?permission=s3:Put*&resource=*&page_size=2&page_token=" + encodePageToken(model.SortKey(model.SortByPrincipal, &rules[0])),
+			http.StatusOK,
+			[]string{"AWS[c]"},
+			false,
+		},
+		{
+			"missing resource",
+			"?permission=s3:Put*",
+			http.StatusBadRequest,
+			nil,
+			false,
+		},
+		{
+			"invalid page size",
+			"?permission=s3:Put*&resource=*&page_size=0",
+			http.StatusBadRequest,
+			nil,
+			false,
+		},
+		{
+			"invalid page token",
+			"?permission=s3:Put*&resource=*&page_token=notatoken",
+			http.StatusBadRequest,
+			nil,
+			false,
+		},
+		{
+			"page token of another sort",
+			"?permission=s3:Put*&resource=*&page_token=" + encodePageToken([]string{"AWS[a]"}),
+			http.StatusBadRequest,
+			nil,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := memory.New()
+			require.Nil(t, cache.SaveACL(rules))
+			s := New(iamsnitch.NewAccessControlService(nil, cache), nil)
+
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/whocan"+tt.query, nil))
+
+			require.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp rulesResponse
+			require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+			principals := make([]string, 0, len(resp.Rules))
+			for _, r := range resp.Rules {
+				principals = append(principals, r.Principal)
+			}
+			require.Equal(t, tt.wantRules, principals)
+			require.Equal(t, tt.wantNext, resp.NextPageToken != "")
+			require.Equal(t, []grantResponse{{Type: "Role", ID: "arn:aws:iam::111122223333:role/SomeRole"}}, resp.Rules[0].GrantChain)
+		})
+	}
+}
+
+func TestWhatCan(t *testing.T) {
+	cache := memory.New()
+	require.Nil(t, cache.SaveACL([]model.AccessControlRule{
+		newRule("AWS[a]", "s3:GetObject"),
+		newRule("AWS[*]", "s3:PutObject"),
+	}))
+	s := New(iamsnitch.NewAccessControlService(nil, cache), nil)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/whatcan?principal=AWS[a]&exact=true", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"permission":"s3:GetObject"`)
+	require.NotContains(t, rec.Body.String(), `"permission":"s3:PutObject"`)
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		fetchErr  error
+		wantState RefreshState
+	}{
+		{"success", nil, Succeeded},
+		{"failure", fmt.Errorf("fetch error"), Failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refreshed int
+			s := New(iamsnitch.NewAccessControlService(nil, nil), func() error {
+				refreshed++
+				return tt.fetchErr
+			})
+
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/refresh", nil))
+			require.Equal(t, http.StatusAccepted, rec.Code)
+
+			s.wg.Wait()
+
+			rec = httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/refresh", nil))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var status RefreshStatus
+			require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &status))
+			require.Equal(t, tt.wantState, status.State)
+			require.NotNil(t, status.FinishedAt)
+			require.Equal(t, 1, refreshed)
+			if tt.fetchErr != nil {
+				require.Equal(t, tt.fetchErr.Error(), status.Error)
+			}
+		})
+	}
+}
+
+func TestRefreshConflict(t *testing.T) {
+	s := New(iamsnitch.NewAccessControlService(nil, nil), nil)
+	s.status.State = Running
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/refresh", nil))
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := New(iamsnitch.NewAccessControlService(nil, nil), nil)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, json.Valid(rec.Body.Bytes()))
+}
+
+func newRule(principal string, permission string) model.AccessControlRule {
+	return model.AccessControlRule{
+		Principal:  model.Principal{ID: principal},
+		Permission: model.Permission{ID: permission},
+		Resource:   model.Resource{ID: "*"},
+		GrantChain: []model.GrantIface{
+			model.NewRoleGrant("arn:aws:iam::111122223333:role/SomeRole"),
+		},
+	}
+}
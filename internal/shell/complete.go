@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"strings"
+)
+
+// Complete implements term.Terminal's AutoCompleteCallback. The word under the
+// cursor is extended to the longest prefix shared by the matching commands,
+// actions, principals or resources.
+func (s *Shell) Complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	head := line[:pos]
+	start := strings.LastIndexAny(head, " ,") + 1
+	word := head[start:]
+	args := strings.Fields(head[:strings.LastIndex(head, " ")+1])
+
+	var candidates []string
+	if len(args) == 0 {
+		candidates = commandNames()
+	} else if c, ok := commands[args[0]]; ok && c.complete != nil {
+		candidates = c.complete(s, len(args)-1)
+	}
+
+	prefix, ok := commonPrefix(word, candidates)
+	if !ok || prefix == word {
+		return "", 0, false
+	}
+	return head[:start] + prefix + line[pos:], start + len(prefix), true
+}
+
+func completeWhoCan(s *Shell, arg int) []string {
+	switch arg {
+	case 0:
+		return s.actions
+	case 1:
+		return s.resources
+	}
+	return nil
+}
+
+func completeSet(s *Shell, arg int) []string {
+	switch arg {
+	case 0:
+		return []string{"exact", "pagesize"}
+	case 1:
+		return []string{"on", "off"}
+	}
+	return nil
+}
+
+func commonPrefix(word string, candidates []string) (string, bool) {
+	var prefix string
+	found := false
+	for _, c := range candidates {
+		if !strings.HasPrefix(c, word) {
+			continue
+		}
+		if !found {
+			prefix, found = c, true
+			continue
+		}
+		i := 0
+		for i < len(prefix) && i < len(c) && prefix[i] == c[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return prefix, found
+}
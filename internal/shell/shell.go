@@ -0,0 +1,350 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+)
+
+const defaultPageSize = 20
+
+// LineReader is satisfied by term.Terminal and by plain line scanners, so the
+// shell runs the same way interactively and from a pipe.
+type LineReader interface {
+	ReadLine() (string, error)
+}
+
+// Shell is an interactive session over the cached access control list. The
+// last result set is kept so it can be paged through, explained and drilled
+// into.
+type Shell struct {
+	service  *iamsnitch.AccessControlService
+	out      io.Writer
+	exact    bool
+	pageSize int
+	results  []model.AccessControlRule
+	page     int
+
+	actions    []string
+	principals []string
+	resources  []string
+}
+
+type command struct {
+	usage    string
+	help     string
+	run      func(s *Shell, args []string) error
+	complete func(s *Shell, arg int) []string
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"whocan": {
+			usage:    "whocan <permissions> <resources>",
+			help:     "principals allowed the comma separated permissions on the resources",
+			run:      (*Shell).whoCan,
+			complete: completeWhoCan,
+		},
+		"whatcan": {
+			usage:    "whatcan <principals>",
+			help:     "permissions held by the comma separated principals",
+			run:      (*Shell).whatCan,
+			complete: func(s *Shell, arg int) []string { return s.principals },
+		},
+		"explain": {
+			usage: "explain <n>",
+			help:  "describe how result n is granted",
+			run:   (*Shell).explain,
+		},
+		"drill": {
+			usage: "drill <n> <step>",
+			help:  "list every cached rule granted through a step of the grant chain of result n",
+			run:   (*Shell).drill,
+		},
+		"next": {
+			usage: "next",
+			help:  "show the next page of results",
+			run:   (*Shell).next,
+		},
+		"prev": {
+			usage: "prev",
+			help:  "show the previous page of results",
+			run:   (*Shell).prev,
+		},
+		"set": {
+			usage:    "set exact on|off | set pagesize <n>",
+			help:     "change the session settings",
+			run:      (*Shell).set,
+			complete: completeSet,
+		},
+		"help": {
+			usage: "help",
+			help:  "list the available commands",
+			run:   (*Shell).help,
+		},
+		"exit": {
+			usage: "exit",
+			help:  "leave the shell",
+		},
+	}
+}
+
+func New(service *iamsnitch.AccessControlService, out io.Writer) *Shell {
+	return &Shell{
+		service:  service,
+		out:      out,
+		pageSize: defaultPageSize,
+	}
+}
+
+// Load streams the cache once to build the completion candidates, the rules
+// themselves are queried by each command.
+func (s *Shell) Load() error {
+	actions := map[string]bool{}
+	principals := map[string]bool{}
+	resources := map[string]bool{}
+	err := s.service.WhoCanEach([]string{"*"}, []string{"*"}, model.Via{}, false, model.Page{}, func(r model.AccessControlRule) error {
+		actions[r.Permission.ID] = true
+		principals[r.Principal.ID] = true
+		resources[r.Resource.ID] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.actions = sortedKeys(actions)
+	s.principals = sortedKeys(principals)
+	s.resources = sortedKeys(resources)
+	return nil
+}
+
+func (s *Shell) Run(in LineReader) error {
+	if err := s.Load(); err != nil {
+		return err
+	}
+
+	for {
+		line, err := in.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !s.Exec(line) {
+			return nil
+		}
+	}
+}
+
+// Exec runs a single command line and reports whether the session goes on.
+func (s *Shell) Exec(line string) bool {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return true
+	}
+	if args[0] == "exit" || args[0] == "quit" {
+		return false
+	}
+
+	c, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command %v, type help for the list of commands\n", args[0])
+		return true
+	}
+	if err := c.run(s, args[1:]); err != nil {
+		fmt.Fprintf(s.out, "error: %v\n", err)
+	}
+	return true
+}
+
+func (s *Shell) whoCan(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %v", commands["whocan"].usage)
+	}
+	acl, err := s.service.WhoCan(strings.Split(args[0], ","), strings.Split(args[1], ","), s.exact)
+	if err != nil {
+		return err
+	}
+	s.show(acl)
+	return nil
+}
+
+func (s *Shell) whatCan(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %v", commands["whatcan"].usage)
+	}
+	acl, err := s.service.WhatCan(strings.Split(args[0], ","), s.exact)
+	if err != nil {
+		return err
+	}
+	s.show(acl)
+	return nil
+}
+
+func (s *Shell) explain(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %v", commands["explain"].usage)
+	}
+	r, err := s.result(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "%v is allowed %v on %v\n", r.Principal.ID, r.Permission.ID, r.Resource.ID)
+	subject := r.Principal.ID
+	for i, g := range r.GrantChain {
+		switch v := g.(type) {
+		case model.RoleGrant:
+			fmt.Fprintf(s.out, " %d. %v assumes role %v\n", i+1, subject, v.ID)
+			subject = v.ID
+		case model.PolicyGrant:
+			fmt.Fprintf(s.out, " %d. policy %v is attached to %v\n", i+1, v.ID, subject)
+			subject = v.ID
+		default:
+			fmt.Fprintf(s.out, " %d. %v\n", i+1, g)
+		}
+	}
+	fmt.Fprintf(s.out, " statement %d of %v allows %v on %v\n", r.StatementIndex, subject, r.Permission.ID, r.Resource.ID)
+	return nil
+}
+
+func (s *Shell) drill(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %v", commands["drill"].usage)
+	}
+	r, err := s.result(args[0])
+	if err != nil {
+		return err
+	}
+	step, err := strconv.Atoi(args[1])
+	if err != nil || step < 1 || step > len(r.GrantChain) {
+		return fmt.Errorf("step must be between 1 and %v", len(r.GrantChain))
+	}
+
+	var via model.Via
+	switch g := r.GrantChain[step-1].(type) {
+	case model.RoleGrant:
+		via.Roles = []string{g.ID}
+	case model.PolicyGrant:
+		via.Policies = []string{g.ID}
+	default:
+		return fmt.Errorf("step %v is neither a role nor a policy", step)
+	}
+	acl, err := s.service.WhoCanVia([]string{"*"}, []string{"*"}, via, true)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "rules granted through %v\n", r.GrantChain[step-1])
+	s.show(acl)
+	return nil
+}
+
+func (s *Shell) next(args []string) error {
+	if (s.page+1)*s.pageSize >= len(s.results) {
+		return fmt.Errorf("already on the last page")
+	}
+	s.page++
+	s.printPage()
+	return nil
+}
+
+func (s *Shell) prev(args []string) error {
+	if s.page == 0 {
+		return fmt.Errorf("already on the first page")
+	}
+	s.page--
+	s.printPage()
+	return nil
+}
+
+func (s *Shell) set(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %v", commands["set"].usage)
+	}
+	switch args[0] {
+	case "exact":
+		switch args[1] {
+		case "on":
+			s.exact = true
+		case "off":
+			s.exact = false
+		default:
+			return fmt.Errorf("exact must be on or off")
+		}
+	case "pagesize":
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("pagesize must be a positive number")
+		}
+		s.pageSize = n
+		s.page = 0
+	default:
+		return fmt.Errorf("unknown setting %v", args[0])
+	}
+	return nil
+}
+
+func (s *Shell) help(args []string) error {
+	for _, name := range commandNames() {
+		fmt.Fprintf(s.out, "  %-40v %v\n", commands[name].usage, commands[name].help)
+	}
+	return nil
+}
+
+func (s *Shell) show(acl []model.AccessControlRule) {
+	s.results = acl
+	s.page = 0
+	s.printPage()
+}
+
+func (s *Shell) printPage() {
+	start := s.page * s.pageSize
+	end := start + s.pageSize
+	if end > len(s.results) {
+		end = len(s.results)
+	}
+	for i := start; i < end; i++ {
+		r := s.results[i]
+		fmt.Fprintf(s.out, "[%d] %v %v %v\n", i+1, r.Principal.ID, r.Permission.ID, r.Resource.ID)
+	}
+	if end < len(s.results) {
+		fmt.Fprintf(s.out, "showing %d-%d of %d, type next for more\n", start+1, end, len(s.results))
+	} else {
+		fmt.Fprintf(s.out, "%d results\n", len(s.results))
+	}
+}
+
+func (s *Shell) result(arg string) (*model.AccessControlRule, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(s.results) {
+		return nil, fmt.Errorf("no result %v", arg)
+	}
+	return &s.results[n-1], nil
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,155 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jeandreh/iam-snitch/iamsnitch"
+	"github.com/jeandreh/iam-snitch/internal/domain/model"
+	"github.com/jeandreh/iam-snitch/internal/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShell(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cacheMock := mocks.NewCacheMock(ctrl)
+	cacheMock.
+		EXPECT().
+		FindEach(gomock.Eq(&model.Filter{Permissions: []string{"*"}, Resources: []string{"*"}}), gomock.Any()).
+		DoAndReturn(func(filter *model.Filter, fn func(model.AccessControlRule) error) error {
+			for _, r := range testACL() {
+				if err := fn(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Times(1)
+	cacheMock.
+		EXPECT().
+		Find(gomock.Eq(&model.Filter{Permissions: []string{"s3:GetObject"}, Resources: []string{"*"}, ExactMatch: true})).
+		Return(testACL(), nil).
+		Times(1)
+	cacheMock.
+		EXPECT().
+		Find(gomock.Eq(&model.Filter{
+			Permissions: []string{"*"},
+			Resources:   []string{"*"},
+			Via:         model.Via{Policies: []string{"arn:aws:iam::111122223333:policy/S3"}},
+			ExactMatch:  true,
+		})).
+		Return(testACL(), nil).
+		Times(1)
+	cacheMock.
+		EXPECT().
+		Find(gomock.Eq(&model.Filter{Principals: []string{"Service[ec2.amazonaws.com]"}, ExactMatch: true})).
+		Return(testACL()[2:], nil).
+		Times(1)
+
+	var out bytes.Buffer
+	s := New(iamsnitch.NewAccessControlService(nil, cacheMock), &out)
+
+	require.Nil(t, s.Run(&lines{input: []string{
+		"set exact on",
+		"set pagesize 2",
+		"whocan s3:GetObject *",
+		"next",
+		"next",
+		"explain 3",
+		"drill 1 2",
+		"whatcan Service[ec2.amazonaws.com]",
+		"bogus",
+		"exit",
+		"whocan never run",
+	}}))
+
+	require.Equal(t, strings.Join([]string{
+		"[1] AWS[arn:aws:iam::111122223333:user/alice] s3:GetObject arn:aws:s3:::a",
+		"[2] AWS[arn:aws:iam::111122223333:user/alice] s3:GetObject arn:aws:s3:::b",
+		"showing 1-2 of 3, type next for more",
+		"[3] Service[ec2.amazonaws.com] s3:GetObject arn:aws:s3:::a",
+		"3 results",
+		"error: already on the last page",
+		"Service[ec2.amazonaws.com] is allowed s3:GetObject on arn:aws:s3:::a",
+		" 1. Service[ec2.amazonaws.com] assumes role arn:aws:iam::111122223333:role/App",
+		" 2. policy arn:aws:iam::111122223333:policy/S3 is attached to arn:aws:iam::111122223333:role/App",
+		" statement 1 of arn:aws:iam::111122223333:policy/S3 allows s3:GetObject on arn:aws:s3:::a",
+		"rules granted through Policy:arn:aws:iam::111122223333:policy/S3",
+		"[1] AWS[arn:aws:iam::111122223333:user/alice] s3:GetObject arn:aws:s3:::a",
+		"[2] AWS[arn:aws:iam::111122223333:user/alice] s3:GetObject arn:aws:s3:::b",
+		"showing 1-2 of 3, type next for more",
+		"[1] Service[ec2.amazonaws.com] s3:GetObject arn:aws:s3:::a",
+		"1 results",
+		"unknown command bogus, type help for the list of commands",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestComplete(t *testing.T) {
+	s := New(nil, io.Discard)
+	s.actions = []string{"s3:GetObject", "s3:GetObjectAcl", "s3:PutObject"}
+	s.resources = []string{"arn:aws:s3:::a", "arn:aws:s3:::b"}
+
+	tests := []struct {
+		name     string
+		line     string
+		pos      int
+		wantLine string
+		wantPos  int
+		wantOk   bool
+	}{
+		{"command", "who", 3, "whocan", 6, true},
+		{"action prefix", "whocan s3:G", 11, "whocan s3:GetObject", 19, true},
+		{"second action", "whocan s3:PutObject,s3:P", 24, "whocan s3:PutObject,s3:PutObject", 32, true},
+		{"resource", "whocan s3:GetObject ar", 22, "whocan s3:GetObject arn:aws:s3:::", 33, true},
+		{"cursor inside line", "set e off", 5, "set exact off", 9, true},
+		{"nothing to add", "whocan s3:GetObject arn:aws:s3:::", 33, "", 0, false},
+		{"no candidates", "whatcan x", 9, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, pos, ok := s.Complete(tt.line, tt.pos, '\t')
+			require.Equal(t, tt.wantOk, ok)
+			require.Equal(t, tt.wantLine, line)
+			require.Equal(t, tt.wantPos, pos)
+		})
+	}
+}
+
+type lines struct {
+	input []string
+}
+
+func (l *lines) ReadLine() (string, error) {
+	if len(l.input) == 0 {
+		return "", io.EOF
+	}
+	line := l.input[0]
+	l.input = l.input[1:]
+	return line, nil
+}
+
+func testACL() []model.AccessControlRule {
+	rule := func(principal string, resource string) model.AccessControlRule {
+		return model.AccessControlRule{
+			Principal:  model.Principal{ID: principal},
+			Permission: model.Permission{ID: "s3:GetObject"},
+			Resource:   model.Resource{ID: resource},
+			GrantChain: []model.GrantIface{
+				model.NewRoleGrant("arn:aws:iam::111122223333:role/App"),
+				model.NewPolicyGrant("arn:aws:iam::111122223333:policy/S3"),
+			},
+			StatementIndex: 1,
+		}
+	}
+	return []model.AccessControlRule{
+		rule("AWS[arn:aws:iam::111122223333:user/alice]", "arn:aws:s3:::a"),
+		rule("AWS[arn:aws:iam::111122223333:user/alice]", "arn:aws:s3:::b"),
+		rule("Service[ec2.amazonaws.com]", "arn:aws:s3:::a"),
+	}
+}
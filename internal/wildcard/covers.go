@@ -0,0 +1,32 @@
+package wildcard
+
+// Covers reports whether every value s can refer to is also matched by
+// pattern. Unlike Match it isn't symmetric: a * in s only stands for the
+// values a * of pattern can take, so s:Get* covers s:GetObject but not the
+// other way around. A ? matches any single character other than a wildcard.
+func Covers(pattern, s string) bool {
+	var p, i int
+	// position of the last * of pattern seen and the value it's matched up to
+	star, matched := -1, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, matched = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == s[i] || pattern[p] == '?' && s[i] != '*'):
+			p++
+			i++
+		case star >= 0:
+			// let the last * take one more character
+			matched++
+			p, i = star+1, matched
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,35 @@
+package wildcard
+
+import "testing"
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/logs/a", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/logs/*", true},
+		{"arn:aws:s3:::bucket/logs/*", "arn:aws:s3:::bucket/*", false},
+		{"arn:aws:s3:::bucket/a", "arn:aws:s3:::bucket/*", false},
+		{"*", "arn:aws:s3:::bucket/*", true},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:GetObject", "s3:Get*", false},
+		{"s3:*Object", "s3:GetObject", true},
+		{"s3:*Object", "s3:GetObjectAcl", false},
+		{"s3:Get*Acl", "s3:GetObjectAcl", true},
+		{"s3:GetObjec?", "s3:GetObject", true},
+		{"s3:GetObjec?", "s3:GetObjec*", false},
+		{"s3:GetObject", "s3:GetObject", true},
+		{"s3:GetObject", "s3:GetObjects", false},
+		{"", "", true},
+		{"*", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.s, func(t *testing.T) {
+			if got := Covers(tt.pattern, tt.s); got != tt.want {
+				t.Errorf("Covers(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package wildcard
+
+// Match reports whether two IAM patterns can refer to a common value. A * in
+// either string is treated as a wildcard, so the comparison is symmetric.
+func Match(s1, s2 string) bool {
+	var i1, i2 int
+
+	for i1 < len(s1) && i2 < len(s2) {
+		if s1[i1] == '*' {
+			i1++
+			if s2[i2] == '*' {
+				i2++
+				continue
+			}
+
+			adv, delim := findDelim(s1[i1:])
+			if delim == 0 {
+				return true
+			}
+			i1 += adv
+
+			adv = stripMatch(delim, s2[i2:])
+			if adv == 0 {
+				return false
+			}
+			i2 += adv
+
+			if i1 >= len(s1) && i2 < len(s2) {
+				return false
+			}
+		} else if s2[i2] == '*' {
+			i2++
+
+			adv, delim := findDelim(s2[i2:])
+			if delim == 0 {
+				return true
+			}
+			i2 += adv
+
+			adv = stripMatch(delim, s1[i1:])
+			if adv == 0 {
+				return false
+			}
+			i1 += adv
+
+			if i2 >= len(s2) && i1 < len(s1) {
+				return false
+			}
+		} else {
+			if s1[i1] != s2[i2] {
+				return false
+			}
+			i1++
+			i2++
+		}
+	}
+	return true
+}
+
+func findDelim(s string) (adv int, delim byte) {
+	for i, v := range s {
+		if v != '*' {
+			delim = byte(v)
+			adv = i + 1
+			break
+		}
+	}
+	return
+}
+
+func stripMatch(delim byte, s string) (adv int) {
+	for i, v := range s {
+		if v == rune(delim) {
+			adv = i + 1
+			break
+		}
+		if v == '*' {
+			adv = i + 2
+			break
+		}
+	}
+	return
+}
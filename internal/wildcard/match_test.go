@@ -0,0 +1,112 @@
+package wildcard
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	type args struct {
+		s1 string
+		s2 string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			"wildcard in string 1 only",
+			args{
+				"aws:s3:ap-southeast-2:2893483479:mybucket:test/somedir/obj",
+				"aws:s3:*:2893483479:mybucket:*",
+			},
+			true,
+		},
+		{
+			"wildcard in string 2 only",
+			args{
+				"aws:s3:*:2893483479:mybucket:*",
+				"aws:s3:ap-southeast-2:2893483479:mybucket:test/somedir/obj",
+			},
+			true,
+		},
+		{
+			"wildcards in different components of both strings",
+			args{
+				"aws:*:ap-*:2893483479:*:test/somedir/obj",
+				"aws:s3:*:2893483479:mybucket:*",
+			},
+			true,
+		},
+		{
+			"multiple wildcards in sequence shouldn't affect match",
+			args{
+				"aws:*:ap-*:2893483479:*******:test/*****/obj",
+				"aws:s3:*:2893483479:mybucket:*",
+			},
+			true,
+		},
+		{
+			"string 1 with less components than string 2",
+			args{
+				"aws:*:ap-*",
+				"aws:s3:*:2893483479:mybucket:*",
+			},
+			true,
+		},
+		{
+			"string 2 with less components than string 1",
+			args{
+				"aws:s3:*:2893483479:mybucket:*",
+				"aws:*:ap-*",
+			},
+			true,
+		},
+		{
+			"strings don't match",
+			args{
+				"aws:*:ap-*:2893483479:test:*",
+				"aws:s3:*:2893483479:mybucket:*",
+			},
+			false,
+		},
+		{
+			"string 1 can be anything",
+			args{
+				"*",
+				"arn:aws:logs:*:*:log-group:*",
+			},
+			true,
+		},
+		{
+			"string 2 can be anything",
+			args{
+				"arn:aws:logs:*:*:log-group:*",
+				"*",
+			},
+			true,
+		},
+		{
+			"string 1 ends in a letter present in the middle of string 2",
+			args{
+				"*s",
+				"arn:aws:logs:*:*:log-group:*",
+			},
+			false,
+		},
+		{
+			"string 1 has a letter in string 2 surrounded by *",
+			args{
+				"*s*",
+				"arn:aws:logs:*:*:log-group:*",
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Match(tt.args.s1, tt.args.s2)
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}